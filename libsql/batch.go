@@ -0,0 +1,236 @@
+package libsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
+)
+
+// Batch is a list of statements that the server executes in one round trip. Each step can
+// have a condition on the outcome of earlier steps, which makes all-or-nothing writes possible
+// without an interactive transaction:
+//
+//	var b libsql.Batch
+//	begin := b.Add("BEGIN")
+//	insert := b.AddIf(libsql.StepOK(begin), "INSERT INTO users (name) VALUES (?)", "alice")
+//	commit := b.AddIf(libsql.StepOK(insert), "COMMIT")
+//	b.AddIf(libsql.Not(libsql.StepOK(commit)), "ROLLBACK")
+//	res, err := libsql.ExecBatch(ctx, conn, &b)
+type Batch struct {
+	batch hrana.Batch
+	// args are the arguments of the steps, converted again by ExecBatch with the codecs and the
+	// time format of the connection.
+	args [][]any
+	err  error
+}
+
+// Condition decides whether a step of a Batch is executed.
+type Condition struct {
+	cond hrana.BatchCondition
+	// maxStep is the highest step referenced by the condition, or -1.
+	maxStep int
+}
+
+// StepOK is met when the given step was executed and succeeded.
+func StepOK(step int) Condition {
+	s := int32(step)
+	return Condition{hrana.BatchCondition{Type: "ok", Step: &s}, step}
+}
+
+// StepError is met when the given step was executed and failed.
+func StepError(step int) Condition {
+	s := int32(step)
+	return Condition{hrana.BatchCondition{Type: "error", Step: &s}, step}
+}
+
+// Not is met when cond is not. A skipped step is neither OK nor failed, so Not(StepOK(i)) is met
+// when step i failed or was skipped.
+func Not(cond Condition) Condition {
+	c := cond.cond
+	return Condition{hrana.BatchCondition{Type: "not", Cond: &c}, cond.maxStep}
+}
+
+// And is met when all of conds are met.
+func And(conds ...Condition) Condition {
+	return combine("and", conds)
+}
+
+// Or is met when at least one of conds is met.
+func Or(conds ...Condition) Condition {
+	return combine("or", conds)
+}
+
+func combine(kind string, conds []Condition) Condition {
+	res := Condition{hrana.BatchCondition{Type: kind, Conds: []hrana.BatchCondition{}}, -1}
+	for _, c := range conds {
+		res.cond.Conds = append(res.cond.Conds, c.cond)
+		if c.maxStep > res.maxStep {
+			res.maxStep = c.maxStep
+		}
+	}
+	return res
+}
+
+// Add appends a statement that is always executed and returns its step index.
+// Arguments are given as for sql.DB.Exec, including sql.Named.
+func (b *Batch) Add(query string, args ...any) int {
+	return b.add(nil, query, args)
+}
+
+// AddIf appends a statement that is only executed if cond is met and returns its step index.
+// Conditions can only refer to earlier steps.
+func (b *Batch) AddIf(cond Condition, query string, args ...any) int {
+	return b.add(&cond, query, args)
+}
+
+func (b *Batch) add(cond *Condition, query string, args []any) int {
+	step := len(b.batch.Steps)
+	stmt, err := newBatchStmt(query, args, nil)
+	if err != nil && b.err == nil {
+		b.err = fmt.Errorf("invalid step %d of batch: %w", step, err)
+	}
+	b.batch.Steps = append(b.batch.Steps, hrana.BatchStep{Stmt: stmt})
+	b.args = append(b.args, args)
+	if cond != nil {
+		if cond.maxStep >= step && b.err == nil {
+			b.err = fmt.Errorf("the condition of step %d refers to step %d, which is not before it", step, cond.maxStep)
+		}
+		c := cond.cond
+		b.batch.Steps[step].Condition = &c
+	}
+	return step
+}
+
+// newBatchStmt returns a statement with args, converted as set by values, or as set by default
+// when it is nil.
+func newBatchStmt(query string, args []any, values *hrana.Values) (hrana.Stmt, error) {
+	if values == nil {
+		values = &hrana.Values{}
+	}
+	stmt := hrana.Stmt{Sql: &query, WantRows: true}
+	namedValues := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		namedValues[i].Ordinal = i + 1
+		if named, ok := arg.(sql.NamedArg); ok {
+			namedValues[i].Name = named.Name
+			arg = named.Value
+		}
+		namedValues[i].Value = arg
+		if err := values.CheckNamedValue(&namedValues[i]); err != nil {
+			return stmt, err
+		}
+	}
+	params, err := shared.ConvertArgs(namedValues)
+	if err != nil {
+		return stmt, err
+	}
+	if err := stmt.AddArgs(params); err != nil {
+		return stmt, err
+	}
+	return stmt, nil
+}
+
+// BatchResult holds the outcome of each step of a Batch, in order.
+type BatchResult struct {
+	Steps []BatchStepResult
+}
+
+type BatchStepResult struct {
+	// Executed is false when the condition of the step was not met.
+	Executed bool
+	// Err is the error of a failed step. It is a *Error, and errors.As finds a
+	// *ConstraintError in it for constraint violations.
+	Err          error
+	Columns      []string
+	Rows         [][]any
+	RowsAffected int64
+	LastInsertId int64
+}
+
+// batchExecer is implemented by the connections of the remote drivers.
+type batchExecer interface {
+	ExecBatch(ctx context.Context, batch *hrana.Batch) (*hrana.BatchResult, error)
+	Values() *hrana.Values
+}
+
+// ExecBatch sends b to the server in one request. Failed steps don't make ExecBatch fail:
+// their errors are reported in the result. The returned error is for failures of the request itself.
+func ExecBatch(ctx context.Context, conn *sql.Conn, b *Batch) (*BatchResult, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	var res *hrana.BatchResult
+	var values *hrana.Values
+	err := conn.Raw(func(driverConn any) error {
+		execer, ok := driverConn.(batchExecer)
+		if !ok {
+			return fmt.Errorf("batches are only supported by remote databases")
+		}
+		values = execer.Values()
+		batch, err := b.withValues(values)
+		if err != nil {
+			return err
+		}
+		res, err = execer.ExecBatch(ctx, batch)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newBatchResult(b, res, values)
+}
+
+// withValues returns the batch with its arguments converted as set by values.
+func (b *Batch) withValues(values *hrana.Values) (*hrana.Batch, error) {
+	batch := hrana.Batch{Steps: make([]hrana.BatchStep, len(b.batch.Steps))}
+	for i, step := range b.batch.Steps {
+		stmt, err := newBatchStmt(*step.Stmt.Sql, b.args[i], values)
+		if err != nil {
+			return nil, err
+		}
+		batch.Steps[i] = hrana.BatchStep{Stmt: stmt, Condition: step.Condition}
+	}
+	return &batch, nil
+}
+
+func newBatchResult(b *Batch, res *hrana.BatchResult, values *hrana.Values) (*BatchResult, error) {
+	result := &BatchResult{Steps: make([]BatchStepResult, len(b.batch.Steps))}
+	for i := range result.Steps {
+		step := &result.Steps[i]
+		if i < len(res.StepErrors) && res.StepErrors[i] != nil {
+			step.Executed = true
+			step.Err = res.StepErrors[i].ToError(*b.batch.Steps[i].Stmt.Sql, i)
+		}
+		if i >= len(res.StepResults) || res.StepResults[i] == nil {
+			continue
+		}
+		r := res.StepResults[i]
+		step.Executed = true
+		step.RowsAffected = int64(r.AffectedRowCount)
+		step.LastInsertId = r.GetLastInsertRowId()
+		step.Columns = make([]string, len(r.Cols))
+		for c, col := range r.Cols {
+			if col.Name != nil {
+				step.Columns[c] = *col.Name
+			}
+		}
+		step.Rows = make([][]any, len(r.Rows))
+		for j, row := range r.Rows {
+			step.Rows[j] = make([]any, len(row))
+			for c, value := range row {
+				if c < len(r.Cols) {
+					v, err := values.DecodeValue(value, r.Cols[c].Type)
+					if err != nil {
+						return nil, fmt.Errorf("failed to decode step %d: %w", i, err)
+					}
+					step.Rows[j][c] = v
+				}
+			}
+		}
+	}
+	return result, nil
+}
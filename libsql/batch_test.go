@@ -0,0 +1,134 @@
+package libsql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+)
+
+func TestBatchConditions(t *testing.T) {
+	var b Batch
+	begin := b.Add("BEGIN")
+	insert := b.AddIf(StepOK(begin), "INSERT INTO t VALUES (?)", int64(1))
+	b.AddIf(And(StepOK(insert), Not(StepError(begin))), "COMMIT")
+	b.AddIf(Or(StepError(insert), Not(StepOK(2))), "ROLLBACK")
+	b.AddIf(And(), "SELECT 1")
+	if b.err != nil {
+		t.Fatalf("Unexpected error: %v", b.err)
+	}
+	want := []string{
+		"null",
+		`{"type":"ok","step":0}`,
+		`{"type":"and","conds":[{"type":"ok","step":1},{"type":"not","cond":{"type":"error","step":0}}]}`,
+		`{"type":"or","conds":[{"type":"error","step":1},{"type":"not","cond":{"type":"ok","step":2}}]}`,
+		// The server needs the conditions of And even when there are none.
+		`{"type":"and","conds":[]}`,
+	}
+	for i, step := range b.batch.Steps {
+		got, err := json.Marshal(step.Condition)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(got) != want[i] {
+			t.Errorf("got condition %s for step %d, want %s", got, i, want[i])
+		}
+	}
+}
+
+func TestBatchConditionOnLaterStep(t *testing.T) {
+	var b Batch
+	b.Add("SELECT 1")
+	b.AddIf(Not(Or(StepOK(0), StepOK(1))), "SELECT 2")
+	if b.err == nil {
+		t.Errorf("a condition on the step itself should be rejected")
+	}
+	if _, err := ExecBatch(context.Background(), nil, &b); err != b.err {
+		t.Errorf("got %v, want the error of the batch", err)
+	}
+}
+
+func TestExecBatch(t *testing.T) {
+	batches := make(chan *hrana.Batch, 1)
+	server, _, _ := newTestServer(t, func(req hrana.StreamRequest) hrana.StreamResult {
+		result := hrana.StreamResult{Type: "ok", Response: &hrana.StreamResponse{Type: req.Type}}
+		switch req.Type {
+		case "batch":
+			batches <- req.Batch
+			result.Response.Result = json.RawMessage(`{
+				"step_results": [
+					{"cols": [{"name": "id", "decltype": "INTEGER"}, {"name": "name", "decltype": "TEXT"}],
+					 "rows": [[{"type": "integer", "value": "1"}, {"type": "text", "value": "alice"}]],
+					 "affected_row_count": 1, "last_insert_rowid": "1"},
+					null,
+					null
+				],
+				"step_errors": [
+					null,
+					{"message": "UNIQUE constraint failed: users.name", "code": "SQLITE_CONSTRAINT_UNIQUE"},
+					null
+				]
+			}`)
+		case "get_autocommit":
+			autocommit := true
+			result.Response.IsAutocommit = &autocommit
+		}
+		return result
+	})
+	db, err := sql.Open("libsql", server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	var b Batch
+	first := b.Add("INSERT INTO users (name) VALUES (?) RETURNING id, name", "alice")
+	second := b.AddIf(StepOK(first), "INSERT INTO users (name) VALUES (?)", sql.Named("name", "alice"))
+	b.AddIf(StepOK(second), "SELECT 1")
+	res, err := ExecBatch(ctx, conn, &b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	batch := <-batches
+	if len(batch.Steps) != 3 || batch.Steps[1].Condition == nil || batch.Steps[1].Condition.Type != "ok" {
+		t.Fatalf("unexpected batch %+v", batch)
+	}
+	if args := batch.Steps[0].Stmt.Args; len(args) != 1 || args[0].Type != "text" || args[0].Value != "alice" {
+		t.Errorf("unexpected arguments %+v", args)
+	}
+	if args := batch.Steps[1].Stmt.NamedArgs; len(args) != 1 || args[0].Name != "name" {
+		t.Errorf("unexpected named arguments %+v", args)
+	}
+
+	if len(res.Steps) != 3 {
+		t.Fatalf("got %d steps, want 3", len(res.Steps))
+	}
+	want := BatchStepResult{
+		Executed:     true,
+		Columns:      []string{"id", "name"},
+		Rows:         [][]any{{int64(1), "alice"}},
+		RowsAffected: 1,
+		LastInsertId: 1,
+	}
+	if !reflect.DeepEqual(res.Steps[0], want) {
+		t.Errorf("got %+v, want %+v", res.Steps[0], want)
+	}
+	var constraintErr *ConstraintError
+	if step := res.Steps[1]; !step.Executed || !errors.As(step.Err, &constraintErr) || constraintErr.Kind != ConstraintUnique {
+		t.Errorf("got %+v, want a failed step with a UNIQUE constraint error", step)
+	}
+	if step := res.Steps[2]; step.Executed || step.Err != nil {
+		t.Errorf("got %+v, want a skipped step", step)
+	}
+}
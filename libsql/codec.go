@@ -0,0 +1,30 @@
+package libsql
+
+import "github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+
+// Codec converts between the Go values of a custom type and the values stored in the database.
+// Codecs are registered on the connector with WithCodec.
+//
+// Encode receives the arguments of the Go type the codec is registered for, and returns a value
+// that is then converted like any other argument. Decode receives the values of the columns of
+// the declared type the codec is registered for: an int64, a float64, a string or a []byte, since
+// NULL is never decoded. Values returned by Decode can be scanned into a variable of their type,
+// or of any type they are assignable to.
+type Codec = hrana.Codec
+
+var (
+	// BoolCodec decodes integers and the texts "true" and "false" as bool, for BOOLEAN columns.
+	BoolCodec = hrana.BoolCodec
+	// JSONCodec decodes texts and blobs as json.RawMessage, for JSON columns. It encodes
+	// json.RawMessage as text, since SQLite reads blobs as JSONB.
+	JSONCodec = hrana.JSONCodec
+	// UUIDCodec decodes 16-byte blobs and the text form of UUIDs as [16]byte, for UUID columns.
+	// It encodes [16]byte as a 16-byte blob.
+	UUIDCodec = hrana.UUIDCodec
+	// DecimalCodec decodes texts and numbers as Decimal, for DECIMAL columns. It encodes Decimal
+	// as text.
+	DecimalCodec = hrana.DecimalCodec
+)
+
+// Decimal is a decimal number in text form, see DecimalCodec.
+type Decimal = hrana.Decimal
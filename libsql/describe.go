@@ -0,0 +1,37 @@
+package libsql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
+)
+
+// StmtDescription is the metadata of a statement, as reported by the server without executing it:
+// its parameters, its result columns with their declared types, and whether it is read-only or
+// an EXPLAIN.
+type StmtDescription = shared.StmtDescription
+
+type ColumnDescription = shared.ColumnDescription
+
+// describer is implemented by the connections of the remote drivers.
+type describer interface {
+	Describe(ctx context.Context, query string) (*shared.StmtDescription, error)
+}
+
+// Describe asks the server to describe query without executing it. It needs a server that speaks
+// Hrana 2 or later.
+func Describe(ctx context.Context, conn *sql.Conn, query string) (*StmtDescription, error) {
+	var desc *StmtDescription
+	err := conn.Raw(func(driverConn any) error {
+		d, ok := driverConn.(describer)
+		if !ok {
+			return fmt.Errorf("describing statements is only supported by remote databases")
+		}
+		var err error
+		desc, err = d.Describe(ctx, query)
+		return err
+	})
+	return desc, err
+}
@@ -0,0 +1,200 @@
+package hrana
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http"
+)
+
+// Client opens streams on a database. It shares the settings and the HTTP client of the
+// connector it was made from.
+type Client struct {
+	connector *http.Connector
+}
+
+// hranaConnector is implemented by the connectors of libsql for http:// and https:// URLs,
+// and for libsql:// URLs, which use HTTP.
+type hranaConnector interface {
+	HranaConnector() *http.Connector
+}
+
+// NewClient returns a client for the database of a connector returned by libsql.NewConnector.
+// WebSocket and local databases are not supported.
+func NewClient(connector driver.Connector) (*Client, error) {
+	c, ok := connector.(hranaConnector)
+	if !ok {
+		return nil, errors.New("the Hrana client only supports databases reached over HTTP")
+	}
+	return &Client{c.HranaConnector()}, nil
+}
+
+// OpenStream returns a new stream. It is opened on the server by its first request, and must
+// be closed with Stream.Close.
+func (c *Client) OpenStream() *Stream {
+	return &Stream{c.connector.OpenStream()}
+}
+
+// Execute executes a statement on a new stream, which is closed in the same round trip.
+func (c *Client) Execute(ctx context.Context, stmt Stmt) (*StmtResult, error) {
+	results, err := c.OpenStream().Pipeline(ctx, ExecuteRequest(stmt), CloseRequest())
+	if err != nil {
+		return nil, err
+	}
+	return executeResult(stmt, results[0])
+}
+
+// Batch executes a batch on a new stream, which is closed in the same round trip.
+func (c *Client) Batch(ctx context.Context, batch Batch) (*BatchResult, error) {
+	results, err := c.OpenStream().Pipeline(ctx, BatchRequest(batch), CloseRequest())
+	if err != nil {
+		return nil, err
+	}
+	return batchResult(results[0])
+}
+
+// Close waits for the streams released by the connections of the connector to be closed,
+// like sql.DB.Close does. It is only needed when the connector is not used by a sql.DB.
+func (c *Client) Close() error {
+	return c.connector.Close()
+}
+
+// pipeliner is implemented by the streams of clients and by the connections of libsql over HTTP.
+type pipeliner interface {
+	Pipeline(ctx context.Context, requests []hrana.StreamRequest) ([]hrana.StreamResult, error)
+	NewSqlId() int32
+}
+
+// Stream sends requests on one Hrana stream. Its methods must not be called concurrently.
+type Stream struct {
+	p pipeliner
+}
+
+// ConnStream returns the stream of a connection of libsql over HTTP, from the callback of
+// sql.Conn.Raw. The stream may only be used in the callback. Statements executed on it are
+// part of the transaction of the connection, if any, and the stream of a transaction can't be
+// closed.
+func ConnStream(driverConn any) (*Stream, error) {
+	p, ok := driverConn.(pipeliner)
+	if !ok {
+		return nil, errors.New("the Hrana stream is only available for databases reached over HTTP")
+	}
+	return &Stream{p}, nil
+}
+
+// Pipeline sends requests in one round trip and returns their results, in order. The errors
+// of the requests are reported in the results.
+func (s *Stream) Pipeline(ctx context.Context, requests ...StreamRequest) ([]StreamResult, error) {
+	return s.p.Pipeline(ctx, requests)
+}
+
+// Execute executes a statement.
+func (s *Stream) Execute(ctx context.Context, stmt Stmt) (*StmtResult, error) {
+	result, err := s.send(ctx, ExecuteRequest(stmt))
+	if err != nil {
+		return nil, err
+	}
+	return executeResult(stmt, result)
+}
+
+// Batch executes a batch. The errors of failed steps are reported in the result.
+func (s *Stream) Batch(ctx context.Context, batch Batch) (*BatchResult, error) {
+	result, err := s.send(ctx, BatchRequest(batch))
+	if err != nil {
+		return nil, err
+	}
+	return batchResult(result)
+}
+
+// Sequence executes the statements of sql, separated by semicolons, without arguments or results.
+func (s *Stream) Sequence(ctx context.Context, sql string) error {
+	result, err := s.send(ctx, SequenceRequest(sql))
+	if err != nil {
+		return err
+	}
+	return resultError(sql, result)
+}
+
+// Describe returns the parameters and columns of a statement without executing it.
+func (s *Stream) Describe(ctx context.Context, sql string) (*DescribeResult, error) {
+	result, err := s.send(ctx, DescribeRequest(sql))
+	if err != nil {
+		return nil, err
+	}
+	if err := resultError(sql, result); err != nil {
+		return nil, err
+	}
+	return result.Response.DescribeResult()
+}
+
+// StoreSQL stores a SQL text on the stream and returns its id, for NewStoredStmt. Stored texts
+// are freed with CloseSQL or when the stream is closed.
+func (s *Stream) StoreSQL(ctx context.Context, sql string) (int32, error) {
+	id := s.p.NewSqlId()
+	result, err := s.send(ctx, StoreSQLRequest(sql, id))
+	if err != nil {
+		return 0, err
+	}
+	if err := resultError(sql, result); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// CloseSQL frees a SQL text stored with StoreSQL.
+func (s *Stream) CloseSQL(ctx context.Context, sqlId int32) error {
+	result, err := s.send(ctx, CloseSQLRequest(sqlId))
+	if err != nil {
+		return err
+	}
+	return resultError("", result)
+}
+
+// Close closes the stream, which rolls back its transaction, if any.
+func (s *Stream) Close(ctx context.Context) error {
+	result, err := s.send(ctx, CloseRequest())
+	if err != nil {
+		return err
+	}
+	return resultError("", result)
+}
+
+func (s *Stream) send(ctx context.Context, request StreamRequest) (StreamResult, error) {
+	results, err := s.p.Pipeline(ctx, []hrana.StreamRequest{request})
+	if err != nil {
+		return StreamResult{}, err
+	}
+	return results[0], nil
+}
+
+// resultError returns the error of a request as a *libsql.Error.
+func resultError(sql string, result StreamResult) error {
+	if result.Error != nil {
+		return result.Error.ToError(sql, -1)
+	}
+	if result.Response == nil {
+		return fmt.Errorf("unexpected result type: %s", result.Type)
+	}
+	return nil
+}
+
+func executeResult(stmt Stmt, result StreamResult) (*StmtResult, error) {
+	sql := ""
+	if stmt.Sql != nil {
+		sql = *stmt.Sql
+	}
+	if err := resultError(sql, result); err != nil {
+		return nil, err
+	}
+	return result.Response.ExecuteResult()
+}
+
+func batchResult(result StreamResult) (*BatchResult, error) {
+	if err := resultError("", result); err != nil {
+		return nil, err
+	}
+	return result.Response.BatchResultWithErrors()
+}
@@ -0,0 +1,119 @@
+// Package hrana is a low-level client for the Hrana protocol that libSQL servers speak over HTTP.
+// It sends pipelines of requests as given, which makes it possible to mix execute, batch,
+// store_sql and close requests in one round trip:
+//
+//	connector, err := libsql.NewConnector("libsql://db.example.com", libsql.WithAuthToken(token))
+//	client, err := hrana.NewClient(connector)
+//	stream := client.OpenStream()
+//	id, err := stream.StoreSQL(ctx, "INSERT INTO users (name) VALUES (?)")
+//	stmt, err := hrana.NewStoredStmt(id, "alice")
+//	results, err := stream.Pipeline(ctx, hrana.ExecuteRequest(stmt), hrana.CloseRequest())
+//
+// The stream of a connection of a sql.DB can be used as well, through sql.Conn.Raw and ConnStream.
+package hrana
+
+import (
+	"database/sql"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+)
+
+type (
+	Stmt           = hrana.Stmt
+	NamedArg       = hrana.NamedArg
+	Value          = hrana.Value
+	Batch          = hrana.Batch
+	BatchStep      = hrana.BatchStep
+	BatchCondition = hrana.BatchCondition
+
+	StreamRequest  = hrana.StreamRequest
+	StreamResult   = hrana.StreamResult
+	StreamResponse = hrana.StreamResponse
+	Error          = hrana.Error
+
+	StmtResult     = hrana.StmtResult
+	Column         = hrana.Column
+	BatchResult    = hrana.BatchResult
+	DescribeResult = hrana.DescribeResult
+	DescribeParam  = hrana.DescribeParam
+	DescribeCol    = hrana.DescribeCol
+)
+
+// ValueOf converts a Go value to a Hrana value. It accepts the same values as the arguments of
+// sql.DB.Exec: nil, integers and floats of any size, bool, string, []byte, time.Time, pointers to
+// them, driver.Valuer implementations and named types of these kinds.
+func ValueOf(v any) (Value, error) {
+	return hrana.ToValue(v)
+}
+
+// NewStmt returns a statement with the given arguments, which are given as for sql.DB.Exec,
+// including sql.Named. The statement returns its rows.
+func NewStmt(query string, args ...any) (Stmt, error) {
+	stmt := Stmt{Sql: &query, WantRows: true}
+	return stmt, addArgs(&stmt, args)
+}
+
+// NewStoredStmt is like NewStmt for a SQL text stored on the stream with StoreSQL.
+func NewStoredStmt(sqlId int32, args ...any) (Stmt, error) {
+	stmt := Stmt{SqlId: &sqlId, WantRows: true}
+	return stmt, addArgs(&stmt, args)
+}
+
+func addArgs(stmt *Stmt, args []any) error {
+	for _, arg := range args {
+		named, isNamed := arg.(sql.NamedArg)
+		if isNamed {
+			arg = named.Value
+		}
+		value, err := hrana.ToValue(arg)
+		if err != nil {
+			return err
+		}
+		if isNamed {
+			stmt.NamedArgs = append(stmt.NamedArgs, NamedArg{Name: named.Name, Value: value})
+		} else {
+			stmt.Args = append(stmt.Args, value)
+		}
+	}
+	return nil
+}
+
+// ExecuteRequest returns a request that executes stmt.
+func ExecuteRequest(stmt Stmt) StreamRequest {
+	return StreamRequest{Type: "execute", Stmt: &stmt}
+}
+
+// BatchRequest returns a request that executes the steps of batch.
+func BatchRequest(batch Batch) StreamRequest {
+	return StreamRequest{Type: "batch", Batch: &batch}
+}
+
+// StoreSQLRequest returns a request that stores sql on the stream under sqlId.
+func StoreSQLRequest(sql string, sqlId int32) StreamRequest {
+	return hrana.StoreSqlStream(sql, sqlId)
+}
+
+// CloseSQLRequest returns a request that removes the SQL text stored under sqlId.
+func CloseSQLRequest(sqlId int32) StreamRequest {
+	return hrana.CloseStoredSqlStream(sqlId)
+}
+
+// CloseRequest returns a request that closes the stream.
+func CloseRequest() StreamRequest {
+	return hrana.CloseStream()
+}
+
+// SequenceRequest returns a request that executes the statements of sql, separated by semicolons.
+func SequenceRequest(sql string) StreamRequest {
+	return hrana.SequenceStream(sql)
+}
+
+// DescribeRequest returns a request that describes sql without executing it.
+func DescribeRequest(sql string) StreamRequest {
+	return hrana.DescribeStream(sql)
+}
+
+// GetAutocommitRequest returns a Hrana 3 request that reports whether a transaction is open.
+func GetAutocommitRequest() StreamRequest {
+	return hrana.GetAutocommitStream()
+}
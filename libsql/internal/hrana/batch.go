@@ -1,5 +1,7 @@
 package hrana
 
+import "encoding/json"
+
 type Batch struct {
 	Steps            []BatchStep `json:"steps"`
 	ReplicationIndex *uint64     `json:"replication_index,omitempty"`
@@ -17,6 +19,23 @@ type BatchCondition struct {
 	Conds []BatchCondition `json:"conds,omitempty"`
 }
 
+// MarshalJSON always writes the conds of "and" and "or" conditions, which the server requires
+// even when there are none.
+func (c BatchCondition) MarshalJSON() ([]byte, error) {
+	type alias BatchCondition
+	if c.Type != "and" && c.Type != "or" {
+		return json.Marshal(alias(c))
+	}
+	conds := c.Conds
+	if conds == nil {
+		conds = []BatchCondition{}
+	}
+	return json.Marshal(struct {
+		Type  string           `json:"type"`
+		Conds []BatchCondition `json:"conds"`
+	}{c.Type, conds})
+}
+
 func (b *Batch) Add(stmt Stmt) {
 	b.Steps = append(b.Steps, BatchStep{Stmt: stmt})
 }
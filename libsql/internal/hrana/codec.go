@@ -0,0 +1,243 @@
+package hrana
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
+)
+
+// Codec converts between the Go values of a custom type and the values stored in the database.
+type Codec interface {
+	// Encode converts an argument of a Go type the codec is registered for. The result is
+	// then converted like any other argument.
+	Encode(v any) (any, error)
+	// Decode converts a value read from a column of a declared type the codec is registered
+	// for. The value is an int64, a float64, a string or a []byte: NULL is never decoded.
+	Decode(v any) (any, error)
+}
+
+// Values converts the arguments of the connections of a connector to the values sent to the
+// server, and the values of their results to Go values. The zero value has no codecs and
+// handles times as set by the zero TimeFormat.
+type Values struct {
+	Times TimeFormat
+	// DeclTypeCodecs decode the columns by database type name, see shared.DatabaseTypeName.
+	// They take precedence over the decoding of times.
+	DeclTypeCodecs map[string]Codec
+	// GoTypeCodecs encode the arguments by type.
+	GoTypeCodecs map[reflect.Type]Codec
+}
+
+// CheckNamedValue converts arguments with the codecs of their types, then like DriverValue, and
+// encodes times as set by Times. It implements driver.NamedValueChecker for the connections of
+// both drivers.
+func (v *Values) CheckNamedValue(nv *driver.NamedValue) error {
+	value := nv.Value
+	if codec, ok := v.GoTypeCodecs[reflect.TypeOf(value)]; ok && value != nil {
+		var err error
+		if value, err = codec.Encode(value); err != nil {
+			return err
+		}
+	}
+	value, err := DriverValue(value)
+	if err != nil {
+		return err
+	}
+	if t, ok := value.(time.Time); ok {
+		value = v.Times.Encode(t)
+	}
+	nv.Value = value
+	return nil
+}
+
+// Decode returns value, read from a column declared as declType, as a Go value. The blobs of
+// vector columns are decoded as []float32 or []float64.
+func (v *Values) Decode(value any, declType string) (any, error) {
+	if value == nil || declType == "" {
+		return value, nil
+	}
+	if codec, ok := v.DeclTypeCodecs[shared.DatabaseTypeName(declType)]; ok {
+		return codec.Decode(value)
+	}
+	if blob, ok := value.([]byte); ok {
+		if _, ok := shared.VectorScanType(declType); ok {
+			return shared.DecodeVector(blob)
+		}
+	}
+	return v.Times.Decode(value, declType), nil
+}
+
+// ScanType returns the type of the values that Decode returns for a column declared as declType:
+// the type decoded by the codec of the column, time.Time for the time columns of Times, or the
+// type that follows from the affinity of the column, see shared.ScanType. The values of columns
+// with a codec that isn't built into the driver can have any type.
+func (v *Values) ScanType(declType string) reflect.Type {
+	if codec, ok := v.DeclTypeCodecs[shared.DatabaseTypeName(declType)]; ok && declType != "" {
+		if c, ok := codec.(scanTyper); ok {
+			return c.scanType()
+		}
+		return scanTypeAny
+	}
+	if v.Times.isTimeColumn(declType) {
+		return scanTypeTime
+	}
+	return shared.ScanType(declType)
+}
+
+var (
+	scanTypeAny  = reflect.TypeOf(new(any)).Elem()
+	scanTypeTime = reflect.TypeOf(time.Time{})
+)
+
+// scanTyper is implemented by the built-in codecs, which decode the values of a column to a
+// single type.
+type scanTyper interface {
+	scanType() reflect.Type
+}
+
+// DecodeValue is Decode for a value of a result.
+func (v *Values) DecodeValue(value Value, columnType *string) (any, error) {
+	return v.Decode(value.goValue(), declType(columnType))
+}
+
+func declType(columnType *string) string {
+	if columnType == nil {
+		return ""
+	}
+	return *columnType
+}
+
+// BoolCodec decodes integers and the texts "true" and "false" as bool, for BOOLEAN columns.
+// It encodes bool as 0 or 1.
+var BoolCodec Codec = boolCodec{}
+
+type boolCodec struct{}
+
+func (boolCodec) Encode(v any) (any, error) {
+	return v, nil
+}
+
+func (boolCodec) scanType() reflect.Type {
+	return reflect.TypeOf(false)
+}
+
+func (boolCodec) Decode(v any) (any, error) {
+	switch v := v.(type) {
+	case int64:
+		return v != 0, nil
+	case float64:
+		return v != 0, nil
+	case string:
+		return strconv.ParseBool(v)
+	}
+	return nil, fmt.Errorf("can't decode %T as a bool", v)
+}
+
+// JSONCodec decodes texts and blobs as json.RawMessage, for JSON columns. It encodes
+// json.RawMessage as text, since SQLite reads blobs as JSONB.
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(v any) (any, error) {
+	raw, ok := v.(json.RawMessage)
+	if !ok {
+		return nil, fmt.Errorf("can't encode %T as JSON", v)
+	}
+	return string(raw), nil
+}
+
+func (jsonCodec) scanType() reflect.Type {
+	return reflect.TypeOf(json.RawMessage(nil))
+}
+
+func (jsonCodec) Decode(v any) (any, error) {
+	switch v := v.(type) {
+	case string:
+		return json.RawMessage(v), nil
+	case []byte:
+		return json.RawMessage(v), nil
+	}
+	return nil, fmt.Errorf("can't decode %T as JSON", v)
+}
+
+// UUIDCodec decodes 16-byte blobs and the text form of UUIDs as [16]byte, for UUID columns.
+// It encodes [16]byte as a 16-byte blob.
+var UUIDCodec Codec = uuidCodec{}
+
+type uuidCodec struct{}
+
+func (uuidCodec) Encode(v any) (any, error) {
+	uuid, ok := v.([16]byte)
+	if !ok {
+		return nil, fmt.Errorf("can't encode %T as a UUID", v)
+	}
+	return uuid[:], nil
+}
+
+func (uuidCodec) scanType() reflect.Type {
+	return reflect.TypeOf([16]byte{})
+}
+
+func (uuidCodec) Decode(v any) (any, error) {
+	var uuid [16]byte
+	switch v := v.(type) {
+	case []byte:
+		if len(v) != len(uuid) {
+			return nil, fmt.Errorf("a UUID has 16 bytes, got %d", len(v))
+		}
+		copy(uuid[:], v)
+		return uuid, nil
+	case string:
+		text := strings.ReplaceAll(v, "-", "")
+		if len(text) != 2*len(uuid) {
+			return nil, fmt.Errorf("invalid UUID %q", v)
+		}
+		if _, err := hex.Decode(uuid[:], []byte(text)); err != nil {
+			return nil, fmt.Errorf("invalid UUID %q: %w", v, err)
+		}
+		return uuid, nil
+	}
+	return nil, fmt.Errorf("can't decode %T as a UUID", v)
+}
+
+// Decimal is a decimal number in text form. Stored as text, decimals keep all their digits,
+// which floats would round.
+type Decimal string
+
+// DecimalCodec decodes texts and numbers as Decimal, for DECIMAL columns. It encodes Decimal as
+// text.
+var DecimalCodec Codec = decimalCodec{}
+
+type decimalCodec struct{}
+
+func (decimalCodec) Encode(v any) (any, error) {
+	d, ok := v.(Decimal)
+	if !ok {
+		return nil, fmt.Errorf("can't encode %T as a decimal", v)
+	}
+	return string(d), nil
+}
+
+func (decimalCodec) scanType() reflect.Type {
+	return reflect.TypeOf(Decimal(""))
+}
+
+func (decimalCodec) Decode(v any) (any, error) {
+	switch v := v.(type) {
+	case string:
+		return Decimal(v), nil
+	case int64:
+		return Decimal(strconv.FormatInt(v, 10)), nil
+	case float64:
+		return Decimal(strconv.FormatFloat(v, 'f', -1, 64)), nil
+	}
+	return nil, fmt.Errorf("can't decode %T as a decimal", v)
+}
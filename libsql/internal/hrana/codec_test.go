@@ -0,0 +1,134 @@
+package hrana
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValuesCodecs(t *testing.T) {
+	uuid := [16]byte{0x12, 0x34, 15: 0xff}
+	values := Values{
+		DeclTypeCodecs: map[string]Codec{"UUID": UUIDCodec, "TIMESTAMP": DecimalCodec},
+		GoTypeCodecs:   map[reflect.Type]Codec{reflect.TypeOf(uuid): UUIDCodec},
+	}
+
+	nv := driver.NamedValue{Ordinal: 1, Value: uuid}
+	if err := values.CheckNamedValue(&nv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(nv.Value, uuid[:]) {
+		t.Errorf("got %#v, want the bytes of the UUID", nv.Value)
+	}
+
+	got, err := values.Decode(uuid[:], "uuid")
+	if err != nil || got != uuid {
+		t.Errorf("got %#v, %v, want the UUID", got, err)
+	}
+	if got, err := values.Decode(nil, "UUID"); got != nil || err != nil {
+		t.Errorf("got %#v, %v, NULL should not be decoded", got, err)
+	}
+	if _, err := values.Decode([]byte{1}, "UUID"); err == nil {
+		t.Errorf("expected an error for a short UUID")
+	}
+	// Codecs take precedence over times.
+	if got, _ := values.Decode("2024-01-02", "TIMESTAMP"); got != Decimal("2024-01-02") {
+		t.Errorf("got %#v, want the codec to decode the column", got)
+	}
+	if got, _ := values.Decode("2024-01-02", "DATETIME"); got != time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC) {
+		t.Errorf("got %#v, want a time", got)
+	}
+}
+
+func TestValuesScanType(t *testing.T) {
+	custom := struct{ Codec }{BoolCodec}
+	values := Values{
+		Times:          TimeFormat{DeclTypes: []string{"DATE"}},
+		DeclTypeCodecs: map[string]Codec{"UUID": UUIDCodec, "JSON": JSONCodec, "MONEY": custom},
+	}
+	tests := []struct {
+		declType string
+		want     reflect.Type
+	}{
+		{"uuid", reflect.TypeOf([16]byte{})},
+		{"JSON", reflect.TypeOf(json.RawMessage(nil))},
+		// The type decoded by a codec of the user is unknown.
+		{"MONEY", reflect.TypeOf(new(any)).Elem()},
+		{"date", reflect.TypeOf(time.Time{})},
+		// TIMESTAMP columns are not read as times once other types are set.
+		{"TIMESTAMP", reflect.TypeOf(new(any)).Elem()},
+		{"F32_BLOB(2)", reflect.TypeOf([]float32(nil))},
+		{"INTEGER", reflect.TypeOf(int64(0))},
+		{"", reflect.TypeOf(new(any)).Elem()},
+	}
+	for _, tt := range tests {
+		if got := values.ScanType(tt.declType); got != tt.want {
+			t.Errorf("ScanType(%q) = %v, want %v", tt.declType, got, tt.want)
+		}
+	}
+	var defaults Values
+	if got := defaults.ScanType("DATETIME"); got != reflect.TypeOf(time.Time{}) {
+		t.Errorf("got %v for DATETIME, want time.Time", got)
+	}
+}
+
+func TestValuesVectors(t *testing.T) {
+	var values Values
+	nv := driver.NamedValue{Ordinal: 1, Value: []float32{1, 2}}
+	if err := values.CheckNamedValue(&nv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, err := values.Decode(nv.Value, "F32_BLOB(2)")
+	if err != nil || !reflect.DeepEqual(got, []float32{1, 2}) {
+		t.Errorf("got %#v, %v, want the vector", got, err)
+	}
+	if got, _ := values.Decode(nv.Value, "BLOB"); !reflect.DeepEqual(got, nv.Value) {
+		t.Errorf("got %#v, the blobs of other columns should be left alone", got)
+	}
+	if got, _ := values.Decode(1.5, "FLOAT64(2)"); got != 1.5 {
+		t.Errorf("got %#v, only blobs should be decoded as vectors", got)
+	}
+}
+
+func TestBuiltinCodecs(t *testing.T) {
+	tests := []struct {
+		name    string
+		codec   Codec
+		stored  any
+		decoded any
+		wantErr bool
+	}{
+		{name: "bool", codec: BoolCodec, stored: int64(1), decoded: true},
+		{name: "bool text", codec: BoolCodec, stored: "false", decoded: false},
+		{name: "bool blob", codec: BoolCodec, stored: []byte{1}, wantErr: true},
+		{name: "json text", codec: JSONCodec, stored: `{"a":1}`, decoded: json.RawMessage(`{"a":1}`)},
+		{name: "json integer", codec: JSONCodec, stored: int64(1), wantErr: true},
+		{name: "uuid text", codec: UUIDCodec, stored: "00112233-4455-6677-8899-aabbccddeeff", decoded: [16]byte{
+			0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+		}},
+		{name: "uuid invalid text", codec: UUIDCodec, stored: "not a uuid", wantErr: true},
+		{name: "decimal text", codec: DecimalCodec, stored: "12345678901234567890.123", decoded: Decimal("12345678901234567890.123")},
+		{name: "decimal real", codec: DecimalCodec, stored: 1.5, decoded: Decimal("1.5")},
+		{name: "decimal integer", codec: DecimalCodec, stored: int64(-3), decoded: Decimal("-3")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.codec.Decode(tt.stored)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.decoded) {
+				t.Errorf("Decode() = %#v, want %#v", got, tt.decoded)
+			}
+		})
+	}
+
+	if encoded, err := JSONCodec.Encode(json.RawMessage(`[]`)); encoded != "[]" || err != nil {
+		t.Errorf("got %#v, %v, JSON should be encoded as text", encoded, err)
+	}
+	if encoded, err := DecimalCodec.Encode(Decimal("0.1")); encoded != "0.1" || err != nil {
+		t.Errorf("got %#v, %v, decimals should be encoded as text", encoded, err)
+	}
+}
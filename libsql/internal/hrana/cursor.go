@@ -0,0 +1,215 @@
+package hrana
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type CursorRequest struct {
+	Baton string `json:"baton,omitempty"`
+	Batch *Batch `json:"batch"`
+}
+
+type CursorResponse struct {
+	Baton   string `json:"baton,omitempty"`
+	BaseUrl string `json:"base_url,omitempty"`
+}
+
+// CursorEntry is one item of the stream returned by the cursor endpoint.
+// Type is one of step_begin, step_end, step_error, row and error.
+type CursorEntry struct {
+	Type             string   `json:"type"`
+	Step             uint32   `json:"step,omitempty"`
+	Cols             []Column `json:"cols,omitempty"`
+	Row              []Value  `json:"row,omitempty"`
+	AffectedRowCount uint32   `json:"affected_row_count,omitempty"`
+	LastInsertRowId  *string  `json:"last_insert_rowid,omitempty"`
+	Error            *Error   `json:"error,omitempty"`
+}
+
+func MarshalCursorRequest(e Encoding, msg *CursorRequest) ([]byte, error) {
+	if e == EncodingProtobuf {
+		return msg.MarshalProto()
+	}
+	return json.Marshal(msg)
+}
+
+func (cr *CursorRequest) MarshalProto() ([]byte, error) {
+	w := protoWriter{}
+	if cr.Baton != "" {
+		w.string(1, cr.Baton)
+	}
+	if cr.Batch == nil {
+		return nil, fmt.Errorf("missing batch in cursor request")
+	}
+	if err := w.message(2, cr.Batch.writeProto); err != nil {
+		return nil, err
+	}
+	return w.buf, nil
+}
+
+// CursorReader decodes a cursor response incrementally. JSON cursors are newline-delimited
+// and protobuf cursors are length-delimited, with the CursorResponse first in both cases.
+type CursorReader struct {
+	encoding Encoding
+	reader   *bufio.Reader
+	decoder  *json.Decoder
+}
+
+func NewCursorReader(e Encoding, r io.Reader) *CursorReader {
+	reader := bufio.NewReader(r)
+	cr := &CursorReader{encoding: e, reader: reader}
+	if e == EncodingJSON {
+		cr.decoder = json.NewDecoder(reader)
+	}
+	return cr
+}
+
+func (cr *CursorReader) ReadResponse() (*CursorResponse, error) {
+	var resp CursorResponse
+	if cr.encoding == EncodingJSON {
+		if err := cr.decoder.Decode(&resp); err != nil {
+			return nil, err
+		}
+		return &resp, nil
+	}
+	data, err := cr.readMessage()
+	if err != nil {
+		return nil, err
+	}
+	err = parseProto(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			resp.Baton = f.string()
+		case 2:
+			resp.BaseUrl = f.string()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Next returns the next entry, or io.EOF once the server has sent all of them.
+func (cr *CursorReader) Next() (*CursorEntry, error) {
+	var entry CursorEntry
+	if cr.encoding == EncodingJSON {
+		if err := cr.decoder.Decode(&entry); err != nil {
+			return nil, err
+		}
+		return &entry, nil
+	}
+	data, err := cr.readMessage()
+	if err != nil {
+		return nil, err
+	}
+	if err := entry.UnmarshalProto(data); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (cr *CursorReader) readMessage() ([]byte, error) {
+	size, err := binary.ReadUvarint(cr.reader)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(cr.reader, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (e *CursorEntry) UnmarshalProto(data []byte) error {
+	*e = CursorEntry{}
+	return parseProto(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			e.Type = "step_begin"
+			e.Cols = []Column{}
+			return parseProto(f.bytes, func(f protoField) error {
+				switch f.num {
+				case 1:
+					e.Step = uint32(f.varint)
+				case 2:
+					var col Column
+					err := parseProto(f.bytes, func(f protoField) error {
+						s := f.string()
+						switch f.num {
+						case 1:
+							col.Name = &s
+						case 2:
+							col.Type = &s
+						}
+						return nil
+					})
+					if err != nil {
+						return err
+					}
+					e.Cols = append(e.Cols, col)
+				}
+				return nil
+			})
+		case 2:
+			e.Type = "step_end"
+			return parseProto(f.bytes, func(f protoField) error {
+				switch f.num {
+				case 1:
+					e.AffectedRowCount = uint32(f.varint)
+				case 2:
+					rowId := strconv.FormatInt(protowire.DecodeZigZag(f.varint), 10)
+					e.LastInsertRowId = &rowId
+				}
+				return nil
+			})
+		case 3:
+			e.Type = "step_error"
+			return parseProto(f.bytes, func(f protoField) error {
+				switch f.num {
+				case 1:
+					e.Step = uint32(f.varint)
+				case 2:
+					e.Error = &Error{}
+					return e.Error.UnmarshalProto(f.bytes)
+				}
+				return nil
+			})
+		case 4:
+			e.Type = "row"
+			e.Row = []Value{}
+			return parseProto(f.bytes, func(f protoField) error {
+				if f.num != 1 {
+					return nil
+				}
+				var value Value
+				if err := value.UnmarshalProto(f.bytes); err != nil {
+					return err
+				}
+				e.Row = append(e.Row, value)
+				return nil
+			})
+		case 5:
+			e.Type = "error"
+			return parseProto(f.bytes, func(f protoField) error {
+				if f.num == 1 {
+					e.Error = &Error{}
+					return e.Error.UnmarshalProto(f.bytes)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
@@ -0,0 +1,80 @@
+package hrana
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestCursorReaderProtobuf(t *testing.T) {
+	var body []byte
+	appendMessage := func(fn func(w *protoWriter) error) {
+		w := protoWriter{}
+		if err := fn(&w); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		body = protowire.AppendBytes(body, w.buf)
+	}
+	appendMessage(func(w *protoWriter) error {
+		w.string(1, "baton")
+		return nil
+	})
+	appendMessage(func(w *protoWriter) error {
+		return w.message(1, func(w *protoWriter) error {
+			w.varint(1, 0)
+			return w.message(2, func(w *protoWriter) error {
+				w.string(1, "a")
+				return nil
+			})
+		})
+	})
+	appendMessage(func(w *protoWriter) error {
+		return w.message(4, func(w *protoWriter) error {
+			return w.message(1, Value{Type: "blob", Base64: "YmFy"}.writeProto)
+		})
+	})
+	appendMessage(func(w *protoWriter) error {
+		return w.message(2, func(w *protoWriter) error {
+			w.varint(1, 1)
+			w.sint64(2, -3)
+			return nil
+		})
+	})
+
+	reader := NewCursorReader(EncodingProtobuf, bytes.NewReader(body))
+	resp, err := reader.ReadResponse()
+	if err != nil || resp.Baton != "baton" {
+		t.Fatalf("ReadResponse() = %v, %v", resp, err)
+	}
+	var types []string
+	var values []any
+	var lastInsertRowId string
+	for {
+		entry, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		types = append(types, entry.Type)
+		if entry.LastInsertRowId != nil {
+			lastInsertRowId = *entry.LastInsertRowId
+		}
+		for _, v := range entry.Row {
+			values = append(values, v.ToValue(nil))
+		}
+	}
+	if !reflect.DeepEqual(types, []string{"step_begin", "row", "step_end"}) {
+		t.Errorf("got entries %v", types)
+	}
+	if !reflect.DeepEqual(values, []any{[]byte("bar")}) {
+		t.Errorf("got values %v", values)
+	}
+	if lastInsertRowId != "-3" {
+		t.Errorf("got last insert rowid %q, want -3", lastInsertRowId)
+	}
+}
@@ -0,0 +1,43 @@
+package hrana
+
+import (
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
+)
+
+type DescribeResult struct {
+	Params     []DescribeParam `json:"params"`
+	Cols       []DescribeCol   `json:"cols"`
+	IsExplain  bool            `json:"is_explain"`
+	IsReadonly bool            `json:"is_readonly"`
+}
+
+type DescribeParam struct {
+	Name *string `json:"name"`
+}
+
+type DescribeCol struct {
+	Name string  `json:"name"`
+	Type *string `json:"decltype"`
+}
+
+// Description converts the result into the form shared by the drivers.
+func (r *DescribeResult) Description() *shared.StmtDescription {
+	desc := &shared.StmtDescription{
+		Params:     make([]string, len(r.Params)),
+		Columns:    make([]shared.ColumnDescription, len(r.Cols)),
+		IsExplain:  r.IsExplain,
+		IsReadOnly: r.IsReadonly,
+	}
+	for i, param := range r.Params {
+		if param.Name != nil {
+			desc.Params[i] = *param.Name
+		}
+	}
+	for i, col := range r.Cols {
+		desc.Columns[i].Name = col.Name
+		if col.Type != nil {
+			desc.Columns[i].DeclType = *col.Type
+		}
+	}
+	return desc
+}
@@ -0,0 +1,41 @@
+package hrana
+
+import (
+	"encoding/json"
+)
+
+// Encoding selects how pipeline requests and responses are serialized on the wire.
+type Encoding int
+
+const (
+	EncodingJSON Encoding = iota
+	EncodingProtobuf
+)
+
+func (e Encoding) ContentType() string {
+	if e == EncodingProtobuf {
+		return "application/x-protobuf"
+	}
+	return "application/json"
+}
+
+func MarshalPipelineRequest(e Encoding, msg *PipelineRequest) ([]byte, error) {
+	if e == EncodingProtobuf {
+		return msg.MarshalProto()
+	}
+	return json.Marshal(msg)
+}
+
+func UnmarshalPipelineResponse(e Encoding, data []byte, msg *PipelineResponse) error {
+	if e == EncodingProtobuf {
+		return msg.UnmarshalProto(data)
+	}
+	return json.Unmarshal(data, msg)
+}
+
+func UnmarshalError(e Encoding, data []byte, msg *Error) error {
+	if e == EncodingProtobuf {
+		return msg.UnmarshalProto(data)
+	}
+	return json.Unmarshal(data, msg)
+}
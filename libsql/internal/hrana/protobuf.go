@@ -0,0 +1,731 @@
+package hrana
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages below follow the Hrana 3 protobuf schema. Field numbers must match the server.
+
+type protoWriter struct {
+	buf []byte
+}
+
+func (w *protoWriter) string(num protowire.Number, s string) {
+	w.buf = protowire.AppendTag(w.buf, num, protowire.BytesType)
+	w.buf = protowire.AppendString(w.buf, s)
+}
+
+func (w *protoWriter) bytes(num protowire.Number, b []byte) {
+	w.buf = protowire.AppendTag(w.buf, num, protowire.BytesType)
+	w.buf = protowire.AppendBytes(w.buf, b)
+}
+
+func (w *protoWriter) varint(num protowire.Number, v uint64) {
+	w.buf = protowire.AppendTag(w.buf, num, protowire.VarintType)
+	w.buf = protowire.AppendVarint(w.buf, v)
+}
+
+func (w *protoWriter) bool(num protowire.Number, b bool) {
+	w.varint(num, protowire.EncodeBool(b))
+}
+
+func (w *protoWriter) int32(num protowire.Number, v int32) {
+	w.varint(num, uint64(int64(v)))
+}
+
+func (w *protoWriter) sint64(num protowire.Number, v int64) {
+	w.varint(num, protowire.EncodeZigZag(v))
+}
+
+func (w *protoWriter) double(num protowire.Number, f float64) {
+	w.buf = protowire.AppendTag(w.buf, num, protowire.Fixed64Type)
+	w.buf = protowire.AppendFixed64(w.buf, math.Float64bits(f))
+}
+
+func (w *protoWriter) message(num protowire.Number, fn func(w *protoWriter) error) error {
+	inner := protoWriter{}
+	if err := fn(&inner); err != nil {
+		return err
+	}
+	w.bytes(num, inner.buf)
+	return nil
+}
+
+type protoField struct {
+	num    protowire.Number
+	typ    protowire.Type
+	varint uint64
+	fixed  uint64
+	bytes  []byte
+}
+
+func (f protoField) string() string {
+	return string(f.bytes)
+}
+
+func (f protoField) double() float64 {
+	return math.Float64frombits(f.fixed)
+}
+
+func parseProto(data []byte, fn func(f protoField) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		f := protoField{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			f.fixed, n = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(data)
+			f.fixed = uint64(v)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v Value) MarshalProto() ([]byte, error) {
+	w := protoWriter{}
+	err := v.writeProto(&w)
+	return w.buf, err
+}
+
+func (v Value) writeProto(w *protoWriter) error {
+	switch v.Type {
+	case "null":
+		w.bytes(1, nil)
+	case "integer":
+		integer, err := v.integer()
+		if err != nil {
+			return err
+		}
+		w.sint64(2, integer)
+	case "float":
+		float, ok := v.Value.(float64)
+		if !ok {
+			return fmt.Errorf("invalid float value: %v", v.Value)
+		}
+		w.double(3, float)
+	case "text":
+		text, ok := v.Value.(string)
+		if !ok {
+			return fmt.Errorf("invalid text value: %v", v.Value)
+		}
+		w.string(4, text)
+	case "blob":
+		blob, err := v.blobBytes()
+		if err != nil {
+			return err
+		}
+		w.bytes(5, blob)
+	default:
+		return fmt.Errorf("unsupported value type: %s", v.Type)
+	}
+	return nil
+}
+
+func (v *Value) UnmarshalProto(data []byte) error {
+	*v = Value{}
+	return parseProto(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			*v = Value{Type: "null"}
+		case 2:
+			*v = Value{Type: "integer", Value: protowire.DecodeZigZag(f.varint)}
+		case 3:
+			*v = Value{Type: "float", Value: f.double()}
+		case 4:
+			*v = Value{Type: "text", Value: f.string()}
+		case 5:
+			blob := f.bytes
+			if blob == nil {
+				blob = []byte{}
+			}
+			*v = Value{Type: "blob", Value: blob}
+		}
+		return nil
+	})
+}
+
+func (s *Stmt) MarshalProto() ([]byte, error) {
+	w := protoWriter{}
+	err := s.writeProto(&w)
+	return w.buf, err
+}
+
+func (s *Stmt) writeProto(w *protoWriter) error {
+	if s.Sql != nil {
+		w.string(1, *s.Sql)
+	}
+	if s.SqlId != nil {
+		w.int32(2, *s.SqlId)
+	}
+	for _, arg := range s.Args {
+		if err := w.message(3, arg.writeProto); err != nil {
+			return err
+		}
+	}
+	for _, arg := range s.NamedArgs {
+		arg := arg
+		err := w.message(4, func(w *protoWriter) error {
+			w.string(1, arg.Name)
+			return w.message(2, arg.Value.writeProto)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w.bool(5, s.WantRows)
+	if s.ReplicationIndex != nil {
+		w.varint(6, *s.ReplicationIndex)
+	}
+	return nil
+}
+
+func (s *Stmt) UnmarshalProto(data []byte) error {
+	*s = Stmt{}
+	return parseProto(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			sql := f.string()
+			s.Sql = &sql
+		case 2:
+			sqlId := int32(f.varint)
+			s.SqlId = &sqlId
+		case 3:
+			var arg Value
+			if err := arg.UnmarshalProto(f.bytes); err != nil {
+				return err
+			}
+			s.Args = append(s.Args, arg)
+		case 4:
+			var arg NamedArg
+			err := parseProto(f.bytes, func(f protoField) error {
+				switch f.num {
+				case 1:
+					arg.Name = f.string()
+				case 2:
+					return arg.Value.UnmarshalProto(f.bytes)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			s.NamedArgs = append(s.NamedArgs, arg)
+		case 5:
+			s.WantRows = protowire.DecodeBool(f.varint)
+		case 6:
+			replicationIndex := f.varint
+			s.ReplicationIndex = &replicationIndex
+		}
+		return nil
+	})
+}
+
+func (b *Batch) MarshalProto() ([]byte, error) {
+	w := protoWriter{}
+	err := b.writeProto(&w)
+	return w.buf, err
+}
+
+func (b *Batch) writeProto(w *protoWriter) error {
+	for _, step := range b.Steps {
+		step := step
+		err := w.message(1, func(w *protoWriter) error {
+			if step.Condition != nil {
+				if err := w.message(1, step.Condition.writeProto); err != nil {
+					return err
+				}
+			}
+			return w.message(2, step.Stmt.writeProto)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if b.ReplicationIndex != nil {
+		w.varint(2, *b.ReplicationIndex)
+	}
+	return nil
+}
+
+func (b *Batch) UnmarshalProto(data []byte) error {
+	*b = Batch{}
+	return parseProto(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			var step BatchStep
+			err := parseProto(f.bytes, func(f protoField) error {
+				switch f.num {
+				case 1:
+					step.Condition = &BatchCondition{}
+					return step.Condition.unmarshalProto(f.bytes)
+				case 2:
+					return step.Stmt.UnmarshalProto(f.bytes)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			b.Steps = append(b.Steps, step)
+		case 2:
+			replicationIndex := f.varint
+			b.ReplicationIndex = &replicationIndex
+		}
+		return nil
+	})
+}
+
+func (c *BatchCondition) writeProto(w *protoWriter) error {
+	writeConds := func(w *protoWriter) error {
+		for i := range c.Conds {
+			if err := w.message(1, c.Conds[i].writeProto); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	switch c.Type {
+	case "ok", "error":
+		if c.Step == nil {
+			return fmt.Errorf("missing step in %s condition", c.Type)
+		}
+		num := protowire.Number(1)
+		if c.Type == "error" {
+			num = 2
+		}
+		w.varint(num, uint64(uint32(*c.Step)))
+	case "not":
+		if c.Cond == nil {
+			return fmt.Errorf("missing cond in not condition")
+		}
+		return w.message(3, c.Cond.writeProto)
+	case "and":
+		return w.message(4, writeConds)
+	case "or":
+		return w.message(5, writeConds)
+	case "is_autocommit":
+		w.bytes(6, nil)
+	default:
+		return fmt.Errorf("unsupported batch condition type: %s", c.Type)
+	}
+	return nil
+}
+
+func (c *BatchCondition) unmarshalProto(data []byte) error {
+	readConds := func(data []byte) error {
+		c.Conds = []BatchCondition{}
+		return parseProto(data, func(f protoField) error {
+			if f.num != 1 {
+				return nil
+			}
+			var cond BatchCondition
+			if err := cond.unmarshalProto(f.bytes); err != nil {
+				return err
+			}
+			c.Conds = append(c.Conds, cond)
+			return nil
+		})
+	}
+	return parseProto(data, func(f protoField) error {
+		switch f.num {
+		case 1, 2:
+			step := int32(f.varint)
+			c.Type = "ok"
+			if f.num == 2 {
+				c.Type = "error"
+			}
+			c.Step = &step
+		case 3:
+			c.Type = "not"
+			c.Cond = &BatchCondition{}
+			return c.Cond.unmarshalProto(f.bytes)
+		case 4:
+			c.Type = "and"
+			return readConds(f.bytes)
+		case 5:
+			c.Type = "or"
+			return readConds(f.bytes)
+		case 6:
+			c.Type = "is_autocommit"
+		}
+		return nil
+	})
+}
+
+func (r *StmtResult) MarshalProto() ([]byte, error) {
+	w := protoWriter{}
+	err := r.writeProto(&w)
+	return w.buf, err
+}
+
+func (r *StmtResult) writeProto(w *protoWriter) error {
+	for _, col := range r.Cols {
+		col := col
+		_ = w.message(1, func(w *protoWriter) error {
+			if col.Name != nil {
+				w.string(1, *col.Name)
+			}
+			if col.Type != nil {
+				w.string(2, *col.Type)
+			}
+			return nil
+		})
+	}
+	for _, row := range r.Rows {
+		row := row
+		err := w.message(2, func(w *protoWriter) error {
+			for _, value := range row {
+				if err := w.message(1, value.writeProto); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w.varint(3, uint64(r.AffectedRowCount))
+	if r.LastInsertRowId != nil {
+		rowId, err := strconv.ParseInt(*r.LastInsertRowId, 10, 64)
+		if err != nil {
+			return err
+		}
+		w.sint64(4, rowId)
+	}
+	if r.ReplicationIndex != nil {
+		w.varint(5, *r.ReplicationIndex)
+	}
+	w.varint(6, r.RowsRead)
+	w.varint(7, r.RowsWritten)
+	w.double(8, r.QueryDurationMs)
+	return nil
+}
+
+func (r *StmtResult) UnmarshalProto(data []byte) error {
+	*r = StmtResult{Cols: []Column{}, Rows: [][]Value{}}
+	return parseProto(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			var col Column
+			err := parseProto(f.bytes, func(f protoField) error {
+				s := f.string()
+				switch f.num {
+				case 1:
+					col.Name = &s
+				case 2:
+					col.Type = &s
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			r.Cols = append(r.Cols, col)
+		case 2:
+			row := []Value{}
+			err := parseProto(f.bytes, func(f protoField) error {
+				if f.num != 1 {
+					return nil
+				}
+				var value Value
+				if err := value.UnmarshalProto(f.bytes); err != nil {
+					return err
+				}
+				row = append(row, value)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			r.Rows = append(r.Rows, row)
+		case 3:
+			r.AffectedRowCount = int32(f.varint)
+		case 4:
+			rowId := strconv.FormatInt(protowire.DecodeZigZag(f.varint), 10)
+			r.LastInsertRowId = &rowId
+		case 5:
+			replicationIndex := f.varint
+			r.ReplicationIndex = &replicationIndex
+		case 6:
+			r.RowsRead = f.varint
+		case 7:
+			r.RowsWritten = f.varint
+		case 8:
+			r.QueryDurationMs = f.double()
+		}
+		return nil
+	})
+}
+
+// maxBatchSteps bounds the step indexes accepted in batch results, which size the slices of
+// the result.
+const maxBatchSteps = 1 << 20
+
+func (b *BatchResult) UnmarshalProto(data []byte) error {
+	*b = BatchResult{StepResults: []*StmtResult{}, StepErrors: []*Error{}}
+	grow := func(step uint32) error {
+		if step >= maxBatchSteps {
+			return fmt.Errorf("invalid step %d in batch result", step)
+		}
+		for uint32(len(b.StepResults)) <= step {
+			b.StepResults = append(b.StepResults, nil)
+			b.StepErrors = append(b.StepErrors, nil)
+		}
+		return nil
+	}
+	return parseProto(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			var step uint32
+			result := &StmtResult{}
+			err := parseProto(f.bytes, func(f protoField) error {
+				switch f.num {
+				case 1:
+					step = uint32(f.varint)
+				case 2:
+					return result.UnmarshalProto(f.bytes)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if err := grow(step); err != nil {
+				return err
+			}
+			b.StepResults[step] = result
+		case 2:
+			var step uint32
+			stepError := &Error{}
+			err := parseProto(f.bytes, func(f protoField) error {
+				switch f.num {
+				case 1:
+					step = uint32(f.varint)
+				case 2:
+					return stepError.UnmarshalProto(f.bytes)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if err := grow(step); err != nil {
+				return err
+			}
+			b.StepErrors[step] = stepError
+		case 3:
+			replicationIndex := f.varint
+			b.ReplicationIndex = &replicationIndex
+		}
+		return nil
+	})
+}
+
+func (r *DescribeResult) UnmarshalProto(data []byte) error {
+	*r = DescribeResult{Params: []DescribeParam{}, Cols: []DescribeCol{}}
+	return parseProto(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			var param DescribeParam
+			err := parseProto(f.bytes, func(f protoField) error {
+				if f.num == 1 {
+					name := f.string()
+					param.Name = &name
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			r.Params = append(r.Params, param)
+		case 2:
+			var col DescribeCol
+			err := parseProto(f.bytes, func(f protoField) error {
+				switch f.num {
+				case 1:
+					col.Name = f.string()
+				case 2:
+					decltype := f.string()
+					col.Type = &decltype
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			r.Cols = append(r.Cols, col)
+		case 3:
+			r.IsExplain = protowire.DecodeBool(f.varint)
+		case 4:
+			r.IsReadonly = protowire.DecodeBool(f.varint)
+		}
+		return nil
+	})
+}
+
+func (e *Error) UnmarshalProto(data []byte) error {
+	*e = Error{}
+	return parseProto(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			e.Message = f.string()
+		case 2:
+			code := f.string()
+			e.Code = &code
+		}
+		return nil
+	})
+}
+
+var streamRequestProtoFields = map[string]protowire.Number{
+	"close":          1,
+	"execute":        2,
+	"batch":          3,
+	"sequence":       4,
+	"describe":       5,
+	"store_sql":      6,
+	"close_sql":      7,
+	"get_autocommit": 8,
+}
+
+func (r *StreamRequest) writeProto(w *protoWriter) error {
+	num, ok := streamRequestProtoFields[r.Type]
+	if !ok {
+		return fmt.Errorf("unsupported stream request type: %s", r.Type)
+	}
+	return w.message(num, func(w *protoWriter) error {
+		switch r.Type {
+		case "execute":
+			if r.Stmt == nil {
+				return fmt.Errorf("missing stmt in execute request")
+			}
+			return w.message(1, r.Stmt.writeProto)
+		case "batch":
+			if r.Batch == nil {
+				return fmt.Errorf("missing batch in batch request")
+			}
+			return w.message(1, r.Batch.writeProto)
+		case "sequence", "describe":
+			if r.Sql != nil {
+				w.string(1, *r.Sql)
+			}
+			if r.SqlId != nil {
+				w.int32(2, *r.SqlId)
+			}
+		case "store_sql":
+			if r.SqlId == nil || r.Sql == nil {
+				return fmt.Errorf("missing sql or sql_id in store_sql request")
+			}
+			w.int32(1, *r.SqlId)
+			w.string(2, *r.Sql)
+		case "close_sql":
+			if r.SqlId == nil {
+				return fmt.Errorf("missing sql_id in close_sql request")
+			}
+			w.int32(1, *r.SqlId)
+		}
+		return nil
+	})
+}
+
+func (pr *PipelineRequest) MarshalProto() ([]byte, error) {
+	w := protoWriter{}
+	if pr.Baton != "" {
+		w.string(1, pr.Baton)
+	}
+	for i := range pr.Requests {
+		if err := w.message(2, pr.Requests[i].writeProto); err != nil {
+			return nil, err
+		}
+	}
+	return w.buf, nil
+}
+
+func (r *StreamResponse) unmarshalProto(data []byte) error {
+	*r = StreamResponse{}
+	return parseProto(data, func(f protoField) error {
+		var typ string
+		for name, num := range streamRequestProtoFields {
+			if num == f.num {
+				typ = name
+			}
+		}
+		if typ == "" {
+			return nil
+		}
+		r.Type = typ
+		return parseProto(f.bytes, func(f protoField) error {
+			switch {
+			case typ == "execute" && f.num == 1:
+				r.stmtResult = &StmtResult{}
+				return r.stmtResult.UnmarshalProto(f.bytes)
+			case typ == "batch" && f.num == 1:
+				r.batchResult = &BatchResult{}
+				return r.batchResult.UnmarshalProto(f.bytes)
+			case typ == "describe" && f.num == 1:
+				r.describeResult = &DescribeResult{}
+				return r.describeResult.UnmarshalProto(f.bytes)
+			case typ == "get_autocommit" && f.num == 1:
+				isAutocommit := protowire.DecodeBool(f.varint)
+				r.IsAutocommit = &isAutocommit
+			}
+			return nil
+		})
+	})
+}
+
+func (pr *PipelineResponse) UnmarshalProto(data []byte) error {
+	*pr = PipelineResponse{Results: []StreamResult{}}
+	return parseProto(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			pr.Baton = f.string()
+		case 2:
+			pr.BaseUrl = f.string()
+		case 3:
+			var result StreamResult
+			err := parseProto(f.bytes, func(f protoField) error {
+				switch f.num {
+				case 1:
+					result.Type = "ok"
+					result.Response = &StreamResponse{}
+					return result.Response.unmarshalProto(f.bytes)
+				case 2:
+					result.Type = "error"
+					result.Error = &Error{}
+					return result.Error.UnmarshalProto(f.bytes)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			pr.Results = append(pr.Results, result)
+		}
+		return nil
+	})
+}
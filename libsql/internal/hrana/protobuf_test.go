@@ -0,0 +1,226 @@
+package hrana
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type protoMessage interface {
+	MarshalProto() ([]byte, error)
+	UnmarshalProto(data []byte) error
+}
+
+// assertProtoRoundTrip decodes jsonData into two messages, passes one of them through
+// the protobuf codec and checks that both still produce the same JSON.
+func assertProtoRoundTrip(t *testing.T, jsonData string, newMessage func() protoMessage) {
+	original := newMessage()
+	if err := json.Unmarshal([]byte(jsonData), original); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	data, err := original.MarshalProto()
+	if err != nil {
+		t.Fatalf("MarshalProto() error = %v", err)
+	}
+	decoded := newMessage()
+	if err := decoded.UnmarshalProto(data); err != nil {
+		t.Fatalf("UnmarshalProto() error = %v", err)
+	}
+	want, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	got, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("got = %s, want %s", got, want)
+	}
+}
+
+func TestValueProtoRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		marshaled string
+		want      any
+	}{
+		{name: "null", marshaled: `{"type":"null"}`, want: nil},
+		{name: "int", marshaled: `{"type":"integer","value":"42"}`, want: int64(42)},
+		{name: "negative int", marshaled: `{"type":"integer","value":"-9223372036854775808"}`, want: int64(-9223372036854775808)},
+		{name: "string", marshaled: `{"type":"text","value":"foo"}`, want: "foo"},
+		{name: "empty string", marshaled: `{"type":"text","value":""}`, want: ""},
+		{name: "bytes", marshaled: `{"type":"blob","base64":"YmFy"}`, want: []byte("bar")},
+		{name: "float", marshaled: `{"type":"float","value":3.14}`, want: 3.14},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertProtoRoundTrip(t, tt.marshaled, func() protoMessage { return &Value{} })
+
+			var original Value
+			if err := json.Unmarshal([]byte(tt.marshaled), &original); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			data, err := original.MarshalProto()
+			if err != nil {
+				t.Fatalf("MarshalProto() error = %v", err)
+			}
+			var decoded Value
+			if err := decoded.UnmarshalProto(data); err != nil {
+				t.Fatalf("UnmarshalProto() error = %v", err)
+			}
+			if got := decoded.ToValue(nil); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ToValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStmtProtoRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		marshaled string
+	}{
+		{
+			name:      "positional args",
+			marshaled: `{"sql":"SELECT ?, ?","args":[{"type":"integer","value":"1"},{"type":"blob","base64":"YmFy"}],"want_rows":true}`,
+		},
+		{
+			name:      "named args",
+			marshaled: `{"sql":"SELECT :a","named_args":[{"name":":a","value":{"type":"text","value":"foo"}}],"want_rows":false}`,
+		},
+		{
+			name:      "stored sql",
+			marshaled: `{"sql_id":7,"want_rows":true,"replication_index":12}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertProtoRoundTrip(t, tt.marshaled, func() protoMessage { return &Stmt{} })
+		})
+	}
+}
+
+func TestBatchProtoRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		marshaled string
+	}{
+		{
+			name:      "unconditional",
+			marshaled: `{"steps":[{"stmt":{"sql":"BEGIN","want_rows":false}},{"stmt":{"sql":"SELECT 1","want_rows":true}}]}`,
+		},
+		{
+			name: "conditions",
+			marshaled: `{"steps":[` +
+				`{"stmt":{"sql":"BEGIN","want_rows":false}},` +
+				`{"stmt":{"sql":"INSERT","want_rows":false},"condition":{"type":"ok","step":0}},` +
+				`{"stmt":{"sql":"COMMIT","want_rows":false},"condition":{"type":"and","conds":[{"type":"ok","step":1},{"type":"not","cond":{"type":"is_autocommit"}}]}},` +
+				`{"stmt":{"sql":"ROLLBACK","want_rows":false},"condition":{"type":"or","conds":[{"type":"error","step":1},{"type":"error","step":2}]}}` +
+				`]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertProtoRoundTrip(t, tt.marshaled, func() protoMessage { return &Batch{} })
+		})
+	}
+}
+
+func TestStmtResultProtoRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		marshaled string
+	}{
+		{
+			name:      "empty",
+			marshaled: `{"cols":[],"rows":[],"affected_row_count":0,"last_insert_rowid":null,"replication_index":null}`,
+		},
+		{
+			name: "rows",
+			marshaled: `{"cols":[{"name":"a","decltype":"INTEGER"},{"name":"b","decltype":null}],` +
+				`"rows":[[{"type":"integer","value":"1"},{"type":"blob","base64":"YmFy"}],[{"type":"null"},{"type":"float","value":0.5}]],` +
+				`"affected_row_count":2,"last_insert_rowid":"-3","replication_index":"5",` +
+				`"rows_read":10,"rows_written":2,"query_duration_ms":1.25}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertProtoRoundTrip(t, tt.marshaled, func() protoMessage { return &StmtResult{} })
+		})
+	}
+}
+
+func TestPipelineProtoEncoding(t *testing.T) {
+	request := PipelineRequest{Baton: "baton"}
+	executeStream := StreamRequest{Type: "execute", Stmt: &Stmt{Sql: stringPtr("SELECT 1"), WantRows: true}}
+	request.Add(executeStream)
+	request.Add(GetAutocommitStream())
+	request.Add(CloseStream())
+	if _, err := MarshalPipelineRequest(EncodingProtobuf, &request); err != nil {
+		t.Fatalf("MarshalPipelineRequest() error = %v", err)
+	}
+
+	stmtResult := &StmtResult{Cols: []Column{{Name: stringPtr("a")}}, Rows: [][]Value{{{Type: "integer", Value: "1"}}}}
+	w := protoWriter{}
+	w.string(1, "next-baton")
+	_ = w.message(3, func(w *protoWriter) error {
+		return w.message(1, func(w *protoWriter) error {
+			return w.message(2, func(w *protoWriter) error {
+				return w.message(1, stmtResult.writeProto)
+			})
+		})
+	})
+	_ = w.message(3, func(w *protoWriter) error {
+		return w.message(1, func(w *protoWriter) error {
+			return w.message(8, func(w *protoWriter) error {
+				w.bool(1, true)
+				return nil
+			})
+		})
+	})
+	_ = w.message(3, func(w *protoWriter) error {
+		return w.message(2, func(w *protoWriter) error {
+			w.string(1, "stream not found")
+			w.string(2, "STREAM_EXPIRED")
+			return nil
+		})
+	})
+
+	var response PipelineResponse
+	if err := UnmarshalPipelineResponse(EncodingProtobuf, w.buf, &response); err != nil {
+		t.Fatalf("UnmarshalPipelineResponse() error = %v", err)
+	}
+	if response.Baton != "next-baton" || len(response.Results) != 3 {
+		t.Fatalf("unexpected response %+v", response)
+	}
+	res, err := response.Results[0].Response.ExecuteResult()
+	if err != nil {
+		t.Fatalf("ExecuteResult() error = %v", err)
+	}
+	if got := res.Rows[0][0].ToValue(nil); got != int64(1) {
+		t.Errorf("got = %v, want 1", got)
+	}
+	if autocommit, err := response.Results[1].Response.GetAutocommit(); err != nil || !autocommit {
+		t.Errorf("GetAutocommit() = %v, %v, want true", autocommit, err)
+	}
+	if response.Results[2].Error == nil || *response.Results[2].Error.Code != "STREAM_EXPIRED" {
+		t.Errorf("unexpected error result %+v", response.Results[2])
+	}
+}
+
+func TestBatchResultProtoInvalidStep(t *testing.T) {
+	w := protoWriter{}
+	_ = w.message(1, func(w *protoWriter) error {
+		w.varint(1, 1<<31)
+		return w.message(2, (&StmtResult{}).writeProto)
+	})
+	var result BatchResult
+	if err := result.UnmarshalProto(w.buf); err == nil {
+		t.Errorf("expected an error for a step out of range, got %d step results", len(result.StepResults))
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
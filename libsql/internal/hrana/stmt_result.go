@@ -11,12 +11,27 @@ type Column struct {
 	Type *string `json:"decltype"`
 }
 
+// DeclTypes returns the declared types of cols, which are empty for expressions.
+func DeclTypes(cols []Column) []string {
+	res := make([]string, len(cols))
+	for i, c := range cols {
+		if c.Type != nil {
+			res[i] = *c.Type
+		}
+	}
+	return res
+}
+
 type StmtResult struct {
 	Cols             []Column  `json:"cols"`
 	Rows             [][]Value `json:"rows"`
 	AffectedRowCount int32     `json:"affected_row_count"`
 	LastInsertRowId  *string   `json:"last_insert_rowid"`
 	ReplicationIndex *uint64   `json:"replication_index"`
+	// RowsRead, RowsWritten and QueryDurationMs are only reported by Hrana 3 servers.
+	RowsRead        uint64  `json:"rows_read"`
+	RowsWritten     uint64  `json:"rows_written"`
+	QueryDurationMs float64 `json:"query_duration_ms"`
 }
 
 func (r *StmtResult) GetLastInsertRowId() int64 {
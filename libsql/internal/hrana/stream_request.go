@@ -54,6 +54,25 @@ func BatchStream(sqls []string, params []shared.Params, wantRows bool) (*StreamR
 	return &StreamRequest{Type: "batch", Batch: batch}, nil
 }
 
+// ScriptBatch returns a batch that executes the statements of script one after the other and
+// stops at the first failed one, like a sequence request. It is used with servers that don't
+// understand sequence requests. The statements are returned along with the batch.
+func ScriptBatch(script string) (*Batch, []string, error) {
+	stmts, params, err := shared.ParseStatementAndArgs(script, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := BatchStream(stmts, params, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := 1; i < len(req.Batch.Steps); i++ {
+		prev := int32(i - 1)
+		req.Batch.Steps[i].Condition = &BatchCondition{Type: "ok", Step: &prev}
+	}
+	return req.Batch, stmts, nil
+}
+
 func StoreSqlStream(sql string, sqlId int32) StreamRequest {
 	return StreamRequest{Type: "store_sql", Sql: &sql, SqlId: &sqlId}
 }
@@ -61,3 +80,17 @@ func StoreSqlStream(sql string, sqlId int32) StreamRequest {
 func CloseStoredSqlStream(sqlId int32) StreamRequest {
 	return StreamRequest{Type: "close_sql", SqlId: &sqlId}
 }
+
+// GetAutocommitStream is only understood by servers speaking Hrana 3.
+
+func SequenceStream(sql string) StreamRequest {
+	return StreamRequest{Type: "sequence", Sql: &sql}
+}
+
+func DescribeStream(sql string) StreamRequest {
+	return StreamRequest{Type: "describe", Sql: &sql}
+}
+
+func GetAutocommitStream() StreamRequest {
+	return StreamRequest{Type: "get_autocommit"}
+}
@@ -0,0 +1,24 @@
+package hrana
+
+import (
+	"testing"
+)
+
+func TestScriptBatch(t *testing.T) {
+	batch, stmts, err := ScriptBatch("CREATE TABLE t (a); INSERT INTO t VALUES (1); SELECT * FROM t")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stmts) != 3 || len(batch.Steps) != 3 {
+		t.Fatalf("got %d statements and %d steps, want 3", len(stmts), len(batch.Steps))
+	}
+	if batch.Steps[0].Condition != nil {
+		t.Errorf("the first step should be unconditional")
+	}
+	for i, step := range batch.Steps[1:] {
+		cond := step.Condition
+		if cond == nil || cond.Type != "ok" || *cond.Step != int32(i) {
+			t.Errorf("step %d should only run if step %d succeeded, got %+v", i+1, i, cond)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
 )
 
 type StreamResult struct {
@@ -13,14 +15,23 @@ type StreamResult struct {
 }
 
 type StreamResponse struct {
-	Type   string          `json:"type"`
-	Result json.RawMessage `json:"result,omitempty"`
+	Type         string          `json:"type"`
+	Result       json.RawMessage `json:"result,omitempty"`
+	IsAutocommit *bool           `json:"is_autocommit,omitempty"`
+
+	// Responses decoded from protobuf carry their results already parsed.
+	stmtResult     *StmtResult
+	batchResult    *BatchResult
+	describeResult *DescribeResult
 }
 
 func (r *StreamResponse) ExecuteResult() (*StmtResult, error) {
 	if r.Type != "execute" {
 		return nil, fmt.Errorf("invalid response type: %s", r.Type)
 	}
+	if r.stmtResult != nil {
+		return r.stmtResult, nil
+	}
 
 	var res StmtResult
 	if err := json.Unmarshal(r.Result, &res); err != nil {
@@ -30,23 +41,81 @@ func (r *StreamResponse) ExecuteResult() (*StmtResult, error) {
 }
 
 func (r *StreamResponse) BatchResult() (*BatchResult, error) {
+	res, err := r.BatchResultWithErrors()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range res.StepErrors {
+		if e != nil {
+			return nil, errors.New(e.Message)
+		}
+	}
+	return res, nil
+}
+
+// BatchResultWithErrors is like BatchResult, but leaves the errors of failed steps in the result.
+func (r *StreamResponse) BatchResultWithErrors() (*BatchResult, error) {
 	if r.Type != "batch" {
 		return nil, fmt.Errorf("invalid response type: %s", r.Type)
 	}
 
 	var res BatchResult
-	if err := json.Unmarshal(r.Result, &res); err != nil {
+	if r.batchResult != nil {
+		res = *r.batchResult
+	} else if err := json.Unmarshal(r.Result, &res); err != nil {
 		return nil, err
 	}
-	for _, e := range res.StepErrors {
-		if e != nil {
-			return nil, errors.New(e.Message)
-		}
+	return &res, nil
+}
+
+// NewExecuteResponse returns the response to an execute request with the given result.
+func NewExecuteResponse(result *StmtResult) *StreamResponse {
+	return &StreamResponse{Type: "execute", stmtResult: result}
+}
+
+// NewBatchResponse returns the response to a batch request with the given result.
+func NewBatchResponse(result *BatchResult) *StreamResponse {
+	return &StreamResponse{Type: "batch", batchResult: result}
+}
+
+func (r *StreamResponse) DescribeResult() (*DescribeResult, error) {
+	if r.Type != "describe" {
+		return nil, fmt.Errorf("invalid response type: %s", r.Type)
+	}
+	if r.describeResult != nil {
+		return r.describeResult, nil
+	}
+
+	var res DescribeResult
+	if err := json.Unmarshal(r.Result, &res); err != nil {
+		return nil, err
 	}
 	return &res, nil
 }
 
+func (r *StreamResponse) GetAutocommit() (bool, error) {
+	if r.Type != "get_autocommit" {
+		return false, fmt.Errorf("invalid response type: %s", r.Type)
+	}
+	if r.IsAutocommit == nil {
+		return false, fmt.Errorf("missing is_autocommit in get_autocommit response")
+	}
+	return *r.IsAutocommit, nil
+}
+
 type Error struct {
 	Message string  `json:"message"`
 	Code    *string `json:"code,omitempty"`
 }
+
+// ToError converts the error of a statement into a *shared.Error. step is -1 outside of batches.
+func (e *Error) ToError(sql string, step int) *shared.Error {
+	code := ""
+	if e.Code != nil {
+		code = *e.Code
+	}
+	err := shared.NewError(code, e.Message)
+	err.SQL = sql
+	err.Step = step
+	return err
+}
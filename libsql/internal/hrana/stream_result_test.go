@@ -0,0 +1,77 @@
+package hrana
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestStreamResponse_DescribeResult(t *testing.T) {
+	var response StreamResponse
+	data := `{"type":"describe","result":{"params":[{"name":":id"},{"name":null}],"cols":[{"name":"a","decltype":"INTEGER"}],"is_explain":false,"is_readonly":true}}`
+	if err := json.Unmarshal([]byte(data), &response); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, err := response.DescribeResult()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	name := ":id"
+	decltype := "INTEGER"
+	want := &DescribeResult{
+		Params:     []DescribeParam{{Name: &name}, {Name: nil}},
+		Cols:       []DescribeCol{{Name: "a", Type: &decltype}},
+		IsReadonly: true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v, want %v", got, want)
+	}
+	if _, err := response.ExecuteResult(); err == nil {
+		t.Errorf("ExecuteResult() should fail for a describe response")
+	}
+}
+
+func TestStreamResponse_GetAutocommit(t *testing.T) {
+	testCases := []struct {
+		name    string
+		data    string
+		want    bool
+		wantErr bool
+	}{
+		{
+			name: "autocommit",
+			data: `{"type":"get_autocommit","is_autocommit":true}`,
+			want: true,
+		},
+		{
+			name: "in transaction",
+			data: `{"type":"get_autocommit","is_autocommit":false}`,
+			want: false,
+		},
+		{
+			name:    "missing field",
+			data:    `{"type":"get_autocommit"}`,
+			wantErr: true,
+		},
+		{
+			name:    "wrong type",
+			data:    `{"type":"close"}`,
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var response StreamResponse
+			if err := json.Unmarshal([]byte(tc.data), &response); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			got, err := response.GetAutocommit()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("GetAutocommit() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("got = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package hrana
+
+import (
+	"math"
+	"time"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
+)
+
+// TimeEncoding selects how a time is stored in the database.
+type TimeEncoding int
+
+const (
+	// TimeText stores times as text, in the layout of the TimeFormat.
+	TimeText TimeEncoding = iota
+	// TimeUnixSeconds stores times as the number of seconds since the Unix epoch.
+	TimeUnixSeconds
+	// TimeUnixMillis stores times as the number of milliseconds since the Unix epoch.
+	TimeUnixMillis
+	// TimeJulianDay stores times as a real number of days since noon in Greenwich on
+	// November 24, 4714 B.C., like the julianday function of SQLite.
+	TimeJulianDay
+)
+
+// DefaultTimeLayout is the layout of the times written as text when no other one is set.
+const DefaultTimeLayout = "2006-01-02 15:04:05.999999999-07:00"
+
+// julianDayOfEpoch is the Julian day of the Unix epoch.
+const julianDayOfEpoch = 2440587.5
+
+// textTimeLayouts are the layouts tried when reading times stored as text.
+var textTimeLayouts = []string{
+	DefaultTimeLayout,
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+var defaultTimeDeclTypes = []string{"TIMESTAMP", "DATETIME"}
+
+// TimeFormat configures how times are written to and read from the database. The zero value
+// writes time.Time arguments as text in DefaultTimeLayout, and reads the text of TIMESTAMP and
+// DATETIME columns as times in UTC.
+type TimeFormat struct {
+	// Encoding is how time.Time arguments are written.
+	Encoding TimeEncoding
+	// Layout is the layout of the times written as text, DefaultTimeLayout when empty. It is
+	// tried first when reading text.
+	Layout string
+	// DeclTypes are the declared types of the columns whose values are read as times, compared
+	// like the database type names of the columns. TIMESTAMP and DATETIME when empty.
+	DeclTypes []string
+	// Integers is how the integers of time columns are read: TimeUnixSeconds or TimeUnixMillis.
+	// They are left as integers when it is TimeText.
+	Integers TimeEncoding
+	// Reals is how the real numbers of time columns are read: TimeUnixSeconds, TimeUnixMillis
+	// or TimeJulianDay. They are left as numbers when it is TimeText.
+	Reals TimeEncoding
+	// Location is the location of the times read, and of the texts read without an offset.
+	// Times are converted to it before they are written. When nil, times are read in UTC and
+	// written in their own location.
+	Location *time.Location
+}
+
+// Encode returns t as it is stored in the database: a string, an int64 or a float64.
+func (f *TimeFormat) Encode(t time.Time) any {
+	if f.Location != nil {
+		t = t.In(f.Location)
+	}
+	switch f.Encoding {
+	case TimeUnixSeconds:
+		return t.Unix()
+	case TimeUnixMillis:
+		return t.UnixMilli()
+	case TimeJulianDay:
+		return julianDayOfEpoch + float64(t.Unix())/86400 + float64(t.Nanosecond())/86400e9
+	default:
+		return t.Format(f.layout())
+	}
+}
+
+// Decode returns v, read from a column declared as declType, as a time.Time when the column
+// holds times and v can be read as one. Other values are returned unchanged.
+func (f *TimeFormat) Decode(v any, declType string) any {
+	if !f.isTimeColumn(declType) {
+		return v
+	}
+	switch v := v.(type) {
+	case string:
+		if t, ok := f.parse(v); ok {
+			return t
+		}
+	case int64:
+		if f.Integers != TimeText {
+			return f.fromNumber(float64(v), f.Integers)
+		}
+	case float64:
+		if f.Reals != TimeText {
+			return f.fromNumber(v, f.Reals)
+		}
+	}
+	return v
+}
+
+func (f *TimeFormat) layout() string {
+	if f.Layout != "" {
+		return f.Layout
+	}
+	return DefaultTimeLayout
+}
+
+func (f *TimeFormat) location() *time.Location {
+	if f.Location != nil {
+		return f.Location
+	}
+	return time.UTC
+}
+
+func (f *TimeFormat) isTimeColumn(declType string) bool {
+	if declType == "" {
+		return false
+	}
+	declTypes := f.DeclTypes
+	if len(declTypes) == 0 {
+		declTypes = defaultTimeDeclTypes
+	}
+	name := shared.DatabaseTypeName(declType)
+	for _, t := range declTypes {
+		if shared.DatabaseTypeName(t) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *TimeFormat) parse(text string) (time.Time, bool) {
+	layouts := textTimeLayouts
+	if f.Layout != "" {
+		layouts = append([]string{f.Layout}, layouts...)
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, text, f.location()); err == nil {
+			if f.Location != nil {
+				t = t.In(f.Location)
+			}
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (f *TimeFormat) fromNumber(n float64, encoding TimeEncoding) time.Time {
+	var t time.Time
+	switch encoding {
+	case TimeUnixMillis:
+		t = time.UnixMilli(int64(n))
+	case TimeJulianDay:
+		// A float64 holds current Julian days to about 50µs. SQLite keeps milliseconds.
+		t = fromUnixSeconds((n - julianDayOfEpoch) * 86400).Round(time.Millisecond)
+	default:
+		t = fromUnixSeconds(n)
+	}
+	return t.In(f.location())
+}
+
+func fromUnixSeconds(seconds float64) time.Time {
+	whole, frac := math.Modf(seconds)
+	// Real numbers are rounded to the microsecond, about the precision of a float64 for
+	// current dates.
+	return time.Unix(int64(whole), int64(frac*1e9)).Round(time.Microsecond)
+}
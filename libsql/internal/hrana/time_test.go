@@ -0,0 +1,129 @@
+package hrana
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimeFormatEncode(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 500_000_000, time.UTC)
+	tests := []struct {
+		name   string
+		format TimeFormat
+		want   any
+	}{
+		{name: "default", want: "2024-01-02 03:04:05.5+00:00"},
+		{name: "layout", format: TimeFormat{Layout: time.RFC3339}, want: "2024-01-02T03:04:05Z"},
+		{name: "location", format: TimeFormat{Location: paris}, want: "2024-01-02 04:04:05.5+01:00"},
+		{name: "unix seconds", format: TimeFormat{Encoding: TimeUnixSeconds}, want: int64(1704164645)},
+		{name: "unix millis", format: TimeFormat{Encoding: TimeUnixMillis}, want: int64(1704164645500)},
+		{name: "julian day", format: TimeFormat{Encoding: TimeJulianDay}, want: 2460311.6278414354},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nv := driver.NamedValue{Ordinal: 1, Value: ts}
+			values := Values{Times: tt.format}
+			if err := values.CheckNamedValue(&nv); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(nv.Value, tt.want) {
+				t.Errorf("got %#v, want %#v", nv.Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeFormatDecode(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	est := time.FixedZone("EST", -5*3600)
+	tests := []struct {
+		name     string
+		format   TimeFormat
+		value    any
+		declType string
+		want     any
+	}{
+		{name: "text", value: "2024-01-02 03:04:05", declType: "TIMESTAMP", want: ts},
+		{name: "lower case decltype", value: "2024-01-02 03:04:05", declType: "datetime", want: ts},
+		{name: "not a time column", value: "2024-01-02 03:04:05", declType: "TEXT", want: "2024-01-02 03:04:05"},
+		{name: "expression", value: "2024-01-02 03:04:05", want: "2024-01-02 03:04:05"},
+		{name: "not a time", value: "tomorrow", declType: "TIMESTAMP", want: "tomorrow"},
+		{name: "integers left alone", value: int64(1704164645), declType: "TIMESTAMP", want: int64(1704164645)},
+		{
+			name:     "custom decltype",
+			format:   TimeFormat{DeclTypes: []string{"DATE"}},
+			value:    "2024-01-02",
+			declType: "date",
+			want:     time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "custom decltypes replace the defaults",
+			format:   TimeFormat{DeclTypes: []string{"DATE"}},
+			value:    "2024-01-02 03:04:05",
+			declType: "TIMESTAMP",
+			want:     "2024-01-02 03:04:05",
+		},
+		{
+			name:     "rfc3339",
+			format:   TimeFormat{DeclTypes: []string{"TIME"}, Layout: time.RFC3339},
+			value:    "2024-01-02T03:04:05Z",
+			declType: "TIME",
+			want:     ts,
+		},
+		{
+			name:     "location",
+			format:   TimeFormat{Location: est},
+			value:    "2024-01-01 22:04:05",
+			declType: "TIMESTAMP",
+			want:     ts.In(est),
+		},
+		{
+			name:     "unix seconds",
+			format:   TimeFormat{Integers: TimeUnixSeconds},
+			value:    int64(1704164645),
+			declType: "TIMESTAMP",
+			want:     ts,
+		},
+		{
+			name:     "unix millis",
+			format:   TimeFormat{Integers: TimeUnixMillis},
+			value:    int64(1704164645000),
+			declType: "TIMESTAMP",
+			want:     ts,
+		},
+		{
+			name:     "real unix seconds",
+			format:   TimeFormat{Reals: TimeUnixSeconds},
+			value:    1704164645.25,
+			declType: "TIMESTAMP",
+			want:     ts.Add(250 * time.Millisecond),
+		},
+		{
+			name:     "julian day",
+			format:   TimeFormat{Reals: TimeJulianDay},
+			value:    2460311.6278414354,
+			declType: "TIMESTAMP",
+			want:     ts.Add(500 * time.Millisecond),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.format.Decode(tt.value, tt.declType)
+			if want, ok := tt.want.(time.Time); ok {
+				if got, ok := got.(time.Time); !ok || !got.Equal(want) || got.Location().String() != want.Location().String() {
+					t.Errorf("got %#v, want %v", got, want)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,11 +1,16 @@
 package hrana
 
 import (
+	"database/sql/driver"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"math"
+	"reflect"
 	"strconv"
-	"strings"
 	"time"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
 )
 
 type Value struct {
@@ -14,52 +19,137 @@ type Value struct {
 	Base64 string `json:"base64,omitempty"`
 }
 
+// Values decoded from protobuf keep integers as int64 and blobs as []byte in Value
+// to skip the string and base64 round trips. MarshalJSON still produces the JSON wire form for them.
+func (v Value) MarshalJSON() ([]byte, error) {
+	type alias Value
+	a := alias(v)
+	if integer, ok := v.Value.(int64); ok && v.Type == "integer" {
+		a.Value = strconv.FormatInt(integer, 10)
+	}
+	if blob, ok := v.Value.([]byte); ok && v.Type == "blob" {
+		a.Value = nil
+		a.Base64 = base64.StdEncoding.WithPadding(base64.NoPadding).EncodeToString(blob)
+	}
+	return json.Marshal(a)
+}
+
+func (v Value) integer() (int64, error) {
+	switch integer := v.Value.(type) {
+	case int64:
+		return integer, nil
+	case string:
+		return strconv.ParseInt(integer, 10, 64)
+	default:
+		return 0, fmt.Errorf("invalid integer value: %v", v.Value)
+	}
+}
+
+func (v Value) blobBytes() ([]byte, error) {
+	if blob, ok := v.Value.([]byte); ok {
+		return blob, nil
+	}
+	return base64.StdEncoding.WithPadding(base64.NoPadding).DecodeString(v.Base64)
+}
+
+// ToValue returns v as a Go value, reading times as set by the zero TimeFormat.
 func (v Value) ToValue(columnType *string) any {
+	var defaultTimes TimeFormat
+	return defaultTimes.Decode(v.goValue(), declType(columnType))
+}
+
+// goValue returns v as a Go value: nil, int64, float64, string or []byte.
+func (v Value) goValue() any {
 	if v.Type == "blob" {
-		bytes, err := base64.StdEncoding.WithPadding(base64.NoPadding).DecodeString(v.Base64)
+		bytes, err := v.blobBytes()
 		if err != nil {
 			return nil
 		}
 		return bytes
 	} else if v.Type == "integer" {
-		integer, err := strconv.ParseInt(v.Value.(string), 10, 64)
+		integer, err := v.integer()
 		if err != nil {
 			return nil
 		}
 		return integer
-	} else if columnType != nil {
-		if (strings.ToLower(*columnType) == "timestamp" || strings.ToLower(*columnType) == "datetime") && v.Type == "text" {
-			for _, format := range []string{
-				"2006-01-02 15:04:05.999999999-07:00",
-				"2006-01-02T15:04:05.999999999-07:00",
-				"2006-01-02 15:04:05.999999999",
-				"2006-01-02T15:04:05.999999999",
-				"2006-01-02 15:04:05",
-				"2006-01-02T15:04:05",
-				"2006-01-02 15:04",
-				"2006-01-02T15:04",
-				"2006-01-02",
-			} {
-				if t, err := time.ParseInLocation(format, v.Value.(string), time.UTC); err == nil {
-					return t
-				}
-			}
+	}
+	return v.Value
+}
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// DriverValue converts v to one of the types that ToValue encodes: nil, int64, float64, bool,
+// string, []byte or time.Time. Pointers are dereferenced, driver.Valuer implementations are
+// replaced by their value, and named types are converted by kind, so that int32 or *string
+// are accepted. json.RawMessage is sent as text, since SQLite reads a blob passed to its JSON
+// functions as JSONB. []float32 and []float64 are encoded as libSQL vectors. Both the HTTP and
+// the WebSocket drivers check their arguments with it.
+func DriverValue(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, int64, float64, bool, string, []byte, time.Time:
+		return v, nil
+	case json.RawMessage:
+		return string(v), nil
+	case []float32:
+		return shared.EncodeVector32(v), nil
+	case []float64:
+		return shared.EncodeVector64(v), nil
+	case driver.Valuer:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Pointer && rv.IsNil() && rv.Type().Elem().Implements(valuerType) {
+			// Like database/sql, a nil pointer to a type with a value receiver is NULL.
+			return nil, nil
+		}
+		value, err := v.Value()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := value.(driver.Valuer); ok {
+			return nil, fmt.Errorf("the value of %T is a driver.Valuer as well", v)
 		}
+		return DriverValue(value)
 	}
 
-	return v.Value
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return DriverValue(rv.Elem().Interface())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return nil, fmt.Errorf("integer %d overflows int64, the largest integer SQLite stores", u)
+		}
+		return int64(u), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return rv.Bytes(), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported value type: %s", v)
 }
 
 func ToValue(v any) (Value, error) {
 	var res Value
+	v, err := DriverValue(v)
+	if err != nil {
+		return res, err
+	}
 	if v == nil {
 		res.Type = "null"
 	} else if integer, ok := v.(int64); ok {
 		res.Type = "integer"
 		res.Value = strconv.FormatInt(integer, 10)
-	} else if integer, ok := v.(int); ok {
-		res.Type = "integer"
-		res.Value = strconv.FormatInt(int64(integer), 10)
 	} else if text, ok := v.(string); ok {
 		res.Type = "text"
 		res.Value = text
@@ -71,7 +161,7 @@ func ToValue(v any) (Value, error) {
 		res.Value = float
 	} else if t, ok := v.(time.Time); ok {
 		res.Type = "text"
-		res.Value = t.Format("2006-01-02 15:04:05.999999999-07:00")
+		res.Value = t.Format(DefaultTimeLayout)
 	} else if t, ok := v.(bool); ok {
 		res.Type = "integer"
 		res.Value = "0"
@@ -1,7 +1,9 @@
 package hrana
 
 import (
+	"database/sql/driver"
 	"encoding/json"
+	"math"
 	"reflect"
 	"strconv"
 	"testing"
@@ -162,6 +164,51 @@ func TestToValue(t *testing.T) {
 	}
 }
 
+type name string
+
+type valuer struct{ v any }
+
+func (v valuer) Value() (driver.Value, error) {
+	return v.v, nil
+}
+
+func TestDriverValue(t *testing.T) {
+	text := "foo"
+	var nilText *string
+	var nilValuer *valuer
+	tests := []struct {
+		name    string
+		value   any
+		want    any
+		wantErr bool
+	}{
+		{name: "int32", value: int32(-7), want: int64(-7)},
+		{name: "uint16", value: uint16(7), want: int64(7)},
+		{name: "uint64", value: uint64(math.MaxInt64), want: int64(math.MaxInt64)},
+		{name: "uint64 overflow", value: uint64(math.MaxInt64) + 1, wantErr: true},
+		{name: "float32", value: float32(0.5), want: 0.5},
+		{name: "pointer", value: &text, want: "foo"},
+		{name: "nil pointer", value: nilText, want: nil},
+		{name: "valuer", value: valuer{int8(3)}, want: int64(3)},
+		{name: "nil valuer", value: nilValuer, want: nil},
+		{name: "named string", value: name("bar"), want: "bar"},
+		{name: "raw json", value: json.RawMessage(`{}`), want: `{}`},
+		{name: "raw json pointer", value: &json.RawMessage{'1'}, want: "1"},
+		{name: "unsupported", value: []int{1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DriverValue(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DriverValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DriverValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestMarshal(t *testing.T) {
 	tests := []struct {
 		name      string
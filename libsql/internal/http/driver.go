@@ -1,11 +1,13 @@
 package http
 
 import (
-	"database/sql/driver"
-
 	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/hranaV2"
 )
 
-func Connect(url, jwt, host string) driver.Conn {
-	return hranaV2.Connect(url, jwt, host)
+type Connector = hranaV2.Connector
+
+type Config = hranaV2.Config
+
+func NewConnector(url, jwt, host string, config Config) *Connector {
+	return hranaV2.NewConnector(url, jwt, host, config)
 }
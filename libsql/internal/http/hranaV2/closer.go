@@ -0,0 +1,116 @@
+package hranaV2
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+)
+
+const (
+	// maxCloseWorkers bounds the number of close requests in flight for one connector.
+	maxCloseWorkers = 4
+	// closeTimeout bounds each close request. A stream that could not be closed in time
+	// is left for the server to expire.
+	closeTimeout = 5 * time.Second
+	// closeWaitTimeout bounds how long Connector.Close waits for the queued closes. The streams
+	// that are not closed by then are left for the server to expire as well.
+	closeWaitTimeout = 5 * time.Second
+)
+
+type pendingClose struct {
+	baton string
+	url   string
+}
+
+// streamCloser closes the streams released by connections in the background, so that Close
+// and ResetSession don't wait for the server. Pending closes are queued and sent by at most
+// maxCloseWorkers goroutines, which exit once the queue is empty. Each stream is closed with a
+// request of its own, since a pipeline belongs to a single stream.
+type streamCloser struct {
+	connector *Connector
+	// ctx is canceled once wait gives up on the queued closes.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// waitTimeout is closeWaitTimeout, except in tests.
+	waitTimeout time.Duration
+
+	mu      sync.Mutex
+	pending []pendingClose
+	workers int
+	closed  bool
+	done    sync.WaitGroup
+}
+
+func (s *streamCloser) init(connector *Connector) {
+	s.connector = connector
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.waitTimeout = closeWaitTimeout
+}
+
+// close queues the close of a stream. Once the connector is closed, the stream is closed by
+// a goroutine of its own, which nothing waits for.
+func (s *streamCloser) close(baton, url string) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		go s.send(context.Background(), pendingClose{baton, url})
+		return
+	}
+	s.pending = append(s.pending, pendingClose{baton, url})
+	if s.workers < maxCloseWorkers {
+		s.workers++
+		s.done.Add(1)
+		go s.work()
+	}
+	s.mu.Unlock()
+}
+
+func (s *streamCloser) work() {
+	defer s.done.Done()
+	for {
+		s.mu.Lock()
+		if len(s.pending) == 0 {
+			s.workers--
+			s.mu.Unlock()
+			return
+		}
+		p := s.pending[0]
+		s.pending = s.pending[1:]
+		s.mu.Unlock()
+		s.send(s.ctx, p)
+	}
+}
+
+func (s *streamCloser) send(ctx context.Context, p pendingClose) {
+	ctx, cancel := context.WithTimeout(ctx, closeTimeout)
+	defer cancel()
+	msg := hrana.PipelineRequest{Baton: p.baton}
+	msg.Add(hrana.CloseStream())
+	_, _, _ = s.connector.sendPipelineRequest(ctx, &msg, p.url)
+}
+
+// wait stops queuing closes and waits for the queued ones to be sent, for at most waitTimeout.
+func (s *streamCloser) wait() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		s.done.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(s.waitTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		// Drop the closes that were not sent yet and cancel those in flight.
+		s.mu.Lock()
+		s.pending = nil
+		s.mu.Unlock()
+		s.cancel()
+		<-done
+	}
+}
@@ -0,0 +1,117 @@
+package hranaV2
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+)
+
+func TestStreamCloser(t *testing.T) {
+	var inFlight, maxInFlight, closed int32
+	var mu sync.Mutex
+	batons := map[string]bool{}
+	server, _ := newTestServer(t, []string{"/v2"}, func(_ string, body []byte) any {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		var req hrana.PipelineRequest
+		_ = json.Unmarshal(body, &req)
+		mu.Lock()
+		batons[req.Baton] = true
+		mu.Unlock()
+		atomic.AddInt32(&closed, 1)
+		return hrana.PipelineResponse{Results: []hrana.StreamResult{{Type: "ok"}}}
+	})
+	connector := NewConnector(server.URL, "", "", Config{})
+	const streams = 20
+	for i := 0; i < streams; i++ {
+		conn := connector.Connect().(*hranaV2Conn)
+		conn.baton = fmt.Sprintf("baton%d", i)
+		if err := conn.Close(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := connector.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(&closed); got != streams {
+		t.Errorf("got %d closed streams after Close, want %d", got, streams)
+	}
+	if len(batons) != streams {
+		t.Errorf("got %d distinct batons, want %d", len(batons), streams)
+	}
+	if got := atomic.LoadInt32(&maxInFlight); got > maxCloseWorkers {
+		t.Errorf("got %d concurrent close requests, want at most %d", got, maxCloseWorkers)
+	}
+}
+
+func TestStreamCloserWaitTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server, _ := newTestServer(t, []string{"/v2"}, func(string, []byte) any {
+		<-release
+		return hrana.PipelineResponse{Results: []hrana.StreamResult{{Type: "ok"}}}
+	})
+	// The server only returns once the requests are released.
+	t.Cleanup(func() { close(release) })
+	connector := NewConnector(server.URL, "", "", Config{})
+	connector.closer.waitTimeout = 50 * time.Millisecond
+	for i := 0; i < 3*maxCloseWorkers; i++ {
+		conn := connector.Connect().(*hranaV2Conn)
+		conn.baton = fmt.Sprintf("baton%d", i)
+		if err := conn.Close(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	start := time.Now()
+	if err := connector.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > closeTimeout {
+		t.Errorf("Close took %v, want it to give up on the streams after the timeout", elapsed)
+	}
+	if len(connector.closer.pending) != 0 {
+		t.Errorf("got %d closes left in the queue", len(connector.closer.pending))
+	}
+}
+
+func TestStreamCloserAfterClose(t *testing.T) {
+	release := make(chan struct{})
+	batons := make(chan string, 1)
+	server, _ := newTestServer(t, []string{"/v2"}, func(_ string, body []byte) any {
+		<-release
+		var req hrana.PipelineRequest
+		_ = json.Unmarshal(body, &req)
+		batons <- req.Baton
+		return hrana.PipelineResponse{Results: []hrana.StreamResult{{Type: "ok"}}}
+	})
+	connector := NewConnector(server.URL, "", "", Config{})
+	if err := connector.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	conn := connector.Connect().(*hranaV2Conn)
+	conn.baton = "late"
+	// The server only answers once the connection is closed, so Close must not wait for it.
+	if err := conn.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	close(release)
+	select {
+	case baton := <-batons:
+		if baton != "late" {
+			t.Errorf("got baton %q, want late", baton)
+		}
+	case <-time.After(closeTimeout):
+		t.Errorf("the stream was not closed")
+	}
+}
@@ -0,0 +1,205 @@
+package hranaV2
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	net_url "net/url"
+	"sync"
+	"time"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
+)
+
+// defaultRequestTimeout bounds requests when neither the connector nor the context sets a timeout.
+const defaultRequestTimeout = 60 * time.Second
+
+type protocolVersion int
+
+const (
+	versionUnknown protocolVersion = iota
+	version2
+	version3
+)
+
+// Config holds the connector settings chosen through libsql options.
+type Config struct {
+	// Encoding is used when the server speaks Hrana 3. Hrana 2 only supports JSON.
+	Encoding hrana.Encoding
+	// Client sends all requests of the connector. When nil, the connector creates its own
+	// client so that connections to the same database share one pool of keep-alive connections.
+	Client *http.Client
+	// Timeouts are the defaults of the connector. The dial timeout only applies to the
+	// connector's own client, since the transport of a custom client is left untouched.
+	Timeouts shared.Timeouts
+	// ReplicaURL, if set, receives the read-only transactions.
+	ReplicaURL string
+	// RetryPolicy is shared.DefaultRetryPolicy when nil.
+	RetryPolicy *shared.RetryPolicy
+	// SequenceScripts sends statements without arguments that hold several statements as
+	// scripts, with ExecScript.
+	SequenceScripts bool
+	// DescribeStatements describes statements on the server as they are prepared.
+	DescribeStatements bool
+	// Values sets how arguments and results are converted: times and codecs.
+	Values hrana.Values
+}
+
+// Connector holds the state shared by all connections to one database.
+// The Hrana version spoken by the server is probed once and cached here.
+type Connector struct {
+	url    string
+	jwt    string
+	host   string
+	config Config
+	client *http.Client
+	// replicaHost is the host of config.ReplicaURL, which is not reached through the proxy.
+	replicaHost string
+
+	versionMu sync.Mutex
+	version   protocolVersion
+
+	closer streamCloser
+}
+
+func NewConnector(url, jwt, host string, config Config) *Connector {
+	client := config.Client
+	if client == nil {
+		client = &http.Client{Transport: newDefaultTransport(config.Timeouts.Dial)}
+	}
+	connector := &Connector{url: url, jwt: jwt, host: host, config: config, client: client}
+	if replica, err := net_url.Parse(config.ReplicaURL); err == nil {
+		connector.replicaHost = replica.Host
+	}
+	connector.closer.init(connector)
+	return connector
+}
+
+// Close waits for the streams released by connections to be closed on the server, for at most
+// five seconds, after which the remaining streams are left for the server to expire.
+// sql.DB.Close calls it after closing the connections of the pool.
+func (c *Connector) Close() error {
+	c.closer.wait()
+	if c.config.Client == nil {
+		c.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+// newDefaultTransport tunes http.DefaultTransport for a driver that sends many small
+// requests to a single host. The default of two idle connections per host would make
+// most requests of a busy sql.DB pool open a new TCP and TLS connection.
+func newDefaultTransport(dialTimeout time.Duration) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 100
+	if dialTimeout != 0 {
+		if dialTimeout < 0 {
+			dialTimeout = 0
+		}
+		dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = dialTimeout
+	}
+	return transport
+}
+
+// timeouts returns the timeouts that apply to a call made with ctx.
+func (c *Connector) timeouts(ctx context.Context) shared.Timeouts {
+	timeouts := c.config.Timeouts.Override(shared.TimeoutsFromContext(ctx))
+	if timeouts.Request == 0 {
+		timeouts.Request = defaultRequestTimeout
+	}
+	return timeouts
+}
+
+func (c *Connector) Connect() driver.Conn {
+	return &hranaV2Conn{connector: c, url: c.url}
+}
+
+// protocolVersion returns the negotiated protocol version, probing the server on first use.
+// Network failures are not cached so that the next request probes again.
+func (c *Connector) protocolVersion(ctx context.Context) (protocolVersion, error) {
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+	if c.version != versionUnknown {
+		return c.version, nil
+	}
+	for _, candidate := range []struct {
+		path    string
+		version protocolVersion
+	}{
+		{"/v3", version3},
+		{"/v2", version2},
+	} {
+		ok, err := c.probe(ctx, candidate.path)
+		if err != nil {
+			return versionUnknown, err
+		}
+		if ok {
+			c.version = candidate.version
+			return c.version, nil
+		}
+	}
+	// Older sqld builds do not answer the version endpoints at all, but they all speak v2.
+	c.version = version2
+	return c.version, nil
+}
+
+func (c *Connector) retryPolicy() shared.RetryPolicy {
+	if c.config.RetryPolicy == nil {
+		return shared.DefaultRetryPolicy
+	}
+	return *c.config.RetryPolicy
+}
+
+func (c *Connector) encoding(version protocolVersion) hrana.Encoding {
+	if version == version3 {
+		return c.config.Encoding
+	}
+	return hrana.EncodingJSON
+}
+
+func (c *Connector) endpointPath(version protocolVersion, endpoint string) string {
+	switch {
+	case version == version3 && c.config.Encoding == hrana.EncodingProtobuf:
+		return "/v3-protobuf/" + endpoint
+	case version == version3:
+		return "/v3/" + endpoint
+	default:
+		return "/v2/" + endpoint
+	}
+}
+
+func (c *Connector) probe(ctx context.Context, path string) (bool, error) {
+	probeURL, err := net_url.JoinPath(c.url, path)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", probeURL, nil)
+	if err != nil {
+		return false, err
+	}
+	c.setHeaders(req)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to detect the Hrana version of the server: %w", newRequestError(err))
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+func (c *Connector) setHeaders(req *http.Request) {
+	if len(c.jwt) > 0 {
+		req.Header.Set("Authorization", "Bearer "+c.jwt)
+	}
+	req.Header.Set("x-libsql-client-version", "libsql-remote-go-"+commitHash)
+	if c.replicaHost == "" || req.URL.Host != c.replicaHost {
+		req.Host = c.host
+	}
+}
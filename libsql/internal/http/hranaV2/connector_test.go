@@ -0,0 +1,349 @@
+package hranaV2
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
+)
+
+func newTestServer(t *testing.T, versions []string, handler func(path string, body []byte) any) (*httptest.Server, *int32) {
+	var probes int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			atomic.AddInt32(&probes, 1)
+			for _, v := range versions {
+				if r.URL.Path == v {
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		response := handler(r.URL.Path, body)
+		if raw, ok := response.([]byte); ok {
+			_, _ = w.Write(raw)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server, &probes
+}
+
+func okPipelineResponse() hrana.PipelineResponse {
+	return hrana.PipelineResponse{
+		Baton: "baton",
+		Results: []hrana.StreamResult{{
+			Type:     "ok",
+			Response: &hrana.StreamResponse{Type: "execute", Result: json.RawMessage(`{"cols":[],"rows":[],"affected_row_count":0}`)},
+		}},
+	}
+}
+
+// okResult is a successful result for r, with no rows.
+func okResult(r hrana.StreamRequest) hrana.StreamResult {
+	const stmtResult = `{"cols":[],"rows":[],"affected_row_count":0}`
+	result := hrana.StreamResult{Type: "ok", Response: &hrana.StreamResponse{Type: r.Type}}
+	switch r.Type {
+	case "execute":
+		result.Response.Result = json.RawMessage(stmtResult)
+	case "batch":
+		results := make([]string, len(r.Batch.Steps))
+		errs := make([]string, len(r.Batch.Steps))
+		for i := range r.Batch.Steps {
+			results[i], errs[i] = stmtResult, "null"
+		}
+		result.Response.Result = json.RawMessage(`{"step_results":[` + strings.Join(results, ",") + `],"step_errors":[` + strings.Join(errs, ",") + `]}`)
+	}
+	return result
+}
+
+// stmtSqls returns the SQL texts of the statements of r.
+func stmtSqls(r hrana.StreamRequest) []string {
+	var sqls []string
+	if r.Stmt != nil && r.Stmt.Sql != nil {
+		sqls = append(sqls, *r.Stmt.Sql)
+	}
+	if r.Batch != nil {
+		for _, step := range r.Batch.Steps {
+			if step.Stmt.Sql != nil {
+				sqls = append(sqls, *step.Stmt.Sql)
+			}
+		}
+	}
+	return sqls
+}
+
+func TestProtocolVersionNegotiation(t *testing.T) {
+	testCases := []struct {
+		name         string
+		versions     []string
+		wantVersion  protocolVersion
+		wantPipeline string
+	}{
+		{
+			name:         "v3",
+			versions:     []string{"/v2", "/v3"},
+			wantVersion:  version3,
+			wantPipeline: "/v3/pipeline",
+		},
+		{
+			name:         "v2",
+			versions:     []string{"/v2"},
+			wantVersion:  version2,
+			wantPipeline: "/v2/pipeline",
+		},
+		{
+			name:         "no version endpoints",
+			versions:     nil,
+			wantVersion:  version2,
+			wantPipeline: "/v2/pipeline",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var pipelinePath atomic.Value
+			server, probes := newTestServer(t, tc.versions, func(path string, _ []byte) any {
+				pipelinePath.Store(path)
+				return okPipelineResponse()
+			})
+			connector := NewConnector(server.URL, "", "", Config{})
+			for i := 0; i < 2; i++ {
+				conn := connector.Connect().(*hranaV2Conn)
+				if _, err := conn.ExecContext(context.Background(), "SELECT 1", nil); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			if connector.version != tc.wantVersion {
+				t.Errorf("got version %v, want %v", connector.version, tc.wantVersion)
+			}
+			if got := pipelinePath.Load(); got != tc.wantPipeline {
+				t.Errorf("got pipeline path %v, want %v", got, tc.wantPipeline)
+			}
+			probesBefore := atomic.LoadInt32(probes)
+			conn := connector.Connect().(*hranaV2Conn)
+			if _, err := conn.ExecContext(context.Background(), "SELECT 1", nil); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if atomic.LoadInt32(probes) != probesBefore {
+				t.Errorf("the protocol version should be probed only once per connector")
+			}
+		})
+	}
+}
+
+type countingTransport struct {
+	requests int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.requests, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestCustomClient(t *testing.T) {
+	server, _ := newTestServer(t, []string{"/v3"}, func(string, []byte) any {
+		return okPipelineResponse()
+	})
+	transport := &countingTransport{}
+	connector := NewConnector(server.URL, "", "", Config{Client: &http.Client{Transport: transport}})
+	conn := connector.Connect().(*hranaV2Conn)
+	if _, err := conn.ExecContext(context.Background(), "SELECT 1", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// One probe and one pipeline request.
+	if got := atomic.LoadInt32(&transport.requests); got != 2 {
+		t.Errorf("got %d requests through the custom transport, want 2", got)
+	}
+	if NewConnector(server.URL, "", "", Config{}).client == http.DefaultClient {
+		t.Errorf("the default connector should not use http.DefaultClient")
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	server, _ := newTestServer(t, []string{"/v3"}, func(string, []byte) any {
+		time.Sleep(200 * time.Millisecond)
+		return okPipelineResponse()
+	})
+	connector := NewConnector(server.URL, "", "", Config{Timeouts: shared.Timeouts{Request: time.Minute}})
+	conn := connector.Connect().(*hranaV2Conn)
+	ctx := shared.ContextWithTimeouts(context.Background(), shared.Timeouts{Request: 50 * time.Millisecond})
+	if _, err := conn.ExecContext(ctx, "SELECT 1", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want a deadline error", err)
+	}
+	conn = connector.Connect().(*hranaV2Conn)
+	if _, err := conn.ExecContext(context.Background(), "SELECT 1", nil); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestIdleStreamTimeout(t *testing.T) {
+	var batons []string
+	server, _ := newTestServer(t, []string{"/v3"}, func(_ string, body []byte) any {
+		var req hrana.PipelineRequest
+		_ = json.Unmarshal(body, &req)
+		batons = append(batons, req.Baton)
+		return okPipelineResponse()
+	})
+	connector := NewConnector(server.URL, "", "", Config{Timeouts: shared.Timeouts{IdleStream: time.Minute}})
+	conn := connector.Connect().(*hranaV2Conn)
+	// The pragma keeps the stream open.
+	for _, stmt := range []string{"PRAGMA foreign_keys = ON", "SELECT 1"} {
+		if _, err := conn.ExecContext(context.Background(), stmt, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	conn.lastUsed = time.Now().Add(-2 * time.Minute)
+	if _, err := conn.ExecContext(context.Background(), "SELECT 1", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []string{"", "baton", ""}
+	if !reflect.DeepEqual(batons, want) {
+		t.Errorf("got batons %q, want %q", batons, want)
+	}
+}
+
+func TestReadOnlyTransactionOnReplica(t *testing.T) {
+	var primaryStmts, replicaStmts []string
+	recordStmts := func(stmts *[]string) func(string, []byte) any {
+		return func(_ string, body []byte) any {
+			var req hrana.PipelineRequest
+			_ = json.Unmarshal(body, &req)
+			resp := hrana.PipelineResponse{Baton: "baton"}
+			for _, r := range req.Requests {
+				*stmts = append(*stmts, stmtSqls(r)...)
+				resp.Results = append(resp.Results, okResult(r))
+			}
+			return resp
+		}
+	}
+	primary, _ := newTestServer(t, []string{"/v2"}, recordStmts(&primaryStmts))
+	replica, _ := newTestServer(t, []string{"/v2"}, recordStmts(&replicaStmts))
+	connector := NewConnector(primary.URL, "", "", Config{ReplicaURL: replica.URL})
+	conn := connector.Connect().(*hranaV2Conn)
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, driver.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := conn.ExecContext(ctx, "SELECT 1", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := conn.ExecContext(ctx, "INSERT INTO t VALUES (1)", nil); !errors.Is(err, shared.ErrReadOnlyTx) {
+		t.Errorf("got error %v, want ErrReadOnlyTx", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := conn.ExecContext(ctx, "INSERT INTO t VALUES (1)", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := []string{"BEGIN DEFERRED", "SELECT 1", "COMMIT"}; !reflect.DeepEqual(replicaStmts, want) {
+		t.Errorf("got replica statements %q, want %q", replicaStmts, want)
+	}
+	if want := []string{"INSERT INTO t VALUES (1)"}; !reflect.DeepEqual(primaryStmts, want) {
+		t.Errorf("got primary statements %q, want %q", primaryStmts, want)
+	}
+}
+
+func TestResetSession(t *testing.T) {
+	testCases := []struct {
+		name       string
+		versions   []string
+		autocommit bool
+		wantBatons []string
+		wantClose  bool
+	}{
+		{
+			name:       "stream reused",
+			versions:   []string{"/v3"},
+			autocommit: true,
+			wantBatons: []string{"", "baton"},
+		},
+		{
+			name:       "transaction left open",
+			versions:   []string{"/v3"},
+			autocommit: false,
+			wantBatons: []string{"", ""},
+			wantClose:  true,
+		},
+		{
+			name:       "hrana 2",
+			versions:   []string{"/v2"},
+			wantBatons: []string{"", ""},
+			wantClose:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var batons []string
+			closed := make(chan struct{}, 1)
+			server, _ := newTestServer(t, tc.versions, func(_ string, body []byte) any {
+				var req hrana.PipelineRequest
+				_ = json.Unmarshal(body, &req)
+				resp := okPipelineResponse()
+				if len(req.Requests) > 0 && req.Requests[0].Type == "close" {
+					select {
+					case closed <- struct{}{}:
+					default:
+					}
+					return resp
+				}
+				batons = append(batons, req.Baton)
+				if len(req.Requests) == 2 && req.Requests[1].Type == "get_autocommit" {
+					autocommit := tc.autocommit
+					resp.Results = append(resp.Results, hrana.StreamResult{
+						Type:     "ok",
+						Response: &hrana.StreamResponse{Type: "get_autocommit", IsAutocommit: &autocommit},
+					})
+				}
+				return resp
+			})
+			conn := NewConnector(server.URL, "", "", Config{}).Connect().(*hranaV2Conn)
+			ctx := context.Background()
+			for i := 0; i < 2; i++ {
+				if _, err := conn.ExecContext(ctx, "BEGIN", nil); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if err := conn.ResetSession(ctx); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			if !reflect.DeepEqual(batons, tc.wantBatons) {
+				t.Errorf("got batons %q, want %q", batons, tc.wantBatons)
+			}
+			select {
+			case <-closed:
+				if !tc.wantClose {
+					t.Errorf("the stream should not be closed")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tc.wantClose {
+					t.Errorf("the stream should be closed")
+				}
+			}
+			if !conn.IsValid() {
+				t.Errorf("the connection should be valid")
+			}
+			conn.streamClosed = true
+			if conn.IsValid() || !errors.Is(conn.ResetSession(ctx), driver.ErrBadConn) {
+				t.Errorf("a connection with a closed stream should be invalid")
+			}
+		})
+	}
+}
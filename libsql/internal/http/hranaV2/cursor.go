@@ -0,0 +1,402 @@
+package hranaV2
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
+)
+
+// cursorRows reads the rows of a Hrana 3 cursor while the caller iterates over them,
+// so memory use does not depend on the size of the result.
+//
+// The stream is busy until the cursor is fully read. If the connection is needed for
+// another request in the meantime, such as a statement run for each row, the rest of the
+// cursor is buffered first (see drain), like results that are not read through a cursor.
+// Closing the rows early drops the stream, unless it holds a transaction or the state of the
+// session: then Close reads and discards the rest of the cursor, within the request timeout.
+type cursorRows struct {
+	conn   *hranaV2Conn
+	query  string
+	reader *hrana.CursorReader
+	body   io.ReadCloser
+	cancel context.CancelFunc
+	// timeout bounds the read of the rest of the cursor when the rows are closed early.
+	timeout time.Duration
+
+	// buffered holds the entries read by drain. finished is set once the body is closed
+	// and readErr holds the error that ended the read, if it wasn't a clean end of stream.
+	buffered []*hrana.CursorEntry
+	finished bool
+	readErr  error
+
+	// stepOffset is the number of steps that precede those of query in the cursor, such as
+	// the pending statements of a transaction.
+	stepOffset uint32
+
+	cols     []hrana.Column
+	peeked   *hrana.CursorEntry
+	stepDone bool
+	closed   bool
+}
+
+// queryCursor runs query through a cursor. A cursor can't carry store_sql, so the SQL text is
+// only referenced by sqlId when it is already stored on the current stream.
+func (h *hranaV2Conn) queryCursor(ctx context.Context, version protocolVersion, query string, sqlId int32, args []driver.NamedValue) (driver.Rows, error) {
+	if err := h.pauseIdleTx(); err != nil {
+		return nil, fmt.Errorf("failed to execute SQL: %s\n%w", query, err)
+	}
+	h.busy = true
+	defer func() {
+		h.busy = false
+		h.armIdleTx()
+	}()
+	if h.pendingErr != nil {
+		return nil, fmt.Errorf("failed to execute SQL: %s\n%w", query, h.pendingErr)
+	}
+	stmts, params, err := shared.ParseStatementAndArgs(query, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute SQL: %s\n%w", query, err)
+	}
+	if err := h.checkReadOnly(query); err != nil {
+		return nil, fmt.Errorf("failed to execute SQL: %s\n%w", query, err)
+	}
+	batchStream, err := hrana.BatchStream(stmts, params, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute SQL: %s\n%w", query, err)
+	}
+	encoding := h.connector.encoding(version)
+
+	// The timeout only covers the start of the cursor. Reading the rows can take as long as the caller needs.
+	timeout := h.connector.timeouts(ctx).Request
+	ctx, cancel := context.WithCancel(ctx)
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, cancel)
+		defer timer.Stop()
+	}
+	// A cursor can't carry get_autocommit, but a stream in autocommit mode stays in it unless
+	// the query starts a transaction.
+	changesSession := shared.ChangesSession(query)
+	keepsAutocommit := !h.inTx && (h.baton == "" || h.autocommit == autocommitOn) && !changesSession
+	// The pending statements of the transaction run as the first steps of the cursor.
+	pending := h.pending
+	var resp *http.Response
+	err = h.retry(ctx, []hrana.StreamRequest{*batchStream}, func() error {
+		if err := h.prepareRequest(ctx); err != nil {
+			return err
+		}
+		if h.baton == "" {
+			h.storedSql.reset()
+		}
+		if len(stmts) == 1 && sqlId != 0 {
+			stmt := &batchStream.Batch.Steps[0].Stmt
+			if h.storedSql.isRegistered(sqlId) {
+				stmt.Sql, stmt.SqlId = nil, &sqlId
+			} else {
+				stmt.Sql, stmt.SqlId = &stmts[0], nil
+			}
+		}
+		msg := &hrana.CursorRequest{Baton: h.baton, Batch: batchStream.Batch}
+		if len(pending) > 0 {
+			msg.Batch = pendingBatch(pending, batchStream.Batch)
+		}
+		if h.replicationIndex > 0 {
+			msg.Batch.ReplicationIndex = &h.replicationIndex
+		}
+		reqBody, err := hrana.MarshalCursorRequest(encoding, msg)
+		if err != nil {
+			return err
+		}
+		var streamClosed bool
+		resp, streamClosed, err = h.connector.sendRequest(ctx, h.url, h.connector.endpointPath(version, "cursor"), encoding, reqBody)
+		if streamClosed {
+			h.streamClosed = true
+		}
+		return err
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to execute SQL: %s\n%w", query, err)
+	}
+	reader := hrana.NewCursorReader(encoding, resp.Body)
+	cursorResp, err := reader.ReadResponse()
+	if err != nil {
+		cancel()
+		resp.Body.Close()
+		h.streamClosed = true
+		return nil, fmt.Errorf("failed to execute SQL: %s\n%w", query, err)
+	}
+	h.baton = cursorResp.Baton
+	h.autocommit = autocommitUnknown
+	if keepsAutocommit {
+		h.autocommit = autocommitOn
+	}
+	if cursorResp.BaseUrl != "" {
+		h.url = cursorResp.BaseUrl
+	}
+
+	if changesSession {
+		h.sessionChanged = true
+	}
+
+	rows := &cursorRows{conn: h, query: query, reader: reader, body: resp.Body, cancel: cancel, timeout: timeout}
+	h.cursor = rows
+	if len(pending) > 0 {
+		if err := rows.skipPending(len(pending)); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to execute SQL: %s\n%w", query, err)
+		}
+	}
+	entry, err := rows.read()
+	if err == nil && entry.Type != "step_begin" {
+		err = rows.entryError(entry)
+	}
+	if err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("failed to execute SQL: %s\n%w", query, err)
+	}
+	rows.cols = entry.Cols
+	return rows, nil
+}
+
+// skipPending reads the entries of the n pending steps that precede the steps of the query.
+func (r *cursorRows) skipPending(n int) error {
+	r.stepOffset = uint32(n)
+	// step_end entries don't carry the step, which is the one of the last step_begin.
+	var step uint32
+	for {
+		entry, err := r.read()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.Type == "step_begin":
+			step = entry.Step
+		case entry.Type == "step_error" && entry.Step < r.stepOffset:
+			return r.conn.pendingFailed(int(entry.Step), entry.Error)
+		case entry.Type == "error":
+			return r.entryError(entry)
+		case entry.Type == "step_end" && step == r.stepOffset-1:
+			r.conn.pendingSent()
+			return nil
+		}
+	}
+}
+
+func (r *cursorRows) entryError(entry *hrana.CursorEntry) error {
+	if entry.Error != nil {
+		step := -1
+		if entry.Type == "step_error" {
+			step = int(entry.Step - r.stepOffset)
+		}
+		return fmt.Errorf("failed to execute statement\n%w", entry.Error.ToError(r.query, step))
+	}
+	return fmt.Errorf("unexpected cursor entry: %s", entry.Type)
+}
+
+func (r *cursorRows) read() (*hrana.CursorEntry, error) {
+	if r.peeked != nil {
+		entry := r.peeked
+		r.peeked = nil
+		return entry, nil
+	}
+	if len(r.buffered) > 0 {
+		entry := r.buffered[0]
+		r.buffered = r.buffered[1:]
+		return entry, nil
+	}
+	if r.finished {
+		if r.readErr != nil {
+			return nil, r.readErr
+		}
+		return nil, io.EOF
+	}
+	entry, err := r.reader.Next()
+	if err != nil {
+		r.finish(err)
+		return r.read()
+	}
+	return entry, nil
+}
+
+// finish closes the response body once the cursor has been read to its end or failed.
+func (r *cursorRows) finish(err error) {
+	if r.finished {
+		return
+	}
+	r.finished = true
+	if err != io.EOF {
+		r.readErr = err
+		// The stream is in an unknown state after a broken cursor.
+		r.conn.abandonStream()
+	}
+	r.body.Close()
+	r.cancel()
+	r.conn.lastUsed = time.Now()
+	if r.conn.cursor == r {
+		r.conn.cursor = nil
+		r.conn.armIdleTx()
+	}
+}
+
+// drain buffers the remaining entries so that the connection can send other requests.
+func (r *cursorRows) drain() {
+	for !r.finished {
+		entry, err := r.reader.Next()
+		if err != nil {
+			r.finish(err)
+			return
+		}
+		r.buffered = append(r.buffered, entry)
+	}
+}
+
+func (r *cursorRows) Columns() []string {
+	res := make([]string, len(r.cols))
+	for i, c := range r.cols {
+		if c.Name != nil {
+			res[i] = *c.Name
+		}
+	}
+	return res
+}
+
+func (r *cursorRows) ColumnTypeDatabaseTypeName(index int) string {
+	return shared.DatabaseTypeName(r.declType(index))
+}
+
+func (r *cursorRows) ColumnTypeScanType(index int) reflect.Type {
+	return r.conn.connector.config.Values.ScanType(r.declType(index))
+}
+
+// ColumnTypeNullable reports every column as nullable: SQLite doesn't tell which columns of a
+// result can't hold NULL.
+func (r *cursorRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return true, true
+}
+
+func (r *cursorRows) declType(index int) string {
+	if t := r.cols[index].Type; t != nil {
+		return *t
+	}
+	return ""
+}
+
+func (r *cursorRows) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.buffered = nil
+	r.peeked = nil
+	if r.finished {
+		return nil
+	}
+	if !r.conn.canCloseStream(false) {
+		// A transaction or the state of the session lives on this stream, so read the rest of
+		// the cursor instead of dropping it. A stalled response cancels the read, and the
+		// stream is lost with it.
+		if r.timeout > 0 {
+			timer := time.AfterFunc(r.timeout, r.cancel)
+			defer timer.Stop()
+		}
+		for !r.finished {
+			if _, err := r.reader.Next(); err != nil {
+				r.finish(err)
+			}
+		}
+		if r.readErr != nil {
+			r.conn.streamClosed = true
+			return fmt.Errorf("failed to read the rest of the cursor: %w", r.readErr)
+		}
+		return nil
+	}
+	// Stop reading early. The stream is still busy on the server, so it is closed in the
+	// background and the connection starts a new one.
+	r.finish(io.EOF)
+	r.conn.closeStream()
+	return nil
+}
+
+func (r *cursorRows) Next(dest []driver.Value) error {
+	if r.stepDone {
+		return io.EOF
+	}
+	entry, err := r.read()
+	if err == io.EOF {
+		r.stepDone = true
+		return io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+	switch entry.Type {
+	case "row":
+		for idx := range dest {
+			if idx < len(entry.Row) && idx < len(r.cols) {
+				v, err := r.conn.connector.config.Values.DecodeValue(entry.Row[idx], r.cols[idx].Type)
+				if err != nil {
+					return err
+				}
+				dest[idx] = v
+			}
+		}
+		return nil
+	case "step_end":
+		r.stepDone = true
+		return io.EOF
+	case "step_begin":
+		r.stepDone = true
+		r.peeked = entry
+		return io.EOF
+	default:
+		r.stepDone = true
+		return r.entryError(entry)
+	}
+}
+
+func (r *cursorRows) HasNextResultSet() bool {
+	for !r.stepDone {
+		entry, err := r.read()
+		if err != nil {
+			return false
+		}
+		switch entry.Type {
+		case "step_end", "step_error", "error":
+			r.stepDone = true
+		case "step_begin":
+			r.stepDone = true
+			r.peeked = entry
+		}
+	}
+	if r.peeked == nil {
+		entry, err := r.read()
+		if err != nil {
+			return false
+		}
+		r.peeked = entry
+	}
+	return r.peeked.Type == "step_begin" || r.peeked.Type == "step_error"
+}
+
+func (r *cursorRows) NextResultSet() error {
+	if !r.HasNextResultSet() {
+		return io.EOF
+	}
+	entry := r.peeked
+	r.peeked = nil
+	r.stepDone = false
+	if entry.Type == "step_error" {
+		r.stepDone = true
+		r.cols = nil
+		return r.entryError(entry)
+	}
+	r.cols = entry.Cols
+	return nil
+}
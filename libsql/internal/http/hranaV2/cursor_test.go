@@ -0,0 +1,328 @@
+package hranaV2
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
+)
+
+func cursorBody(entries ...string) []byte {
+	return []byte(`{"baton":"cursor-baton"}` + "\n" + strings.Join(entries, "\n") + "\n")
+}
+
+func TestCursorRows(t *testing.T) {
+	var requests []string
+	server, _ := newTestServer(t, []string{"/v3"}, func(path string, body []byte) any {
+		requests = append(requests, path)
+		if path == "/v3/cursor" {
+			var req hrana.CursorRequest
+			if err := json.Unmarshal(body, &req); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if len(req.Batch.Steps) != 2 || !req.Batch.Steps[0].Stmt.WantRows {
+				t.Errorf("unexpected cursor request %s", body)
+			}
+			return cursorBody(
+				`{"type":"step_begin","step":0,"cols":[{"name":"a","decltype":"INTEGER"}]}`,
+				`{"type":"row","row":[{"type":"integer","value":"1"}]}`,
+				`{"type":"row","row":[{"type":"integer","value":"2"}]}`,
+				`{"type":"step_end","affected_row_count":0}`,
+				`{"type":"step_begin","step":1,"cols":[{"name":"b","decltype":"TEXT"}]}`,
+				`{"type":"row","row":[{"type":"text","value":"x"}]}`,
+				`{"type":"step_end","affected_row_count":0}`,
+			)
+		}
+		return okPipelineResponse()
+	})
+	conn := NewConnector(server.URL, "", "", Config{}).Connect().(*hranaV2Conn)
+	rows, err := conn.QueryContext(context.Background(), "SELECT a FROM t; SELECT b FROM t", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if conn.baton != "cursor-baton" {
+		t.Errorf("got baton %q, want cursor-baton", conn.baton)
+	}
+	if cols := rows.Columns(); len(cols) != 1 || cols[0] != "a" {
+		t.Errorf("unexpected columns %v", cols)
+	}
+	if typ := rows.(driver.RowsColumnTypeDatabaseTypeName).ColumnTypeDatabaseTypeName(0); typ != "INTEGER" {
+		t.Errorf("got database type %q, want INTEGER", typ)
+	}
+	if typ := rows.(driver.RowsColumnTypeScanType).ColumnTypeScanType(0); typ != reflect.TypeOf(int64(0)) {
+		t.Errorf("got scan type %v, want int64", typ)
+	}
+	dest := make([]driver.Value, 1)
+	for _, want := range []int64{1, 2} {
+		if err := rows.Next(dest); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if dest[0] != want {
+			t.Errorf("got %v, want %v", dest[0], want)
+		}
+	}
+	if err := rows.Next(dest); err != io.EOF {
+		t.Fatalf("got %v, want io.EOF", err)
+	}
+
+	// Using the connection while the cursor is open buffers the rest of the cursor.
+	if _, err := conn.ExecContext(context.Background(), "SELECT 1", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if conn.cursor != nil {
+		t.Errorf("the cursor should have been drained")
+	}
+
+	multi := rows.(driver.RowsNextResultSet)
+	if !multi.HasNextResultSet() {
+		t.Fatalf("expected a second result set")
+	}
+	if err := multi.NextResultSet(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := rows.Next(dest); err != nil || dest[0] != "x" {
+		t.Fatalf("got %v, %v, want x", dest[0], err)
+	}
+	if err := rows.Next(dest); err != io.EOF {
+		t.Fatalf("got %v, want io.EOF", err)
+	}
+	if multi.HasNextResultSet() {
+		t.Errorf("expected no more result sets")
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(requests, ",") != "/v3/cursor,/v3/pipeline" {
+		t.Errorf("unexpected requests %v", requests)
+	}
+}
+
+func TestCursorRowsCloseEarly(t *testing.T) {
+	var mu sync.Mutex
+	var closed []string
+	server, _ := newTestServer(t, []string{"/v3"}, func(path string, body []byte) any {
+		if path == "/v3/pipeline" {
+			var req hrana.PipelineRequest
+			_ = json.Unmarshal(body, &req)
+			mu.Lock()
+			closed = append(closed, req.Baton)
+			mu.Unlock()
+			return hrana.PipelineResponse{Results: []hrana.StreamResult{okResult(req.Requests[0])}}
+		}
+		entries := []string{`{"type":"step_begin","step":0,"cols":[{"name":"a"}]}`}
+		for i := 0; i < 1000; i++ {
+			entries = append(entries, `{"type":"row","row":[{"type":"integer","value":"1"}]}`)
+		}
+		entries = append(entries, `{"type":"step_end","affected_row_count":0}`)
+		return cursorBody(entries...)
+	})
+	connector := NewConnector(server.URL, "", "", Config{})
+	conn := connector.Connect().(*hranaV2Conn)
+	ctx := context.Background()
+	dest := make([]driver.Value, 1)
+	rows, err := conn.QueryContext(ctx, "SELECT a FROM t", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := rows.Next(dest); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if conn.baton != "" || conn.streamClosed {
+		t.Errorf("closing the cursor early outside a transaction should only drop the stream")
+	}
+	if err := connector.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(closed, []string{"cursor-baton"}) {
+		t.Errorf("got closes of %q, want the stream of the cursor to be closed", closed)
+	}
+
+	// A stream that holds a setting is kept, so the rest of the cursor is read.
+	conn = NewConnector(server.URL, "", "", Config{}).Connect().(*hranaV2Conn)
+	conn.sessionChanged = true
+	rows, err = conn.QueryContext(ctx, "SELECT a FROM t", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if conn.baton != "cursor-baton" || conn.cursor != nil {
+		t.Errorf("the stream of the cursor should be kept")
+	}
+}
+
+func TestCursorRowsInTransaction(t *testing.T) {
+	const rowCount = 20000
+	server, _ := newTestServer(t, []string{"/v3"}, func(path string, body []byte) any {
+		if path == "/v3/pipeline" {
+			return okPipelineResponse()
+		}
+		entries := []string{`{"type":"step_begin","step":0,"cols":[{"name":"a"}]}`}
+		for i := 0; i < rowCount; i++ {
+			entries = append(entries, `{"type":"row","row":[{"type":"integer","value":"1"}]}`)
+		}
+		entries = append(entries, `{"type":"step_end","affected_row_count":0}`)
+		return cursorBody(entries...)
+	})
+	conn := NewConnector(server.URL, "", "", Config{}).Connect().(*hranaV2Conn)
+	conn.baton, conn.inTx, conn.begun = "tx-baton", true, true
+	ctx := context.Background()
+	dest := make([]driver.Value, 1)
+	rows, err := conn.QueryContext(ctx, "SELECT a FROM t", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Running a statement while the rows are read buffers the rest of the cursor, however large.
+	read := 0
+	for ; ; read++ {
+		err := rows.Next(dest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if read == 0 {
+			if _, err := conn.ExecContext(ctx, "UPDATE t SET a = 2", nil); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+	}
+	if read != rowCount {
+		t.Errorf("got %d rows, want %d", read, rowCount)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Closing the rows early reads the rest of the cursor without keeping it.
+	rows, err = conn.QueryContext(ctx, "SELECT a FROM t", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := rows.Next(dest); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cursor := rows.(*cursorRows)
+	if err := rows.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cursor.buffered) != 0 || !cursor.finished || conn.cursor != nil {
+		t.Errorf("the cursor should be read to its end without buffering")
+	}
+	if conn.baton != "cursor-baton" || conn.streamClosed {
+		t.Errorf("the stream of the transaction should be kept")
+	}
+}
+
+func TestCursorRowsCloseTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		_, _ = w.Write(cursorBody(
+			`{"type":"step_begin","step":0,"cols":[{"name":"a"}]}`,
+			`{"type":"row","row":[{"type":"integer","value":"1"}]}`,
+		))
+		w.(http.Flusher).Flush()
+		// The rest of the cursor never comes.
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	config := Config{Timeouts: shared.Timeouts{Request: 50 * time.Millisecond}}
+	conn := NewConnector(server.URL, "", "", config).Connect().(*hranaV2Conn)
+	conn.baton, conn.inTx, conn.begun = "tx-baton", true, true
+	rows, err := conn.QueryContext(context.Background(), "SELECT a FROM t", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := rows.Next(make([]driver.Value, 1)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- rows.Close() }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("expected an error from Close")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Close didn't return")
+	}
+	if !conn.streamClosed || conn.IsValid() {
+		t.Errorf("the connection should be unusable after losing its transaction")
+	}
+}
+
+func TestCursorRowsStepError(t *testing.T) {
+	server, _ := newTestServer(t, []string{"/v3"}, func(path string, body []byte) any {
+		return cursorBody(`{"type":"step_error","step":0,"error":{"message":"no such table: t","code":"SQLITE_ERROR"}}`)
+	})
+	conn := NewConnector(server.URL, "", "", Config{}).Connect().(*hranaV2Conn)
+	_, err := conn.QueryContext(context.Background(), "SELECT a FROM t", nil)
+	if err == nil || !strings.Contains(err.Error(), "no such table: t") {
+		t.Fatalf("got %v, want the step error", err)
+	}
+}
+
+func TestCursorRowsLazyBegin(t *testing.T) {
+	server, _ := newTestServer(t, []string{"/v3"}, func(path string, body []byte) any {
+		var req hrana.CursorRequest
+		_ = json.Unmarshal(body, &req)
+		if len(req.Batch.Steps) != 3 || *req.Batch.Steps[0].Stmt.Sql != "BEGIN" ||
+			*req.Batch.Steps[1].Stmt.Sql != "SAVEPOINT sp_1" || req.Batch.Steps[2].Condition == nil {
+			t.Errorf("unexpected cursor request %s", body)
+		}
+		return cursorBody(
+			`{"type":"step_begin","step":0,"cols":[]}`,
+			`{"type":"step_end","affected_row_count":0}`,
+			`{"type":"step_begin","step":1,"cols":[]}`,
+			`{"type":"step_end","affected_row_count":0}`,
+			`{"type":"step_begin","step":2,"cols":[{"name":"a"}]}`,
+			`{"type":"row","row":[{"type":"integer","value":"1"}]}`,
+			`{"type":"step_end","affected_row_count":0}`,
+		)
+	})
+	conn := NewConnector(server.URL, "", "", Config{}).Connect().(*hranaV2Conn)
+	ctx := context.Background()
+	if _, err := conn.BeginTx(ctx, driver.TxOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := conn.Savepoint(ctx, ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rows, err := conn.QueryContext(ctx, "SELECT a FROM t", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !conn.begun || len(conn.pending) > 0 {
+		t.Errorf("BEGIN and SAVEPOINT should have been sent")
+	}
+	if cols := rows.Columns(); len(cols) != 1 || cols[0] != "a" {
+		t.Errorf("unexpected columns %v", cols)
+	}
+	dest := make([]driver.Value, 1)
+	if err := rows.Next(dest); err != nil || dest[0] != int64(1) {
+		t.Errorf("got %v and error %v, want 1", dest[0], err)
+	}
+}
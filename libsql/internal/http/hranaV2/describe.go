@@ -0,0 +1,61 @@
+package hranaV2
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
+)
+
+var errDescribeUnsupported = errors.New("describing statements needs a server that speaks Hrana 2")
+
+// Describe returns the parameters and result columns of query without executing it.
+func (h *hranaV2Conn) Describe(ctx context.Context, query string) (*shared.StmtDescription, error) {
+	version, err := h.connector.protocolVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe SQL: %s\n%w", query, err)
+	}
+	if version < version2 {
+		return nil, errDescribeUnsupported
+	}
+	msg := &hrana.PipelineRequest{}
+	msg.Add(hrana.DescribeStream(query))
+	// The statement is not executed, so it can't change the session.
+	closeStream := h.canCloseStream(false)
+	if closeStream {
+		msg.Add(hrana.CloseStream())
+	}
+	result, err := h.sendPipelineRequest(ctx, msg, closeStream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe SQL: %s\n%w", query, err)
+	}
+	if result.Results[0].Error != nil {
+		return nil, fmt.Errorf("failed to describe SQL: %s\n%w", query, result.Results[0].Error.ToError(query, -1))
+	}
+	if result.Results[0].Response == nil {
+		return nil, fmt.Errorf("failed to describe SQL: %s\n%s", query, "no response received")
+	}
+	res, err := result.Results[0].Response.DescribeResult()
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe SQL: %s\n%w", query, err)
+	}
+	return res.Description(), nil
+}
+
+// Description returns the description of the statement, if it was described when prepared.
+func (s *hranaV2Stmt) Description() *shared.StmtDescription {
+	return s.desc
+}
+
+func (s *hranaV2Stmt) checkArgs(args []driver.NamedValue) error {
+	if s.desc == nil {
+		return nil
+	}
+	if err := s.desc.CheckArgs(args); err != nil {
+		return fmt.Errorf("failed to execute SQL: %s\n%w", s.sql, err)
+	}
+	return nil
+}
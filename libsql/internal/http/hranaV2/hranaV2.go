@@ -3,14 +3,13 @@ package hranaV2
 import (
 	"bytes"
 	"context"
-	"database/sql"
 	"database/sql/driver"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	net_url "net/url"
+	"reflect"
 	"runtime/debug"
 	"strings"
 	"time"
@@ -36,17 +35,18 @@ func init() {
 	commitHash = "unknown"
 }
 
-func Connect(url, jwt, host string) driver.Conn {
-	return &hranaV2Conn{url, jwt, host, "", false, 0}
-}
-
 type hranaV2Stmt struct {
 	conn     *hranaV2Conn
 	numInput int
 	sql      string
+	// sqlId references the SQL text stored on the stream.
+	sqlId int32
+	// desc is set when the connector describes statements as they are prepared.
+	desc *shared.StmtDescription
 }
 
 func (s *hranaV2Stmt) Close() error {
+	s.conn.storedSql.remove(s.sqlId)
 	return nil
 }
 
@@ -74,28 +74,71 @@ func (s *hranaV2Stmt) Query(args []driver.Value) (driver.Rows, error) {
 }
 
 func (s *hranaV2Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
-	return s.conn.ExecContext(ctx, s.sql, args)
+	if err := s.checkArgs(args); err != nil {
+		return nil, err
+	}
+	return s.conn.execContext(ctx, s.sql, s.sqlId, args)
 }
 
 func (s *hranaV2Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
-	return s.conn.QueryContext(ctx, s.sql, args)
+	if err := s.checkArgs(args); err != nil {
+		return nil, err
+	}
+	return s.conn.queryContext(ctx, s.sql, s.sqlId, args)
 }
 
 type hranaV2Conn struct {
+	connector        *Connector
 	url              string
-	jwt              string
-	host             string
 	baton            string
 	streamClosed     bool
 	replicationIndex uint64
-}
+	inTx             bool
+	// readOnly is set during read-only transactions, which reject writes before sending them.
+	readOnly bool
+	// onReplica is set while the stream lives on the read replica of the connector.
+	onReplica bool
+	storedSql storedSql
+	// lastUsed is when the stream last answered a request. It is used to detect idle streams.
+	lastUsed time.Time
+	// cursor is the cursor currently reading from the stream, if any.
+	cursor *cursorRows
+	// autocommit is the transaction state of the stream after the last request.
+	autocommit autocommitState
+	// sessionChanged is set once a statement changed state that lives on the stream, such as a
+	// setting. Such a stream is never closed with a statement, and the flag is only cleared by
+	// ResetSession once the stream is gone.
+	sessionChanged bool
+	// pending holds the statements of the transaction that were not sent yet: BEGIN, until begun
+	// is set, and savepoint statements. They travel with the next request. If one of them failed,
+	// pendingErr holds its error.
+	pending    []string
+	begun      bool
+	pendingErr error
+	savepoints shared.Savepoints
+	// idleTx rolls back the transaction once it stayed unused for idleTxTimeout. busy is set while
+	// a request is in flight, which doesn't count as idle time.
+	idleTx        shared.IdleTxTimer
+	idleTxTimeout time.Duration
+	busy          bool
+}
+
+// autocommitState tells whether a stream is outside of a transaction. Hrana 3 servers report it
+// with get_autocommit, which the connection sends along with each pipeline.
+type autocommitState int
+
+const (
+	autocommitUnknown autocommitState = iota
+	autocommitOn
+	autocommitOff
+)
 
 func (h *hranaV2Conn) Ping() error {
 	return h.PingContext(context.Background())
 }
 
 func (h *hranaV2Conn) PingContext(ctx context.Context) error {
-	_, err := h.executeStmt(ctx, "SELECT 1", nil, false)
+	_, err := h.executeStmt(ctx, "SELECT 1", 0, nil, false)
 	return err
 }
 
@@ -115,84 +158,174 @@ func (h *hranaV2Conn) PrepareContext(ctx context.Context, query string) (driver.
 	if len(paramInfos[0].NamedParameters) == 0 {
 		numInput = paramInfos[0].PositionalParametersCount
 	}
-	return &hranaV2Stmt{h, numInput, query}, nil
+	var desc *shared.StmtDescription
+	if h.connector.config.DescribeStatements {
+		// The server knows the parameters better than the local parser, which can't count
+		// named parameters.
+		desc, err = h.Describe(ctx, query)
+		switch {
+		case err == nil:
+			numInput = len(desc.Params)
+		case !errors.Is(err, errDescribeUnsupported):
+			return nil, err
+		}
+	}
+	return &hranaV2Stmt{h, numInput, query, h.storedSql.add(query), desc}, nil
 }
 
 func (h *hranaV2Conn) Close() error {
-	if h.baton != "" {
-		go func(baton, url, jwt, host string) {
-			msg := hrana.PipelineRequest{Baton: baton}
-			msg.Add(hrana.CloseStream())
-			_, _, _ = sendPipelineRequest(context.Background(), &msg, url, jwt, host)
-		}(h.baton, h.url, h.jwt, h.host)
+	if h.cursor != nil {
+		h.cursor.Close()
 	}
+	h.closeStream()
 	return nil
 }
 
-func (h *hranaV2Conn) Begin() (driver.Tx, error) {
-	return h.BeginTx(context.Background(), driver.TxOptions{})
-}
-
-type hranaV2Tx struct {
-	conn *hranaV2Conn
-}
-
-func (h hranaV2Tx) Commit() error {
-	_, err := h.conn.ExecContext(context.Background(), "COMMIT", nil)
-	return err
-}
-
-func (h hranaV2Tx) Rollback() error {
-	_, err := h.conn.ExecContext(context.Background(), "ROLLBACK", nil)
-	return err
-}
-
-func (h *hranaV2Conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
-	if opts.ReadOnly {
-		return nil, fmt.Errorf("read only transactions are not supported")
-	}
-	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
-		return nil, fmt.Errorf("isolation level %d is not supported", opts.Isolation)
-	}
-	_, err := h.ExecContext(ctx, "BEGIN", nil)
-	if err != nil {
-		return nil, err
+// closeStream closes the current stream in the background, so that the next request opens a new one.
+func (h *hranaV2Conn) closeStream() {
+	if h.baton != "" {
+		h.connector.closer.close(h.baton, h.url)
+		h.baton = ""
 	}
-	return &hranaV2Tx{h}, nil
 }
 
 func (h *hranaV2Conn) sendPipelineRequest(ctx context.Context, msg *hrana.PipelineRequest, streamClose bool) (*hrana.PipelineResponse, error) {
-	if h.streamClosed {
-		// If the stream is closed, we can't send any more requests using this connection.
-		return nil, fmt.Errorf("stream is closed: %w", driver.ErrBadConn)
+	var result hrana.PipelineResponse
+	var prefix []hrana.StreamRequest
+	var trackAutocommit bool
+	if err := h.pauseIdleTx(); err != nil {
+		return nil, err
 	}
-	if h.baton != "" {
+	h.busy = true
+	defer func() {
+		h.busy = false
+		h.armIdleTx()
+	}()
+	if h.pendingErr != nil {
+		return nil, h.pendingErr
+	}
+	requests := msg.Requests
+	var original hrana.StreamRequest
+	pending := len(h.pending)
+	// Pending transaction statements travel in a batch, so a request of another type is
+	// preceded by an empty batch that carries them.
+	carrier := pending > 0 && len(requests) > 0 && requests[0].Type != "execute" && requests[0].Type != "batch"
+	if carrier {
+		requests = append([]hrana.StreamRequest{{Type: "batch", Batch: &hrana.Batch{}}}, requests...)
+	}
+	if pending > 0 && len(requests) > 0 {
+		original = requests[0]
+		requests = append([]hrana.StreamRequest{withPending(h.pending, original)}, requests[1:]...)
+	}
+	err := h.retry(ctx, msg.Requests, func() error {
+		if err := h.prepareRequest(ctx); err != nil {
+			return err
+		}
+		if h.baton == "" {
+			// The request opens a new stream, which has no stored SQL yet.
+			h.storedSql.reset()
+		}
+		prefix = h.storedSql.prefix(requests)
+		msg.Requests = append(prefix, requests...)
+		version, err := h.connector.protocolVersion(ctx)
+		if err != nil {
+			return err
+		}
+		// A closed stream has no transaction state.
+		trackAutocommit = version == version3 && !streamClose
+		if trackAutocommit {
+			msg.Requests = append(msg.Requests, hrana.GetAutocommitStream())
+		}
 		msg.Baton = h.baton
-	}
-	if h.replicationIndex > 0 {
-		addReplicationIndex(msg, h.replicationIndex)
-	}
-	result, streamClosed, err := sendPipelineRequest(ctx, msg, h.url, h.jwt, h.host)
-	if streamClosed {
-		h.streamClosed = true
-	}
+		if h.replicationIndex > 0 {
+			addReplicationIndex(msg, h.replicationIndex)
+		}
+		var streamClosed bool
+		result, streamClosed, err = h.connector.sendPipelineRequest(ctx, msg, h.url)
+		if streamClosed {
+			h.streamClosed = true
+		}
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
+	if len(prefix) > 0 {
+		if len(result.Results) < len(prefix) {
+			return nil, fmt.Errorf("expected at least %d results, got %d", len(prefix), len(result.Results))
+		}
+		h.storedSql.update(prefix, result.Results)
+		result.Results = result.Results[len(prefix):]
+	}
+	h.autocommit = autocommitUnknown
+	if trackAutocommit && len(result.Results) == len(requests)+1 {
+		last := result.Results[len(requests)]
+		if last.Response != nil {
+			if autocommit, err := last.Response.GetAutocommit(); err == nil && autocommit {
+				h.autocommit = autocommitOn
+			} else if err == nil {
+				h.autocommit = autocommitOff
+			}
+		}
+		result.Results = result.Results[:len(requests)]
+	}
 	h.baton = result.Baton
 	if result.Baton == "" && !streamClose {
 		// We need to remember that the stream is closed so we don't try to send any more requests using this connection.
 		h.streamClosed = true
 	}
-	if result.BaseUrl != "" {
+	if streamClose {
+		// The next request opens a new stream.
+		h.baton = ""
+		h.url = h.baseURL()
+	} else if result.BaseUrl != "" {
 		h.url = result.BaseUrl
 	}
 	if idx := getReplicationIndex(&result); idx > h.replicationIndex {
 		h.replicationIndex = idx
 	}
+	h.lastUsed = time.Now()
+	if pending > 0 && len(requests) > 0 && len(result.Results) > 0 {
+		var step int
+		var pendingErr *hrana.Error
+		result.Results[0], step, pendingErr = withoutPending(pending, original, result.Results[0])
+		if pendingErr != nil {
+			return nil, h.pendingFailed(step, pendingErr)
+		}
+		h.pendingSent()
+	}
+	if carrier && len(result.Results) > 0 {
+		result.Results = result.Results[1:]
+	}
 	return &result, nil
 }
 
+// prepareRequest makes the stream available for a new request.
+func (h *hranaV2Conn) prepareRequest(ctx context.Context) error {
+	if h.cursor != nil {
+		h.cursor.drain()
+	}
+	if idle := h.connector.timeouts(ctx).IdleStream; h.baton != "" && idle > 0 && time.Since(h.lastUsed) > idle {
+		// The server has probably expired the stream already.
+		h.abandonStream()
+	}
+	if h.streamClosed {
+		// If the stream is closed, we can't send any more requests using this connection.
+		return fmt.Errorf("stream is closed: %w", driver.ErrBadConn)
+	}
+	return nil
+}
+
+// abandonStream forgets a stream whose state is unknown. Outside of a transaction the next
+// request opens a new stream, but a transaction is lost with its stream.
+func (h *hranaV2Conn) abandonStream() {
+	if h.inTx && h.begun {
+		h.streamClosed = true
+		return
+	}
+	h.baton = ""
+}
+
 func addReplicationIndex(msg *hrana.PipelineRequest, replicationIndex uint64) {
 	for i := range msg.Requests {
 		if msg.Requests[i].Stmt != nil && msg.Requests[i].Stmt.ReplicationIndex == nil {
@@ -229,69 +362,99 @@ func getReplicationIndex(response *hrana.PipelineResponse) uint64 {
 	return replicationIndex
 }
 
-func sendPipelineRequest(ctx context.Context, msg *hrana.PipelineRequest, url string, jwt string, host string) (result hrana.PipelineResponse, streamClosed bool, err error) {
-	reqBody, err := json.Marshal(msg)
+func (c *Connector) sendPipelineRequest(ctx context.Context, msg *hrana.PipelineRequest, url string) (result hrana.PipelineResponse, streamClosed bool, err error) {
+	ctx, cancel := shared.WithTimeout(ctx, c.timeouts(ctx).Request)
+	defer cancel()
+	version, err := c.protocolVersion(ctx)
 	if err != nil {
 		return hrana.PipelineResponse{}, false, err
 	}
-	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
-	defer cancel()
-	pipelineURL, err := net_url.JoinPath(url, "/v2/pipeline")
+	encoding := c.encoding(version)
+	reqBody, err := hrana.MarshalPipelineRequest(encoding, msg)
 	if err != nil {
 		return hrana.PipelineResponse{}, false, err
 	}
-	req, err := http.NewRequestWithContext(ctx, "POST", pipelineURL, bytes.NewReader(reqBody))
+	resp, streamClosed, err := c.sendRequest(ctx, url, c.endpointPath(version, "pipeline"), encoding, reqBody)
+	if err != nil {
+		return hrana.PipelineResponse{}, streamClosed, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return hrana.PipelineResponse{}, false, err
 	}
-	if len(jwt) > 0 {
-		req.Header.Set("Authorization", "Bearer "+jwt)
+	if err = hrana.UnmarshalPipelineResponse(encoding, body, &result); err != nil {
+		return hrana.PipelineResponse{}, false, err
+	}
+	return result, false, nil
+}
+
+// sendRequest posts reqBody to the endpoint and returns the response if the server accepted it.
+// The caller must close the response body.
+func (c *Connector) sendRequest(ctx context.Context, url, endpoint string, encoding hrana.Encoding, reqBody []byte) (resp *http.Response, streamClosed bool, err error) {
+	endpointURL, err := net_url.JoinPath(url, endpoint)
+	if err != nil {
+		return nil, false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpointURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, false, err
 	}
-	req.Header.Set("x-libsql-client-version", "libsql-remote-go-"+commitHash)
-	req.Host = host
-	resp, err := http.DefaultClient.Do(req)
+	c.setHeaders(req)
+	req.Header.Set("Content-Type", encoding.ContentType())
+	resp, err = c.client.Do(req)
 	if err != nil {
-		return hrana.PipelineResponse{}, false, err
+		return nil, false, newRequestError(err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, false, nil
 	}
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return hrana.PipelineResponse{}, false, err
+		return nil, false, err
 	}
-	if resp.StatusCode != http.StatusOK {
-		// We need to remember that the stream is closed so we don't try to send any more requests using this connection.
-		var serverError struct {
-			Error string `json:"error"`
-		}
-		if err := json.Unmarshal(body, &serverError); err == nil {
-			return hrana.PipelineResponse{}, true, fmt.Errorf("error code %d: %s", resp.StatusCode, serverError.Error)
-		}
-		var errResponse hrana.Error
-		if err := json.Unmarshal(body, &errResponse); err == nil {
-			if errResponse.Code != nil {
-				if *errResponse.Code == "STREAM_EXPIRED" {
-					return hrana.PipelineResponse{}, true, fmt.Errorf("error code %s: %s\n%w", *errResponse.Code, errResponse.Message, driver.ErrBadConn)
-				} else {
-					return hrana.PipelineResponse{}, true, fmt.Errorf("error code %s: %s", *errResponse.Code, errResponse.Message)
-				}
-			}
-			return hrana.PipelineResponse{}, true, errors.New(errResponse.Message)
-		}
-		return hrana.PipelineResponse{}, true, fmt.Errorf("error code %d: %s", resp.StatusCode, string(body))
+	// We need to remember that the stream is closed so we don't try to send any more requests using this connection.
+	return nil, true, newServerError(resp, body)
+}
+
+func responseEncoding(resp *http.Response) hrana.Encoding {
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), hrana.EncodingProtobuf.ContentType()) {
+		return hrana.EncodingProtobuf
 	}
-	if err = json.Unmarshal(body, &result); err != nil {
-		return hrana.PipelineResponse{}, false, err
+	return hrana.EncodingJSON
+}
+
+// executeStmt executes query, referencing it by sqlId if it is non-zero.
+func (h *hranaV2Conn) executeStmt(ctx context.Context, query string, sqlId int32, args []driver.NamedValue, wantRows bool) (*hrana.PipelineResponse, error) {
+	if err := h.checkReadOnly(query); err != nil {
+		return nil, fmt.Errorf("failed to execute SQL: %s\n%w", query, err)
 	}
-	return result, false, nil
+	// Outside of transactions the stream is closed in the same pipeline, so that the statement
+	// costs one round trip and leaves no stream for the server to expire.
+	changesSession := shared.ChangesSession(query)
+	return h.sendStmt(ctx, query, sqlId, args, wantRows, h.canCloseStream(changesSession), changesSession)
 }
 
-func (h *hranaV2Conn) executeStmt(ctx context.Context, query string, args []driver.NamedValue, wantRows bool) (*hrana.PipelineResponse, error) {
+// sendStmt executes query like executeStmt, and closes the stream in the same pipeline if closeStream
+// is set. changesSession tells whether query changes the session, see shared.ChangesSession.
+//
+// The SQL text of a prepared statement is only stored on a stream that is kept. A stream closed in
+// the same pipeline drops its stored SQL, so store_sql would send the text all the same and add a
+// request on top of it: such statements carry their SQL text instead.
+func (h *hranaV2Conn) sendStmt(ctx context.Context, query string, sqlId int32, args []driver.NamedValue, wantRows, closeStream, changesSession bool) (*hrana.PipelineResponse, error) {
 	stmts, params, err := shared.ParseStatementAndArgs(query, args)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute SQL: %s\n%w", query, err)
 	}
 	msg := &hrana.PipelineRequest{}
-	if len(stmts) == 1 {
+	if len(stmts) == 1 && sqlId != 0 && !closeStream {
+		executeStream, err := hrana.ExecuteStoredStream(sqlId, params[0], wantRows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute SQL: %s\n%w", query, err)
+		}
+		msg.Add(*executeStream)
+	} else if len(stmts) == 1 {
 		executeStream, err := hrana.ExecuteStream(stmts[0], params[0], wantRows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to execute SQL: %s\n%w", query, err)
@@ -304,14 +467,20 @@ func (h *hranaV2Conn) executeStmt(ctx context.Context, query string, args []driv
 		}
 		msg.Add(*batchStream)
 	}
+	if closeStream {
+		msg.Add(hrana.CloseStream())
+	}
 
-	result, err := h.sendPipelineRequest(ctx, msg, false)
+	result, err := h.sendPipelineRequest(ctx, msg, closeStream)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute SQL: %s\n%w", query, err)
 	}
+	if changesSession {
+		h.sessionChanged = true
+	}
 
 	if result.Results[0].Error != nil {
-		return nil, fmt.Errorf("failed to execute SQL: %s\n%s", query, result.Results[0].Error.Message)
+		return nil, fmt.Errorf("failed to execute SQL: %s\n%w", query, result.Results[0].Error.ToError(query, -1))
 	}
 	if result.Results[0].Response == nil {
 		return nil, fmt.Errorf("failed to execute SQL: %s\n%s", query, "no response received")
@@ -319,8 +488,77 @@ func (h *hranaV2Conn) executeStmt(ctx context.Context, query string, args []driv
 	return result, nil
 }
 
+// ExecBatch executes the batch in one request. The errors of failed steps are part of the result.
+func (h *hranaV2Conn) ExecBatch(ctx context.Context, batch *hrana.Batch) (*hrana.BatchResult, error) {
+	for _, step := range batch.Steps {
+		if step.Stmt.Sql == nil {
+			continue
+		}
+		if err := h.checkReadOnly(*step.Stmt.Sql); err != nil {
+			return nil, fmt.Errorf("failed to execute batch: %w", err)
+		}
+	}
+	changesSession := false
+	for _, step := range batch.Steps {
+		if step.Stmt.Sql != nil && shared.ChangesSession(*step.Stmt.Sql) {
+			changesSession = true
+			break
+		}
+	}
+	closeStream := h.canCloseStream(changesSession)
+	msg := &hrana.PipelineRequest{}
+	msg.Add(hrana.StreamRequest{Type: "batch", Batch: batch})
+	if closeStream {
+		msg.Add(hrana.CloseStream())
+	}
+	result, err := h.sendPipelineRequest(ctx, msg, closeStream)
+	if err == nil && changesSession {
+		h.sessionChanged = true
+	}
+	// sendPipelineRequest sets the replication index on the batch of the caller, which may be reused.
+	batch.ReplicationIndex = nil
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute batch: %w", err)
+	}
+	if result.Results[0].Error != nil {
+		return nil, fmt.Errorf("failed to execute batch: %w", result.Results[0].Error.ToError("", -1))
+	}
+	if result.Results[0].Response == nil {
+		return nil, fmt.Errorf("failed to execute batch: no response received")
+	}
+	return result.Results[0].Response.BatchResultWithErrors()
+}
+
+// canCloseStream reports whether a statement can run on a stream that is closed right after it.
+// The connection must not be in a transaction, its stream, if any, must not be in one either, and
+// neither the stream nor the statement, as told by changesSession, may hold state of the session.
+func (h *hranaV2Conn) canCloseStream(changesSession bool) bool {
+	if h.inTx || h.sessionChanged || (h.baton != "" && h.autocommit != autocommitOn) {
+		return false
+	}
+	return !changesSession
+}
+
+func (h *hranaV2Conn) checkReadOnly(query string) error {
+	if !h.readOnly {
+		return nil
+	}
+	return shared.CheckReadOnly(query)
+}
+
 func (h *hranaV2Conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
-	result, err := h.executeStmt(ctx, query, args, false)
+	return h.execContext(ctx, query, 0, args)
+}
+
+func (h *hranaV2Conn) execContext(ctx context.Context, query string, sqlId int32, args []driver.NamedValue) (driver.Result, error) {
+	if len(args) == 0 && h.connector.config.SequenceScripts && shared.IsScript(query) {
+		// The result of a script reports neither affected rows nor inserted ids.
+		if err := h.ExecScript(ctx, query); err != nil {
+			return nil, err
+		}
+		return shared.NewResult(0, 0), nil
+	}
+	result, err := h.executeStmt(ctx, query, sqlId, args, false)
 	if err != nil {
 		return nil, err
 	}
@@ -352,7 +590,8 @@ func (h *hranaV2Conn) ExecContext(ctx context.Context, query string, args []driv
 }
 
 type StmtResultRowsProvider struct {
-	r *hrana.StmtResult
+	r      *hrana.StmtResult
+	values *hrana.Values
 }
 
 func (p *StmtResultRowsProvider) SetsCount() int {
@@ -379,15 +618,26 @@ func (p *StmtResultRowsProvider) Columns(setIdx int) []string {
 	return res
 }
 
-func (p *StmtResultRowsProvider) FieldValue(setIdx, rowIdx, colIdx int) driver.Value {
+func (p *StmtResultRowsProvider) DeclTypes(setIdx int) []string {
 	if setIdx != 0 {
 		return nil
 	}
-	return p.r.Rows[rowIdx][colIdx].ToValue(p.r.Cols[colIdx].Type)
+	return hrana.DeclTypes(p.r.Cols)
 }
 
-func (p *StmtResultRowsProvider) Error(setIdx int) string {
-	return ""
+func (p *StmtResultRowsProvider) ScanType(declType string) reflect.Type {
+	return p.values.ScanType(declType)
+}
+
+func (p *StmtResultRowsProvider) FieldValue(setIdx, rowIdx, colIdx int) (driver.Value, error) {
+	if setIdx != 0 {
+		return nil, nil
+	}
+	return p.values.DecodeValue(p.r.Rows[rowIdx][colIdx], p.r.Cols[colIdx].Type)
+}
+
+func (p *StmtResultRowsProvider) Error(setIdx int) error {
+	return nil
 }
 
 func (p *StmtResultRowsProvider) HasResult(setIdx int) bool {
@@ -395,7 +645,9 @@ func (p *StmtResultRowsProvider) HasResult(setIdx int) bool {
 }
 
 type BatchResultRowsProvider struct {
-	r *hrana.BatchResult
+	r      *hrana.BatchResult
+	query  string
+	values *hrana.Values
 }
 
 func (p *BatchResultRowsProvider) SetsCount() int {
@@ -422,18 +674,30 @@ func (p *BatchResultRowsProvider) Columns(setIdx int) []string {
 	return res
 }
 
-func (p *BatchResultRowsProvider) FieldValue(setIdx, rowIdx, colIdx int) driver.Value {
+func (p *BatchResultRowsProvider) DeclTypes(setIdx int) []string {
 	if setIdx >= len(p.r.StepResults) || p.r.StepResults[setIdx] == nil {
 		return nil
 	}
-	return p.r.StepResults[setIdx].Rows[rowIdx][colIdx].ToValue(p.r.StepResults[setIdx].Cols[colIdx].Type)
+	return hrana.DeclTypes(p.r.StepResults[setIdx].Cols)
+}
+
+func (p *BatchResultRowsProvider) ScanType(declType string) reflect.Type {
+	return p.values.ScanType(declType)
+}
+
+func (p *BatchResultRowsProvider) FieldValue(setIdx, rowIdx, colIdx int) (driver.Value, error) {
+	if setIdx >= len(p.r.StepResults) || p.r.StepResults[setIdx] == nil {
+		return nil, nil
+	}
+	step := p.r.StepResults[setIdx]
+	return p.values.DecodeValue(step.Rows[rowIdx][colIdx], step.Cols[colIdx].Type)
 }
 
-func (p *BatchResultRowsProvider) Error(setIdx int) string {
+func (p *BatchResultRowsProvider) Error(setIdx int) error {
 	if setIdx >= len(p.r.StepErrors) || p.r.StepErrors[setIdx] == nil {
-		return ""
+		return nil
 	}
-	return p.r.StepErrors[setIdx].Message
+	return p.r.StepErrors[setIdx].ToError(p.query, setIdx)
 }
 
 func (p *BatchResultRowsProvider) HasResult(setIdx int) bool {
@@ -441,7 +705,18 @@ func (p *BatchResultRowsProvider) HasResult(setIdx int) bool {
 }
 
 func (h *hranaV2Conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
-	result, err := h.executeStmt(ctx, query, args, true)
+	return h.queryContext(ctx, query, 0, args)
+}
+
+func (h *hranaV2Conn) queryContext(ctx context.Context, query string, sqlId int32, args []driver.NamedValue) (driver.Rows, error) {
+	version, err := h.connector.protocolVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if version == version3 {
+		return h.queryCursor(ctx, version, query, sqlId, args)
+	}
+	result, err := h.executeStmt(ctx, query, sqlId, args, true)
 	if err != nil {
 		return nil, err
 	}
@@ -451,26 +726,72 @@ func (h *hranaV2Conn) QueryContext(ctx context.Context, query string, args []dri
 		if err != nil {
 			return nil, err
 		}
-		return shared.NewRows(&StmtResultRowsProvider{res}), nil
+		return shared.NewRows(&StmtResultRowsProvider{res, &h.connector.config.Values}), nil
 	case "batch":
 		res, err := result.Results[0].Response.BatchResult()
 		if err != nil {
 			return nil, err
 		}
-		return shared.NewRows(&BatchResultRowsProvider{res}), nil
+		return shared.NewRows(&BatchResultRowsProvider{res, query, &h.connector.config.Values}), nil
 	default:
 		return nil, fmt.Errorf("failed to execute SQL: %s\n%s", query, "unknown response type")
 	}
 }
 
+// ResetSession keeps the stream for the next user of the connection, unless a transaction was
+// left open on it, for example by executing BEGIN directly. Such streams are closed, which rolls
+// the transaction back. Only Hrana 3 servers report whether a transaction is open, so streams on
+// older servers are always closed.
+//
+// A kept stream keeps the state of its session as well, like a connection to SQLite would: the
+// settings and temporary tables are there for the next user of the connection. Statements then
+// keep running on that stream instead of closing a stream of their own, until the stream is
+// closed or expires.
 func (h *hranaV2Conn) ResetSession(ctx context.Context) error {
-	if h.baton != "" {
-		go func(baton, url, jwt, host string) {
-			msg := hrana.PipelineRequest{Baton: baton}
-			msg.Add(hrana.CloseStream())
-			_, _, _ = sendPipelineRequest(context.Background(), &msg, url, jwt, host)
-		}(h.baton, h.url, h.jwt, h.host)
-		h.baton = ""
+	if h.cursor != nil {
+		h.cursor.Close()
+	}
+	if err := h.prepareRequest(ctx); err != nil {
+		return err
+	}
+	if h.baton == "" {
+		// The state of the session was lost with its stream.
+		h.sessionChanged = false
+		return nil
+	}
+	if h.autocommit == autocommitUnknown {
+		h.refreshAutocommit(ctx)
+	}
+	if h.autocommit != autocommitOn {
+		h.closeStream()
+		h.sessionChanged = false
 	}
 	return nil
 }
+
+// refreshAutocommit asks a Hrana 3 server for the transaction state of the stream.
+func (h *hranaV2Conn) refreshAutocommit(ctx context.Context) {
+	version, err := h.connector.protocolVersion(ctx)
+	if err != nil || version != version3 {
+		return
+	}
+	// The pipeline carries get_autocommit on its own.
+	_, _ = h.sendPipelineRequest(ctx, &hrana.PipelineRequest{}, false)
+}
+
+// IsValid reports whether the connection can be returned to the pool. A connection whose stream
+// was closed by the server can't be used anymore.
+func (h *hranaV2Conn) IsValid() bool {
+	return !h.streamClosed
+}
+
+// CheckNamedValue converts arguments to the types the driver encodes, with the codecs and the
+// time format of the connector, see hrana.Values.
+func (h *hranaV2Conn) CheckNamedValue(nv *driver.NamedValue) error {
+	return h.connector.config.Values.CheckNamedValue(nv)
+}
+
+// Values returns how the connection converts arguments and results.
+func (h *hranaV2Conn) Values() *hrana.Values {
+	return &h.connector.config.Values
+}
@@ -0,0 +1,513 @@
+package hranaV2
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
+)
+
+func TestCloseStreamOutsideTransaction(t *testing.T) {
+	var pipelines [][]string
+	var batons []string
+	inTx := false
+	server, _ := newTestServer(t, []string{"/v3"}, func(_ string, body []byte) any {
+		var req hrana.PipelineRequest
+		_ = json.Unmarshal(body, &req)
+		pipelines = append(pipelines, requestTypes(&req))
+		batons = append(batons, req.Baton)
+		resp := hrana.PipelineResponse{Baton: "baton"}
+		for _, r := range req.Requests {
+			result := okResult(r)
+			for _, sql := range stmtSqls(r) {
+				switch sql {
+				case "BEGIN":
+					inTx = true
+				case "COMMIT":
+					inTx = false
+				}
+			}
+			switch r.Type {
+			case "get_autocommit":
+				autocommit := !inTx
+				result.Response.IsAutocommit = &autocommit
+			case "close":
+				resp.Baton = ""
+			}
+			resp.Results = append(resp.Results, result)
+		}
+		return resp
+	})
+	conn := NewConnector(server.URL, "", "", Config{}).Connect().(*hranaV2Conn)
+	ctx := context.Background()
+	exec := func(stmt string) {
+		t.Helper()
+		if _, err := conn.ExecContext(ctx, stmt, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	exec("SELECT 1")
+	exec("SELECT 1")
+	tx, err := conn.BeginTx(ctx, driver.TxOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	exec("SELECT 1")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	exec("SELECT 1")
+	wantPipelines := [][]string{
+		{"execute", "close"},
+		{"execute", "close"},
+		// BEGIN travels with the first statement of the transaction, and the stream is closed with COMMIT.
+		{"batch", "get_autocommit"},
+		{"execute", "close"},
+		{"execute", "close"},
+	}
+	if !reflect.DeepEqual(pipelines, wantPipelines) {
+		t.Errorf("got pipelines %q, want %q", pipelines, wantPipelines)
+	}
+	wantBatons := []string{"", "", "", "baton", ""}
+	if !reflect.DeepEqual(batons, wantBatons) {
+		t.Errorf("got batons %q, want %q", batons, wantBatons)
+	}
+	if conn.baton != "" || conn.streamClosed {
+		t.Errorf("the connection should have no stream and still be usable")
+	}
+}
+
+func TestKeepStreamWithSession(t *testing.T) {
+	var pipelines [][]string
+	var batons []string
+	server, _ := newTestServer(t, []string{"/v3"}, func(_ string, body []byte) any {
+		var req hrana.PipelineRequest
+		_ = json.Unmarshal(body, &req)
+		pipelines = append(pipelines, requestTypes(&req))
+		batons = append(batons, req.Baton)
+		resp := hrana.PipelineResponse{Baton: "baton"}
+		for _, r := range req.Requests {
+			result := okResult(r)
+			switch r.Type {
+			case "get_autocommit":
+				autocommit := true
+				result.Response.IsAutocommit = &autocommit
+			case "close":
+				resp.Baton = ""
+			}
+			resp.Results = append(resp.Results, result)
+		}
+		return resp
+	})
+	conn := NewConnector(server.URL, "", "", Config{}).Connect().(*hranaV2Conn)
+	ctx := context.Background()
+	for _, stmt := range []string{"PRAGMA foreign_keys=ON", "INSERT INTO t VALUES (1)", "INSERT INTO t VALUES (2)"} {
+		if _, err := conn.ExecContext(ctx, stmt, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	// The setting lives on the stream, so the statements after it must not close the stream.
+	wantPipelines := [][]string{
+		{"execute", "get_autocommit"},
+		{"execute", "get_autocommit"},
+		{"execute", "get_autocommit"},
+	}
+	if !reflect.DeepEqual(pipelines, wantPipelines) {
+		t.Errorf("got pipelines %q, want %q", pipelines, wantPipelines)
+	}
+	if wantBatons := []string{"", "baton", "baton"}; !reflect.DeepEqual(batons, wantBatons) {
+		t.Errorf("got batons %q, want %q", batons, wantBatons)
+	}
+	// The pool hands the setting to the next user of the connection along with the stream.
+	if err := conn.ResetSession(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if conn.baton != "baton" || !conn.sessionChanged {
+		t.Errorf("the stream should be kept with its session")
+	}
+	// Once the pool resets the connection, a stream that is gone no longer holds the setting.
+	conn.closeStream()
+	if err := conn.ResetSession(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if conn.sessionChanged {
+		t.Errorf("the session should be reset with its stream")
+	}
+}
+
+func TestLazyBeginError(t *testing.T) {
+	var requests int
+	server, _ := newTestServer(t, []string{"/v2"}, func(string, []byte) any {
+		requests++
+		return hrana.PipelineResponse{Baton: "baton", Results: []hrana.StreamResult{{
+			Type: "ok",
+			Response: &hrana.StreamResponse{
+				Type:   "batch",
+				Result: json.RawMessage(`{"step_results":[null,null],"step_errors":[{"message":"database is locked","code":"SQLITE_BUSY"},null]}`),
+			},
+		}}}
+	})
+	conn := NewConnector(server.URL, "", "", Config{}).Connect().(*hranaV2Conn)
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, driver.TxOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err := conn.ExecContext(ctx, "INSERT INTO t VALUES (1)", nil)
+		var libsqlErr *shared.Error
+		if !errors.As(err, &libsqlErr) || libsqlErr.Code != "SQLITE_BUSY" {
+			t.Errorf("got error %v, want the error of BEGIN", err)
+		}
+	}
+	if err := tx.Commit(); err == nil {
+		t.Errorf("Commit should return the error of BEGIN")
+	}
+	if requests != 1 {
+		t.Errorf("got %d requests, want 1", requests)
+	}
+	if conn.inTx || conn.pendingErr != nil {
+		t.Errorf("the transaction should be over")
+	}
+}
+
+func TestEagerBegin(t *testing.T) {
+	var pipelines [][]string
+	busy := true
+	server, _ := newTestServer(t, []string{"/v3"}, func(_ string, body []byte) any {
+		var req hrana.PipelineRequest
+		_ = json.Unmarshal(body, &req)
+		pipelines = append(pipelines, requestTypes(&req))
+		resp := hrana.PipelineResponse{Baton: "baton"}
+		for _, r := range req.Requests {
+			result := okResult(r)
+			if sqls := stmtSqls(r); len(sqls) == 1 && sqls[0] == "BEGIN IMMEDIATE" && busy {
+				code := "SQLITE_BUSY"
+				result = hrana.StreamResult{Type: "error", Error: &hrana.Error{Message: "database is locked", Code: &code}}
+			}
+			resp.Results = append(resp.Results, result)
+		}
+		return resp
+	})
+	conn := NewConnector(server.URL, "", "", Config{}).Connect().(*hranaV2Conn)
+	ctx := shared.ContextWithTxMode(context.Background(), shared.TxModeImmediate)
+	// The lock is taken by BeginTx, which returns SQLITE_BUSY.
+	_, err := conn.BeginTx(ctx, driver.TxOptions{})
+	var libsqlErr *shared.Error
+	if !errors.As(err, &libsqlErr) || libsqlErr.Code != "SQLITE_BUSY" {
+		t.Fatalf("got error %v, want the error of BEGIN", err)
+	}
+	if conn.inTx {
+		t.Errorf("the transaction should not have started")
+	}
+	busy = false
+	tx, err := conn.BeginTx(ctx, driver.TxOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !conn.begun || len(conn.pending) > 0 {
+		t.Errorf("BEGIN IMMEDIATE should have been sent")
+	}
+	if _, err := conn.ExecContext(ctx, "INSERT INTO t VALUES (1)", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wantPipelines := [][]string{
+		{"execute", "get_autocommit"},
+		{"execute", "get_autocommit"},
+		// The statements of the transaction no longer carry BEGIN.
+		{"execute", "get_autocommit"},
+		{"execute", "close"},
+	}
+	if !reflect.DeepEqual(pipelines, wantPipelines) {
+		t.Errorf("got pipelines %q, want %q", pipelines, wantPipelines)
+	}
+}
+
+func TestPendingBatch(t *testing.T) {
+	step := func(i int32) *int32 { return &i }
+	sql := "SELECT 1"
+	batch := &hrana.Batch{Steps: []hrana.BatchStep{
+		{Stmt: hrana.Stmt{Sql: &sql}},
+		{Stmt: hrana.Stmt{Sql: &sql}, Condition: &hrana.BatchCondition{
+			Type: "not", Cond: &hrana.BatchCondition{Type: "ok", Step: step(0)},
+		}},
+	}}
+	pending := []string{"BEGIN", "SAVEPOINT sp_1"}
+	got := pendingBatch(pending, batch)
+	beginOK := hrana.BatchCondition{Type: "ok", Step: step(0)}
+	savepointOK := hrana.BatchCondition{Type: "ok", Step: step(1)}
+	want := &hrana.Batch{Steps: []hrana.BatchStep{
+		{Stmt: hrana.Stmt{Sql: &pending[0]}},
+		{Stmt: hrana.Stmt{Sql: &pending[1]}, Condition: &beginOK},
+		{Stmt: hrana.Stmt{Sql: &sql}, Condition: &savepointOK},
+		{Stmt: hrana.Stmt{Sql: &sql}, Condition: &hrana.BatchCondition{Type: "and", Conds: []hrana.BatchCondition{
+			savepointOK,
+			{Type: "not", Cond: &hrana.BatchCondition{Type: "ok", Step: step(2)}},
+		}}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if *batch.Steps[1].Condition.Cond.Step != 0 {
+		t.Errorf("the conditions of the original batch should not change")
+	}
+}
+
+func TestIdleTxTimeout(t *testing.T) {
+	closed := make(chan string, 1)
+	server, _ := newTestServer(t, []string{"/v2"}, func(_ string, body []byte) any {
+		var req hrana.PipelineRequest
+		_ = json.Unmarshal(body, &req)
+		resp := hrana.PipelineResponse{Baton: "baton"}
+		for _, r := range req.Requests {
+			if r.Type == "close" {
+				closed <- req.Baton
+			}
+			resp.Results = append(resp.Results, okResult(r))
+		}
+		return resp
+	})
+	connector := NewConnector(server.URL, "", "", Config{Timeouts: shared.Timeouts{IdleTx: 50 * time.Millisecond}})
+	conn := connector.Connect().(*hranaV2Conn)
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, driver.TxOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := conn.ExecContext(ctx, "INSERT INTO t VALUES (1)", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	select {
+	case baton := <-closed:
+		if baton != "baton" {
+			t.Errorf("got baton %q, want the stream of the transaction", baton)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the idle transaction should be rolled back")
+	}
+	if _, err := conn.ExecContext(ctx, "INSERT INTO t VALUES (2)", nil); !errors.Is(err, shared.ErrTxIdleTimeout) {
+		t.Errorf("got error %v, want ErrTxIdleTimeout", err)
+	}
+	if err := tx.Commit(); !errors.Is(err, shared.ErrTxIdleTimeout) {
+		t.Errorf("got error %v, want ErrTxIdleTimeout", err)
+	}
+	if conn.IsValid() {
+		t.Errorf("the connection should be discarded")
+	}
+}
+
+func TestLazySavepoints(t *testing.T) {
+	var sent [][]string
+	server, _ := newTestServer(t, []string{"/v2"}, func(_ string, body []byte) any {
+		var req hrana.PipelineRequest
+		_ = json.Unmarshal(body, &req)
+		var sqls []string
+		resp := hrana.PipelineResponse{Baton: "baton"}
+		for _, r := range req.Requests {
+			sqls = append(sqls, stmtSqls(r)...)
+			resp.Results = append(resp.Results, okResult(r))
+		}
+		sent = append(sent, sqls)
+		return resp
+	})
+	conn := NewConnector(server.URL, "", "", Config{}).Connect().(*hranaV2Conn)
+	ctx := context.Background()
+	if _, err := conn.Savepoint(ctx, ""); err == nil {
+		t.Errorf("savepoints should need a transaction")
+	}
+	tx, err := conn.BeginTx(ctx, driver.TxOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mustSavepoint := func(name string) string {
+		t.Helper()
+		unique, err := conn.Savepoint(ctx, name)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return unique
+	}
+	outer := mustSavepoint("outer")
+	// A savepoint that is released before any statement is never sent.
+	if err := conn.ReleaseSavepoint(ctx, mustSavepoint("")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := conn.ExecContext(ctx, "INSERT INTO t VALUES (1)", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := conn.RollbackToSavepoint(ctx, outer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := conn.ReleaseSavepoint(ctx, outer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := conn.ReleaseSavepoint(ctx, outer); err == nil {
+		t.Errorf("a released savepoint should not be active")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := [][]string{
+		{"BEGIN", "SAVEPOINT outer_1", "INSERT INTO t VALUES (1)"},
+		{"ROLLBACK TO outer_1", "RELEASE outer_1", "COMMIT"},
+	}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("got %q, want %q", sent, want)
+	}
+}
+
+func TestExecScript(t *testing.T) {
+	testCases := []struct {
+		name          string
+		versions      []string
+		wantPipelines [][]string
+	}{
+		{
+			name:     "v3",
+			versions: []string{"/v3"},
+			wantPipelines: [][]string{
+				{"sequence", "get_autocommit"},
+				// Statements with arguments are still split by the driver. The script may have
+				// changed the session, so the stream is kept.
+				{"batch", "get_autocommit"},
+				// BEGIN travels in a batch of its own in front of the sequence, and the stream
+				// is kept after COMMIT as well.
+				{"batch", "sequence", "get_autocommit"},
+				{"execute", "get_autocommit"},
+			},
+		},
+		{
+			// Hrana 2 servers understand sequence requests too, but not get_autocommit.
+			name:     "v2",
+			versions: []string{"/v2"},
+			wantPipelines: [][]string{
+				{"sequence"},
+				{"batch"},
+				{"batch", "sequence"},
+				{"execute"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var pipelines [][]string
+			server, _ := newTestServer(t, tc.versions, func(_ string, body []byte) any {
+				var req hrana.PipelineRequest
+				_ = json.Unmarshal(body, &req)
+				pipelines = append(pipelines, requestTypes(&req))
+				resp := hrana.PipelineResponse{Baton: "baton"}
+				for _, r := range req.Requests {
+					result := okResult(r)
+					if r.Type == "get_autocommit" {
+						autocommit := true
+						result.Response.IsAutocommit = &autocommit
+					}
+					resp.Results = append(resp.Results, result)
+				}
+				return resp
+			})
+			conn := NewConnector(server.URL, "", "", Config{SequenceScripts: true}).Connect().(*hranaV2Conn)
+			ctx := context.Background()
+			script := "CREATE TABLE t (a); CREATE TRIGGER tr AFTER INSERT ON t BEGIN DELETE FROM t; END"
+			if _, err := conn.ExecContext(ctx, script, nil); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if _, err := conn.ExecContext(ctx, "INSERT INTO t VALUES (?); SELECT 1", []driver.NamedValue{{Ordinal: 1, Value: int64(1)}}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			tx, err := conn.BeginTx(ctx, driver.TxOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := conn.ExecScript(ctx, script); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(pipelines, tc.wantPipelines) {
+				t.Errorf("got pipelines %q, want %q", pipelines, tc.wantPipelines)
+			}
+		})
+	}
+}
+
+func TestPrepareDescribe(t *testing.T) {
+	// Hrana 2 servers describe statements too.
+	testCases := []struct {
+		name     string
+		versions []string
+	}{
+		{name: "v3", versions: []string{"/v3"}},
+		{name: "v2", versions: []string{"/v2"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var pipelines [][]string
+			server, _ := newTestServer(t, tc.versions, func(_ string, body []byte) any {
+				var req hrana.PipelineRequest
+				_ = json.Unmarshal(body, &req)
+				pipelines = append(pipelines, requestTypes(&req))
+				resp := hrana.PipelineResponse{Baton: "baton"}
+				for _, r := range req.Requests {
+					result := okResult(r)
+					if r.Type == "describe" {
+						result.Response.Result = json.RawMessage(`{"params":[{"name":":id"},{"name":":name"}],"cols":[{"name":"id","decltype":"INTEGER"}],"is_explain":false,"is_readonly":false}`)
+					}
+					resp.Results = append(resp.Results, result)
+				}
+				return resp
+			})
+			conn := NewConnector(server.URL, "", "", Config{DescribeStatements: true}).Connect().(*hranaV2Conn)
+			ctx := context.Background()
+			stmt, err := conn.PrepareContext(ctx, "INSERT INTO t VALUES (:id, :name) RETURNING id")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := stmt.NumInput(); got != 2 {
+				t.Errorf("got NumInput %d, want 2", got)
+			}
+			desc := stmt.(*hranaV2Stmt).Description()
+			if desc == nil {
+				t.Fatalf("the statement should be described")
+			}
+			if len(desc.Columns) != 1 || desc.Columns[0].DeclType != "INTEGER" {
+				t.Errorf("unexpected columns %+v", desc.Columns)
+			}
+			_, err = stmt.(driver.StmtExecContext).ExecContext(ctx, []driver.NamedValue{{Name: "id", Value: int64(1)}, {Name: "nme", Value: "a"}})
+			if err == nil {
+				t.Errorf("an argument without parameter should fail before being sent")
+			}
+			if want := [][]string{{"describe", "close"}}; !reflect.DeepEqual(pipelines, want) {
+				t.Errorf("got pipelines %q, want %q", pipelines, want)
+			}
+		})
+	}
+}
+
+func TestBatchResultColumnTypes(t *testing.T) {
+	name, declType := "id", "INTEGER"
+	rows := shared.NewRows(&BatchResultRowsProvider{r: &hrana.BatchResult{StepResults: []*hrana.StmtResult{
+		{Cols: []hrana.Column{{Name: &name}}},
+		{Cols: []hrana.Column{{Name: &name, Type: &declType}}},
+	}}})
+	types := rows.(driver.RowsColumnTypeDatabaseTypeName)
+	if got := types.ColumnTypeDatabaseTypeName(0); got != "" {
+		t.Errorf("got database type %q for an expression, want none", got)
+	}
+	if err := rows.(driver.RowsNextResultSet).NextResultSet(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := types.ColumnTypeDatabaseTypeName(0); got != "INTEGER" {
+		t.Errorf("got database type %q, want INTEGER", got)
+	}
+}
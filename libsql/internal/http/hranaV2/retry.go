@@ -0,0 +1,184 @@
+package hranaV2
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
+)
+
+// newServerError returns the error for a response of the server, or of a proxy in front of it.
+func newServerError(resp *http.Response, body []byte) *shared.Error {
+	// sqld sends {"error": ..., "code": ...} in JSON and a Hrana Error in protobuf. Any JSON
+	// object decodes into either shape, so a shape only counts if it carries a message.
+	var serverErr struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+	var errResponse hrana.Error
+	var err *shared.Error
+	switch {
+	case json.Unmarshal(body, &serverErr) == nil && serverErr.Error != "":
+		err = shared.NewHTTPError(resp.StatusCode, serverErr.Code, serverErr.Error)
+	case hrana.UnmarshalError(responseEncoding(resp), body, &errResponse) == nil && errResponse.Message != "":
+		code := ""
+		if errResponse.Code != nil {
+			code = *errResponse.Code
+		}
+		err = shared.NewHTTPError(resp.StatusCode, code, errResponse.Message)
+	default:
+		err = shared.NewHTTPError(resp.StatusCode, "", string(body))
+	}
+	err.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	if err.Code == "STREAM_EXPIRED" {
+		// database/sql retries bad connections on a new one.
+		err.Err = driver.ErrBadConn
+	}
+	return err
+}
+
+// newRequestError returns the error for a request that got no response.
+func newRequestError(err error) *shared.Error {
+	return &shared.Error{Step: -1, Err: err, Retryable: isConnectError(err)}
+}
+
+// isConnectError reports whether err happened before the request could be sent.
+// A connection dropped while waiting for the response doesn't qualify, since the server
+// may have executed the request.
+func isConnectError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// classifyError reports whether a request that failed with err can be sent again,
+// because it is known not to have executed anything on the server. A proxy may answer 502
+// after the server executed the request, so that error is only retried for requests that
+// can't write, as reported by readOnly.
+func classifyError(err error, readOnly func() bool) (reason shared.RetryReason, retryAfter time.Duration, ok bool) {
+	var libsqlErr *shared.Error
+	if !errors.As(err, &libsqlErr) {
+		return 0, 0, false
+	}
+	if libsqlErr.HTTPStatus == http.StatusBadGateway && readOnly() {
+		return shared.RetryReasonUnavailable, libsqlErr.RetryAfter, true
+	}
+	if !libsqlErr.Retryable {
+		return 0, 0, false
+	}
+	switch {
+	case libsqlErr.Code == "STREAM_EXPIRED":
+		return shared.RetryReasonStreamExpired, 0, true
+	case libsqlErr.HTTPStatus == http.StatusTooManyRequests:
+		return shared.RetryReasonRateLimited, libsqlErr.RetryAfter, true
+	case libsqlErr.HTTPStatus == http.StatusServiceUnavailable:
+		return shared.RetryReasonUnavailable, libsqlErr.RetryAfter, true
+	case libsqlErr.HTTPStatus == 0 && libsqlErr.Err != nil:
+		return shared.RetryReasonConnect, 0, true
+	}
+	return 0, 0, false
+}
+
+// retry calls send until it succeeds, or fails with an error that is not safe to retry.
+// A retry starts over on a new stream, so requests are only retried when the stream holds no
+// state: a transaction, including one the user started with BEGIN, settings or temporary tables.
+// requests are the requests that send sends, without the statements of a pending transaction.
+func (h *hranaV2Conn) retry(ctx context.Context, requests []hrana.StreamRequest, send func() error) error {
+	policy := h.connector.retryPolicy()
+	readOnly := func() bool {
+		return h.isReadOnly(requests)
+	}
+	for attempt := 1; ; attempt++ {
+		err := send()
+		if err == nil {
+			return nil
+		}
+		reason, retryAfter, ok := classifyError(err, readOnly)
+		if !ok || h.streamHoldsState() || attempt >= policy.MaxAttempts {
+			return err
+		}
+		delay := policy.Delay(attempt, retryAfter)
+		if policy.OnRetry != nil {
+			policy.OnRetry(shared.RetryEvent{Attempt: attempt, Reason: reason, Err: err, Delay: delay})
+		}
+		if err := shared.Sleep(ctx, delay); err != nil {
+			return err
+		}
+		// Nothing was executed on the stream, so the request can start over on a new one.
+		h.baton = ""
+		h.url = h.baseURL()
+		h.streamClosed = false
+	}
+}
+
+// streamHoldsState reports whether the current stream may hold state that a new stream would
+// lack. Without get_autocommit, a stream is assumed to be in a transaction.
+func (h *hranaV2Conn) streamHoldsState() bool {
+	if h.inTx && h.begun {
+		return true
+	}
+	return h.baton != "" && (h.autocommit != autocommitOn || h.sessionChanged)
+}
+
+// isReadOnly reports whether none of requests can write to the database, so that executing them
+// twice is harmless.
+func (h *hranaV2Conn) isReadOnly(requests []hrana.StreamRequest) bool {
+	readOnlySql := func(sql *string) bool {
+		return sql != nil && shared.CheckReadOnly(*sql) == nil
+	}
+	readOnlyStmt := func(stmt *hrana.Stmt) bool {
+		if stmt.Sql == nil && stmt.SqlId != nil {
+			sql, ok := h.storedSql.sqls[*stmt.SqlId]
+			return ok && readOnlySql(&sql)
+		}
+		return readOnlySql(stmt.Sql)
+	}
+	for _, request := range requests {
+		switch request.Type {
+		case "execute":
+			if !readOnlyStmt(request.Stmt) {
+				return false
+			}
+		case "batch":
+			for i := range request.Batch.Steps {
+				if !readOnlyStmt(&request.Batch.Steps[i].Stmt) {
+					return false
+				}
+			}
+		case "sequence":
+			if !readOnlySql(request.Sql) {
+				return false
+			}
+		case "describe", "store_sql", "close_sql", "get_autocommit", "close":
+		default:
+			return false
+		}
+	}
+	return true
+}
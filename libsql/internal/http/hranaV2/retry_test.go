@@ -0,0 +1,289 @@
+package hranaV2
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type failure struct {
+	status int
+	header map[string]string
+	body   string
+}
+
+// newFailingServer answers the pipeline requests with failures, in order, and then with success.
+// It records the baton of each pipeline request.
+func newFailingServer(t *testing.T, failures []failure, batons *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		var req hrana.PipelineRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		*batons = append(*batons, req.Baton)
+		if len(failures) > 0 {
+			f := failures[0]
+			failures = failures[1:]
+			for k, v := range f.header {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(f.status)
+			_, _ = w.Write([]byte(f.body))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(okPipelineResponse())
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRetry(t *testing.T) {
+	unavailable := failure{status: http.StatusServiceUnavailable, body: "unavailable"}
+	expired := failure{status: http.StatusBadRequest, body: `{"error":"stream expired","code":"STREAM_EXPIRED"}`}
+	badGateway := failure{status: http.StatusBadGateway, body: "bad gateway"}
+	testCases := []struct {
+		name        string
+		failures    []failure
+		query       string
+		inTx        bool
+		userTx      bool
+		session     bool
+		wantErr     bool
+		wantReasons []shared.RetryReason
+		wantBatons  []string
+	}{
+		{
+			name:        "unavailable",
+			failures:    []failure{unavailable, unavailable},
+			wantReasons: []shared.RetryReason{shared.RetryReasonUnavailable, shared.RetryReasonUnavailable},
+			wantBatons:  []string{"old", "", ""},
+		},
+		{
+			name:        "too many failures",
+			failures:    []failure{unavailable, unavailable, unavailable},
+			wantErr:     true,
+			wantReasons: []shared.RetryReason{shared.RetryReasonUnavailable, shared.RetryReasonUnavailable},
+			wantBatons:  []string{"old", "", ""},
+		},
+		{
+			name:        "rate limited",
+			failures:    []failure{{status: http.StatusTooManyRequests, header: map[string]string{"Retry-After": "1"}}},
+			wantReasons: []shared.RetryReason{shared.RetryReasonRateLimited},
+			wantBatons:  []string{"old", ""},
+		},
+		{
+			name:        "stream expired",
+			failures:    []failure{expired},
+			wantReasons: []shared.RetryReason{shared.RetryReasonStreamExpired},
+			wantBatons:  []string{"old", ""},
+		},
+		{
+			name:        "bad gateway",
+			failures:    []failure{badGateway},
+			wantReasons: []shared.RetryReason{shared.RetryReasonUnavailable},
+			wantBatons:  []string{"old", ""},
+		},
+		{
+			name:       "bad gateway on a write",
+			failures:   []failure{badGateway},
+			query:      "INSERT INTO t VALUES (1)",
+			wantErr:    true,
+			wantBatons: []string{"old"},
+		},
+		{
+			name:       "gateway timeout",
+			failures:   []failure{{status: http.StatusGatewayTimeout}},
+			wantErr:    true,
+			wantBatons: []string{"old"},
+		},
+		{
+			name:       "in transaction",
+			failures:   []failure{unavailable},
+			inTx:       true,
+			wantErr:    true,
+			wantBatons: []string{"old"},
+		},
+		{
+			name:       "transaction started with BEGIN",
+			failures:   []failure{expired},
+			userTx:     true,
+			wantErr:    true,
+			wantBatons: []string{"old"},
+		},
+		{
+			name:       "session changed",
+			failures:   []failure{unavailable},
+			session:    true,
+			wantErr:    true,
+			wantBatons: []string{"old"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var batons []string
+			var events []shared.RetryEvent
+			server := newFailingServer(t, tc.failures, &batons)
+			policy := shared.DefaultRetryPolicy
+			policy.InitialBackoff = time.Millisecond
+			policy.OnRetry = func(e shared.RetryEvent) {
+				events = append(events, e)
+			}
+			connector := NewConnector(server.URL, "", "", Config{RetryPolicy: &policy})
+			conn := connector.Connect().(*hranaV2Conn)
+			conn.baton = "old"
+			conn.inTx, conn.begun = tc.inTx, tc.inTx
+			conn.autocommit = autocommitOn
+			if tc.userTx {
+				conn.autocommit = autocommitOff
+			}
+			conn.sessionChanged = tc.session
+			// Do not wait for the Retry-After delay in tests.
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			query := tc.query
+			if query == "" {
+				query = "SELECT 1"
+			}
+			_, err := conn.ExecContext(ctx, query, nil)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tc.wantErr)
+			}
+			if len(events) != len(tc.wantReasons) {
+				t.Fatalf("got %d retries, want %d", len(events), len(tc.wantReasons))
+			}
+			for i, e := range events {
+				if e.Reason != tc.wantReasons[i] || e.Attempt != i+1 {
+					t.Errorf("got retry %+v, want reason %v at attempt %d", e, tc.wantReasons[i], i+1)
+				}
+				if e.Reason == shared.RetryReasonRateLimited && e.Delay < time.Second {
+					t.Errorf("the delay %v should respect Retry-After", e.Delay)
+				}
+			}
+			if len(batons) != len(tc.wantBatons) {
+				t.Fatalf("got batons %q, want %q", batons, tc.wantBatons)
+			}
+			for i := range batons {
+				if batons[i] != tc.wantBatons[i] {
+					t.Errorf("got batons %q, want %q", batons, tc.wantBatons)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryConnectError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+	attempts := 0
+	policy := shared.DefaultRetryPolicy
+	policy.InitialBackoff = time.Millisecond
+	policy.OnRetry = func(e shared.RetryEvent) {
+		if e.Reason != shared.RetryReasonConnect {
+			t.Errorf("got reason %v, want %v", e.Reason, shared.RetryReasonConnect)
+		}
+		attempts++
+	}
+	connector := NewConnector(url, "", "", Config{RetryPolicy: &policy})
+	// Skip the version probe, which would fail before any request is sent.
+	connector.version = version3
+	conn := connector.Connect().(*hranaV2Conn)
+	if _, err := conn.ExecContext(context.Background(), "SELECT 1", nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	if attempts != policy.MaxAttempts-1 {
+		t.Errorf("got %d retries, want %d", attempts, policy.MaxAttempts-1)
+	}
+}
+
+func TestServerError(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        []byte
+		want        shared.Error
+		wantBadConn bool
+	}{
+		{
+			name:        "stream expired",
+			status:      http.StatusBadRequest,
+			body:        []byte(`{"error":"stream expired","code":"STREAM_EXPIRED"}`),
+			want:        shared.Error{Code: "STREAM_EXPIRED", HTTPStatus: 400, Step: -1, Message: "stream expired", Retryable: true},
+			wantBadConn: true,
+		},
+		{
+			name:   "constraint",
+			status: http.StatusBadRequest,
+			body:   []byte(`{"error":"UNIQUE constraint failed: t.a","code":"SQLITE_CONSTRAINT_UNIQUE"}`),
+			want: shared.Error{Code: "SQLITE_CONSTRAINT_UNIQUE", PrimaryCode: 19, ExtendedCode: 2067, HTTPStatus: 400, Step: -1,
+				Message: "UNIQUE constraint failed: t.a"},
+		},
+		{
+			name:   "unauthorized",
+			status: http.StatusUnauthorized,
+			body:   []byte(`{"error":"invalid token"}`),
+			want:   shared.Error{HTTPStatus: 401, Step: -1, Message: "invalid token"},
+		},
+		{
+			name:   "hrana error",
+			status: http.StatusBadRequest,
+			body:   []byte(`{"message":"no such table: t","code":"SQLITE_ERROR"}`),
+			want:   shared.Error{Code: "SQLITE_ERROR", PrimaryCode: 1, ExtendedCode: 1, HTTPStatus: 400, Step: -1, Message: "no such table: t"},
+		},
+		{
+			name:   "other object",
+			status: http.StatusInternalServerError,
+			body:   []byte(`{"status":"down"}`),
+			want:   shared.Error{HTTPStatus: 500, Step: -1, Message: `{"status":"down"}`},
+		},
+		{
+			name:        "protobuf",
+			status:      http.StatusBadRequest,
+			contentType: "application/x-protobuf",
+			body:        protoError("busy", "SQLITE_BUSY"),
+			want:        shared.Error{Code: "SQLITE_BUSY", PrimaryCode: 5, ExtendedCode: 5, HTTPStatus: 400, Step: -1, Message: "busy", Retryable: true},
+		},
+		{
+			name:   "proxy",
+			status: http.StatusBadGateway,
+			body:   []byte("bad gateway"),
+			// The proxy may answer after the server executed the request.
+			want: shared.Error{HTTPStatus: 502, Step: -1, Message: "bad gateway"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			resp.Header.Set("Content-Type", tt.contentType)
+			err := newServerError(resp, tt.body)
+			if errors.Is(err, driver.ErrBadConn) != tt.wantBadConn {
+				t.Errorf("errors.Is(err, driver.ErrBadConn) should be %v", tt.wantBadConn)
+			}
+			err.Err = nil
+			if *err != tt.want {
+				t.Errorf("got %+v, want %+v", *err, tt.want)
+			}
+		})
+	}
+}
+
+func protoError(message, code string) []byte {
+	var w []byte
+	w = protowire.AppendTag(w, 1, protowire.BytesType)
+	w = protowire.AppendString(w, message)
+	w = protowire.AppendTag(w, 2, protowire.BytesType)
+	w = protowire.AppendString(w, code)
+	return w
+}
@@ -0,0 +1,85 @@
+package hranaV2
+
+import (
+	"context"
+	"errors"
+)
+
+var errNoTx = errors.New("savepoints can only be used in a transaction")
+
+// Savepoint creates a savepoint in the current transaction and returns its unique name.
+// Like BEGIN, the statement travels with the next request of the transaction.
+func (h *hranaV2Conn) Savepoint(_ context.Context, name string) (string, error) {
+	if err := h.checkSavepoints(); err != nil {
+		return "", err
+	}
+	unique, stmt, err := h.savepoints.Create(name)
+	if err != nil {
+		return "", err
+	}
+	h.pending = append(h.pending, stmt)
+	return unique, nil
+}
+
+// ReleaseSavepoint releases the savepoint and the ones created after it. Releasing a savepoint
+// that was not sent yet costs nothing: its statements are dropped.
+func (h *hranaV2Conn) ReleaseSavepoint(_ context.Context, name string) error {
+	if err := h.checkSavepoints(); err != nil {
+		return err
+	}
+	stmt, err := h.savepoints.Release(name)
+	if err != nil {
+		return err
+	}
+	if idx := h.pendingSavepoint(name); idx >= 0 {
+		h.pending = h.pending[:idx]
+		return nil
+	}
+	h.pending = append(h.pending, stmt)
+	return nil
+}
+
+// RollbackToSavepoint undoes the changes made since the savepoint, which stays active.
+// If the savepoint was not sent yet, nothing was done since, so only the statements queued
+// after it are dropped.
+func (h *hranaV2Conn) RollbackToSavepoint(_ context.Context, name string) error {
+	if err := h.checkSavepoints(); err != nil {
+		return err
+	}
+	stmt, err := h.savepoints.RollbackTo(name)
+	if err != nil {
+		return err
+	}
+	if idx := h.pendingSavepoint(name); idx >= 0 {
+		h.pending = h.pending[:idx+1]
+		return nil
+	}
+	h.pending = append(h.pending, stmt)
+	return nil
+}
+
+func (h *hranaV2Conn) checkSavepoints() error {
+	if !h.inTx {
+		return errNoTx
+	}
+	if h.pendingErr != nil {
+		return h.pendingErr
+	}
+	// The transaction may have expired while idle.
+	if err := h.idleTx.Pause(); err != nil {
+		return err
+	}
+	h.armIdleTx()
+	return nil
+}
+
+// pendingSavepoint returns the index of the SAVEPOINT statement of name in the pending
+// statements, or -1 if it was sent already.
+func (h *hranaV2Conn) pendingSavepoint(name string) int {
+	for i, stmt := range h.pending {
+		if stmt == "SAVEPOINT "+name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,29 @@
+package hranaV2
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+)
+
+// ExecScript executes the statements of script, separated by semicolons, with a sequence
+// request: the server splits and runs them, so the driver doesn't parse the script.
+//
+// Statements of a script may change the state of the session, so the stream is kept.
+func (h *hranaV2Conn) ExecScript(ctx context.Context, script string) error {
+	if err := h.checkReadOnly(script); err != nil {
+		return fmt.Errorf("failed to execute SQL: %s\n%w", script, err)
+	}
+	msg := &hrana.PipelineRequest{}
+	msg.Add(hrana.SequenceStream(script))
+	result, err := h.sendPipelineRequest(ctx, msg, false)
+	if err != nil {
+		return fmt.Errorf("failed to execute SQL: %s\n%w", script, err)
+	}
+	h.sessionChanged = true
+	if result.Results[0].Error != nil {
+		return fmt.Errorf("failed to execute SQL: %s\n%w", script, result.Results[0].Error.ToError(script, -1))
+	}
+	return nil
+}
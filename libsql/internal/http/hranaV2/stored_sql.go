@@ -0,0 +1,94 @@
+package hranaV2
+
+import (
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+)
+
+// storedSql tracks the SQL texts of the prepared statements of a connection, which are sent to
+// the server once with store_sql and then referenced by id.
+//
+// Stored SQL belongs to a stream, so a text is registered again when the connection moves to a new
+// stream. Registration is lazy: the store_sql request travels in the same pipeline as the first
+// statement that uses the id on the stream.
+type storedSql struct {
+	lastId int32
+	// sqls holds the texts of the open statements.
+	sqls map[int32]string
+	// registered holds the ids stored on the current stream.
+	registered map[int32]bool
+	// closed holds the ids of closed statements that are still stored on the current stream.
+	closed []int32
+}
+
+func (s *storedSql) add(sql string) int32 {
+	if s.sqls == nil {
+		s.sqls = make(map[int32]string)
+	}
+	s.lastId++
+	s.sqls[s.lastId] = sql
+	return s.lastId
+}
+
+// remove forgets a statement. If its text is stored on the current stream, close_sql is sent
+// with the next request.
+func (s *storedSql) remove(id int32) {
+	delete(s.sqls, id)
+	if s.registered[id] {
+		delete(s.registered, id)
+		s.closed = append(s.closed, id)
+	}
+}
+
+// reset forgets the registrations when the connection opens a new stream.
+func (s *storedSql) reset() {
+	s.registered = nil
+	s.closed = nil
+}
+
+func (s *storedSql) isRegistered(id int32) bool {
+	return s.registered[id]
+}
+
+// prefix returns the close_sql and store_sql requests that must precede requests on the current stream.
+func (s *storedSql) prefix(requests []hrana.StreamRequest) []hrana.StreamRequest {
+	var prefix []hrana.StreamRequest
+	for _, id := range s.closed {
+		prefix = append(prefix, hrana.CloseStoredSqlStream(id))
+	}
+	stored := map[int32]bool{}
+	store := func(stmt *hrana.Stmt) {
+		if stmt.SqlId == nil {
+			return
+		}
+		id := *stmt.SqlId
+		if sql, ok := s.sqls[id]; ok && !s.registered[id] && !stored[id] {
+			stored[id] = true
+			prefix = append(prefix, hrana.StoreSqlStream(sql, id))
+		}
+	}
+	for _, request := range requests {
+		if request.Stmt != nil {
+			store(request.Stmt)
+		}
+		if request.Batch != nil {
+			for i := range request.Batch.Steps {
+				store(&request.Batch.Steps[i].Stmt)
+			}
+		}
+	}
+	return prefix
+}
+
+// update records the outcome of the requests returned by prefix.
+func (s *storedSql) update(prefix []hrana.StreamRequest, results []hrana.StreamResult) {
+	s.closed = nil
+	for i, request := range prefix {
+		if request.Type != "store_sql" || i >= len(results) || results[i].Error != nil {
+			continue
+		}
+		if s.registered == nil {
+			s.registered = make(map[int32]bool)
+		}
+		s.registered[*request.SqlId] = true
+	}
+}
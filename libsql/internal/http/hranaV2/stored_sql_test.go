@@ -0,0 +1,129 @@
+package hranaV2
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+)
+
+// requestTypes describes each request of a pipeline as its type, followed by the sql_id it references.
+func requestTypes(req *hrana.PipelineRequest) []string {
+	var types []string
+	for _, r := range req.Requests {
+		switch {
+		case r.SqlId != nil:
+			types = append(types, fmt.Sprintf("%s %d", r.Type, *r.SqlId))
+		case r.Stmt != nil && r.Stmt.SqlId != nil:
+			types = append(types, fmt.Sprintf("%s %d", r.Type, *r.Stmt.SqlId))
+		default:
+			types = append(types, r.Type)
+		}
+	}
+	return types
+}
+
+func TestStoredSql(t *testing.T) {
+	var pipelines [][]string
+	server, _ := newTestServer(t, []string{"/v2"}, func(_ string, body []byte) any {
+		var req hrana.PipelineRequest
+		_ = json.Unmarshal(body, &req)
+		pipelines = append(pipelines, requestTypes(&req))
+		resp := hrana.PipelineResponse{Baton: "baton"}
+		for _, r := range req.Requests {
+			resp.Results = append(resp.Results, okResult(r))
+		}
+		return resp
+	})
+	conn := NewConnector(server.URL, "", "", Config{}).Connect().(*hranaV2Conn)
+	ctx := context.Background()
+	// Outside of transactions streams are closed after each statement, so nothing is stored there.
+	if _, err := conn.BeginTx(ctx, driver.TxOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	stmt, err := conn.PrepareContext(ctx, "INSERT INTO t VALUES (?)")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	exec := func() {
+		t.Helper()
+		if _, err := stmt.(driver.StmtExecContext).ExecContext(ctx, []driver.NamedValue{{Ordinal: 1, Value: int64(1)}}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	exec()
+	exec()
+	// A new stream does not know the stored SQL.
+	conn.baton = ""
+	exec()
+	if err := stmt.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := conn.ExecContext(ctx, "SELECT 1", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := [][]string{
+		// BEGIN travels with the first statement of the transaction.
+		{"store_sql 1", "batch"},
+		{"execute 1"},
+		{"store_sql 1", "execute 1"},
+		{"close_sql 1", "execute"},
+	}
+	if !reflect.DeepEqual(pipelines, want) {
+		t.Errorf("got pipelines %q, want %q", pipelines, want)
+	}
+}
+
+func TestStoredSqlAutocommit(t *testing.T) {
+	var pipelines [][]string
+	server, _ := newTestServer(t, []string{"/v2"}, func(_ string, body []byte) any {
+		var req hrana.PipelineRequest
+		_ = json.Unmarshal(body, &req)
+		pipelines = append(pipelines, requestTypes(&req))
+		for _, r := range req.Requests {
+			if r.Type == "execute" && r.Stmt.SqlId == nil && r.Stmt.Sql == nil {
+				t.Errorf("execute request without SQL")
+			}
+		}
+		resp := hrana.PipelineResponse{Baton: "baton"}
+		for _, r := range req.Requests {
+			resp.Results = append(resp.Results, okResult(r))
+		}
+		return resp
+	})
+	conn := NewConnector(server.URL, "", "", Config{}).Connect().(*hranaV2Conn)
+	ctx := context.Background()
+	stmt, err := conn.PrepareContext(ctx, "INSERT INTO t VALUES (?)")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	exec := func() {
+		t.Helper()
+		if _, err := stmt.(driver.StmtExecContext).ExecContext(ctx, []driver.NamedValue{{Ordinal: 1, Value: int64(1)}}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	// The stream is closed with each statement, so the SQL text travels with it.
+	exec()
+	exec()
+	// Once the session holds state the stream is kept, and the SQL text is stored on it.
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = ON", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	exec()
+	exec()
+	want := [][]string{
+		{"execute", "close"},
+		{"execute", "close"},
+		{"execute"},
+		{"store_sql 1", "execute 1"},
+		{"execute 1"},
+	}
+	if !reflect.DeepEqual(pipelines, want) {
+		t.Errorf("got pipelines %q, want %q", pipelines, want)
+	}
+}
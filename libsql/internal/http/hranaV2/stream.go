@@ -0,0 +1,94 @@
+package hranaV2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+)
+
+// Stream is a stream driven directly by the caller, request by request. Unlike connections, it
+// doesn't retry requests, store SQL or track transactions: the pipelines are sent as given.
+type Stream struct {
+	connector *Connector
+	baton     string
+	url       string
+	closed    bool
+	lastSqlId int32
+}
+
+// OpenStream returns a new stream. It is opened on the server by its first pipeline.
+func (c *Connector) OpenStream() *Stream {
+	return &Stream{connector: c, url: c.url}
+}
+
+// Pipeline sends requests on the stream and returns their results, in order. The stream is
+// closed once the server answered a close request or didn't return a baton.
+func (s *Stream) Pipeline(ctx context.Context, requests []hrana.StreamRequest) ([]hrana.StreamResult, error) {
+	if s.closed {
+		return nil, errors.New("stream is closed")
+	}
+	msg := &hrana.PipelineRequest{Baton: s.baton, Requests: requests}
+	result, streamClosed, err := s.connector.sendPipelineRequest(ctx, msg, s.url)
+	if err != nil {
+		if streamClosed {
+			s.closed = true
+		}
+		return nil, err
+	}
+	s.baton = result.Baton
+	if s.baton == "" {
+		s.closed = true
+	}
+	if result.BaseUrl != "" {
+		s.url = result.BaseUrl
+	}
+	if len(result.Results) != len(requests) {
+		return nil, fmt.Errorf("expected %d results, got %d", len(requests), len(result.Results))
+	}
+	return result.Results, nil
+}
+
+// NewSqlId returns an id for a SQL text stored on the stream.
+func (s *Stream) NewSqlId() int32 {
+	s.lastSqlId++
+	return s.lastSqlId
+}
+
+// Pipeline sends requests on the stream of the connection, for the libsql/hrana package. The
+// requests bypass the checks of read-only transactions. The stream of a transaction can't be
+// closed, since the transaction would be lost.
+func (h *hranaV2Conn) Pipeline(ctx context.Context, requests []hrana.StreamRequest) ([]hrana.StreamResult, error) {
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	streamClose := false
+	for _, request := range requests {
+		if request.Type == "close" {
+			streamClose = true
+		}
+	}
+	if streamClose && h.inTx {
+		return nil, errors.New("the stream of a transaction can't be closed")
+	}
+	resp, err := h.sendPipelineRequest(ctx, &hrana.PipelineRequest{Requests: requests}, streamClose)
+	if err != nil {
+		return nil, err
+	}
+	if !streamClose {
+		// The requests may have changed the state of the session in ways the connection doesn't see.
+		h.sessionChanged = true
+	}
+	if len(resp.Results) != len(requests) {
+		return nil, fmt.Errorf("expected %d results, got %d", len(requests), len(resp.Results))
+	}
+	return resp.Results, nil
+}
+
+// NewSqlId returns an id for a SQL text stored on the stream of the connection, which doesn't
+// clash with the ids of its prepared statements.
+func (h *hranaV2Conn) NewSqlId() int32 {
+	h.storedSql.lastId++
+	return h.storedSql.lastId
+}
@@ -0,0 +1,103 @@
+package hranaV2
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+)
+
+func TestStream(t *testing.T) {
+	var pipelines [][]string
+	var batons []string
+	server, _ := newTestServer(t, []string{"/v3"}, func(_ string, body []byte) any {
+		var req hrana.PipelineRequest
+		_ = json.Unmarshal(body, &req)
+		pipelines = append(pipelines, requestTypes(&req))
+		batons = append(batons, req.Baton)
+		resp := hrana.PipelineResponse{Baton: "baton"}
+		for _, r := range req.Requests {
+			if r.Type == "close" {
+				resp.Baton = ""
+			}
+			resp.Results = append(resp.Results, okResult(r))
+		}
+		return resp
+	})
+	stream := NewConnector(server.URL, "", "", Config{}).OpenStream()
+	ctx := context.Background()
+	id := stream.NewSqlId()
+	sql := "SELECT 1"
+	if _, err := stream.Pipeline(ctx, []hrana.StreamRequest{hrana.StoreSqlStream(sql, id)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	execute := hrana.StreamRequest{Type: "execute", Stmt: &hrana.Stmt{SqlId: &id}}
+	results, err := stream.Pipeline(ctx, []hrana.StreamRequest{execute, hrana.CloseStream()})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(results) != 2 || results[0].Response == nil || results[0].Response.Type != "execute" {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if _, err := stream.Pipeline(ctx, []hrana.StreamRequest{execute}); err == nil {
+		t.Errorf("a closed stream should not send requests")
+	}
+	// The pipelines are sent as given, without get_autocommit or stored SQL of their own.
+	wantPipelines := [][]string{{"store_sql 1"}, {"execute 1", "close"}}
+	if !reflect.DeepEqual(pipelines, wantPipelines) {
+		t.Errorf("got pipelines %q, want %q", pipelines, wantPipelines)
+	}
+	if wantBatons := []string{"", "baton"}; !reflect.DeepEqual(batons, wantBatons) {
+		t.Errorf("got batons %q, want %q", batons, wantBatons)
+	}
+}
+
+func TestConnPipeline(t *testing.T) {
+	var pipelines [][]string
+	server, _ := newTestServer(t, []string{"/v2"}, func(_ string, body []byte) any {
+		var req hrana.PipelineRequest
+		_ = json.Unmarshal(body, &req)
+		pipelines = append(pipelines, requestTypes(&req))
+		resp := hrana.PipelineResponse{Baton: "baton"}
+		for _, r := range req.Requests {
+			resp.Results = append(resp.Results, okResult(r))
+		}
+		return resp
+	})
+	conn := NewConnector(server.URL, "", "", Config{}).Connect().(*hranaV2Conn)
+	ctx := context.Background()
+	prepared, err := conn.PrepareContext(ctx, "SELECT 1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer prepared.Close()
+	tx, err := conn.BeginTx(ctx, driver.TxOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	id := conn.NewSqlId()
+	if id == prepared.(*hranaV2Stmt).sqlId {
+		t.Errorf("the id of stored SQL should not clash with prepared statements")
+	}
+	results, err := conn.Pipeline(ctx, []hrana.StreamRequest{hrana.StoreSqlStream("SELECT 2", id)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(results) != 1 || results[0].Response.Type != "store_sql" {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if _, err := conn.Pipeline(ctx, []hrana.StreamRequest{hrana.CloseStream()}); err == nil {
+		t.Errorf("the stream of a transaction should not be closed")
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// BEGIN travels in a batch of its own in front of the store_sql request.
+	wantPipelines := [][]string{{"batch", "store_sql 2"}, {"execute"}}
+	if !reflect.DeepEqual(pipelines, wantPipelines) {
+		t.Errorf("got pipelines %q, want %q", pipelines, wantPipelines)
+	}
+}
@@ -0,0 +1,270 @@
+package hranaV2
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
+)
+
+func (h *hranaV2Conn) Begin() (driver.Tx, error) {
+	return h.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+type hranaV2Tx struct {
+	conn *hranaV2Conn
+	// ctx is the context of BeginTx, which also bounds COMMIT and ROLLBACK.
+	ctx context.Context
+}
+
+func (h hranaV2Tx) Commit() error {
+	return h.conn.finishTx(h.ctx, "COMMIT")
+}
+
+func (h hranaV2Tx) Rollback() error {
+	return h.conn.finishTx(h.ctx, "ROLLBACK")
+}
+
+// BeginTx starts a transaction. Read-only transactions run on the read replica of the connector,
+// if it has one. The lock mode can be chosen with shared.ContextWithTxMode.
+//
+// A deferred BEGIN is not sent right away: it travels with the first statement of the
+// transaction, which only runs if BEGIN succeeded. An error of BEGIN is returned by that
+// statement and by Commit. Savepoint statements are delayed the same way. BEGIN IMMEDIATE and
+// BEGIN EXCLUSIVE take a lock, so they are sent by BeginTx, which returns their errors, such as
+// SQLITE_BUSY.
+func (h *hranaV2Conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	stmt, err := shared.BeginStatement(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.prepareRequest(ctx); err != nil {
+		return nil, err
+	}
+	if opts.ReadOnly && h.connector.config.ReplicaURL != "" {
+		h.closeStream()
+		h.url = h.connector.config.ReplicaURL
+		h.onReplica = true
+	}
+	h.inTx = true
+	h.readOnly = opts.ReadOnly
+	h.pending = []string{stmt}
+	h.begun = false
+	h.pendingErr = nil
+	h.idleTxTimeout = h.connector.timeouts(ctx).IdleTx
+	if stmt == "BEGIN IMMEDIATE" || stmt == "BEGIN EXCLUSIVE" {
+		h.pending = nil
+		if _, err := h.sendStmt(ctx, stmt, 0, nil, false, false, false); err != nil {
+			h.endTx()
+			return nil, err
+		}
+		h.begun = true
+	}
+	h.armIdleTx()
+	return &hranaV2Tx{h, ctx}, nil
+}
+
+// finishTx ends the transaction with COMMIT or ROLLBACK. Unless statements of the transaction
+// changed the state of the session, the stream is closed in the same pipeline, which saves the
+// request that would close it when the connection is released.
+func (h *hranaV2Conn) finishTx(ctx context.Context, stmt string) error {
+	defer h.endTx()
+	if err := h.idleTx.Pause(); err != nil {
+		// The transaction was already rolled back.
+		if stmt == "ROLLBACK" {
+			return nil
+		}
+		return fmt.Errorf("failed to execute SQL: %s\n%w", stmt, err)
+	}
+	if stmt == "ROLLBACK" && ctx.Err() != nil {
+		// database/sql rolls back transactions whose context is done. Closing the stream
+		// rolls back on the server without waiting for it.
+		h.closeStream()
+		return nil
+	}
+	if h.pendingErr != nil {
+		if stmt == "ROLLBACK" {
+			return nil
+		}
+		return fmt.Errorf("failed to execute SQL: %s\n%w", stmt, h.pendingErr)
+	}
+	if !h.begun {
+		// Nothing was sent, so there is nothing to end on the server.
+		return nil
+	}
+	if stmt == "ROLLBACK" {
+		// The savepoint statements that were not sent yet don't matter anymore.
+		h.pending = nil
+	}
+	closeStream := h.baton != "" && !h.sessionChanged
+	_, err := h.sendStmt(ctx, stmt, 0, nil, false, closeStream, false)
+	return err
+}
+
+// baseURL is the URL at which the connection opens new streams.
+func (h *hranaV2Conn) baseURL() string {
+	if h.onReplica {
+		return h.connector.config.ReplicaURL
+	}
+	return h.connector.url
+}
+
+func (h *hranaV2Conn) endTx() {
+	h.idleTx.Reset()
+	h.inTx = false
+	h.readOnly = false
+	h.pending = nil
+	h.begun = false
+	h.pendingErr = nil
+	h.savepoints.Reset()
+	if h.onReplica {
+		// Go back to the primary for the requests that follow.
+		h.closeStream()
+		h.url = h.connector.url
+		h.onReplica = false
+	}
+}
+
+// pendingBatch returns a batch that runs the pending statements one after the other and then
+// the steps of batch, if all of them succeeded. The conditions of the steps are shifted to account
+// for the pending steps.
+func pendingBatch(pending []string, batch *hrana.Batch) *hrana.Batch {
+	res := &hrana.Batch{ReplicationIndex: batch.ReplicationIndex}
+	var prevOK *hrana.BatchCondition
+	for i := range pending {
+		res.Add(hrana.Stmt{Sql: &pending[i]})
+		res.Steps[i].Condition = prevOK
+		step := int32(i)
+		prevOK = &hrana.BatchCondition{Type: "ok", Step: &step}
+	}
+	shift := int32(len(pending))
+	for _, step := range batch.Steps {
+		cond := *prevOK
+		if step.Condition != nil {
+			cond = hrana.BatchCondition{Type: "and", Conds: []hrana.BatchCondition{*prevOK, shiftCondition(*step.Condition, shift)}}
+		}
+		res.Steps = append(res.Steps, hrana.BatchStep{Stmt: step.Stmt, Condition: &cond})
+	}
+	return res
+}
+
+func shiftCondition(cond hrana.BatchCondition, shift int32) hrana.BatchCondition {
+	if cond.Step != nil {
+		step := *cond.Step + shift
+		cond.Step = &step
+	}
+	if cond.Cond != nil {
+		inner := shiftCondition(*cond.Cond, shift)
+		cond.Cond = &inner
+	}
+	if cond.Conds != nil {
+		conds := make([]hrana.BatchCondition, len(cond.Conds))
+		for i, c := range cond.Conds {
+			conds[i] = shiftCondition(c, shift)
+		}
+		cond.Conds = conds
+	}
+	return cond
+}
+
+// withPending turns a request of a transaction into a batch that starts with the pending statements.
+func withPending(pending []string, request hrana.StreamRequest) hrana.StreamRequest {
+	batch := request.Batch
+	if request.Type == "execute" {
+		batch = &hrana.Batch{}
+		batch.Add(*request.Stmt)
+	}
+	return hrana.StreamRequest{Type: "batch", Batch: pendingBatch(pending, batch)}
+}
+
+// withoutPending turns the result of a request built by withPending with n pending statements
+// back into the result of the original request. If a pending statement failed, it returns its
+// step and its error.
+func withoutPending(n int, original hrana.StreamRequest, result hrana.StreamResult) (hrana.StreamResult, int, *hrana.Error) {
+	if result.Response == nil {
+		return result, 0, nil
+	}
+	res, err := result.Response.BatchResultWithErrors()
+	if err != nil {
+		return hrana.StreamResult{Type: "error", Error: &hrana.Error{Message: err.Error()}}, 0, nil
+	}
+	for i := 0; i < n && i < len(res.StepErrors); i++ {
+		if res.StepErrors[i] != nil {
+			return result, i, res.StepErrors[i]
+		}
+	}
+	var stepResults []*hrana.StmtResult
+	if len(res.StepResults) > n {
+		stepResults = make([]*hrana.StmtResult, len(res.StepResults)-n)
+		copy(stepResults, res.StepResults[n:])
+	}
+	var stepErrors []*hrana.Error
+	if len(res.StepErrors) > n {
+		stepErrors = make([]*hrana.Error, len(res.StepErrors)-n)
+		copy(stepErrors, res.StepErrors[n:])
+	}
+	if original.Type != "execute" {
+		return hrana.StreamResult{Type: "ok", Response: hrana.NewBatchResponse(&hrana.BatchResult{
+			StepResults:      stepResults,
+			StepErrors:       stepErrors,
+			ReplicationIndex: res.ReplicationIndex,
+		})}, 0, nil
+	}
+	if len(stepErrors) > 0 && stepErrors[0] != nil {
+		return hrana.StreamResult{Type: "error", Error: stepErrors[0]}, 0, nil
+	}
+	if len(stepResults) == 0 || stepResults[0] == nil {
+		return hrana.StreamResult{Type: "error", Error: &hrana.Error{Message: "no result received for the statement of the transaction"}}, 0, nil
+	}
+	stmtResult := *stepResults[0]
+	if stmtResult.ReplicationIndex == nil {
+		stmtResult.ReplicationIndex = res.ReplicationIndex
+	}
+	return hrana.StreamResult{Type: "ok", Response: hrana.NewExecuteResponse(&stmtResult)}, 0, nil
+}
+
+// pendingSent records that the pending statements of the transaction succeeded.
+func (h *hranaV2Conn) pendingSent() {
+	h.pending = nil
+	h.begun = true
+}
+
+// pendingFailed records that the pending statement at step failed. The statements of the
+// transaction fail with the same error until it is rolled back.
+func (h *hranaV2Conn) pendingFailed(step int, err *hrana.Error) error {
+	stmt := h.pending[step]
+	if !h.begun && step == 0 {
+		h.pendingErr = fmt.Errorf("failed to begin the transaction\n%w", err.ToError(stmt, -1))
+	} else {
+		h.pendingErr = fmt.Errorf("failed to execute SQL: %s\n%w", stmt, err.ToError(stmt, -1))
+		// The transaction is open on the server. Closing the stream rolls it back.
+		h.closeStream()
+	}
+	h.pending = nil
+	h.begun = true
+	return h.pendingErr
+}
+
+// armIdleTx starts the idle timeout of the transaction once the connection is done with it.
+// A transaction is not idle while a request is in flight or a cursor is being read.
+func (h *hranaV2Conn) armIdleTx() {
+	if !h.inTx || h.busy || h.cursor != nil {
+		return
+	}
+	h.idleTx.Arm(h.idleTxTimeout, func() {
+		// Closing the stream rolls the transaction back on the server. The transaction
+		// can't be used anymore, so neither can the connection.
+		h.closeStream()
+		h.streamClosed = true
+	})
+}
+
+// pauseIdleTx stops the idle timeout of the transaction while the connection uses it.
+func (h *hranaV2Conn) pauseIdleTx() error {
+	if !h.inTx {
+		return nil
+	}
+	return h.idleTx.Pause()
+}
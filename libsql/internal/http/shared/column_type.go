@@ -0,0 +1,49 @@
+package shared
+
+import (
+	"reflect"
+	"strings"
+)
+
+var (
+	scanTypeInt64   = reflect.TypeOf(int64(0))
+	scanTypeFloat64 = reflect.TypeOf(float64(0))
+	scanTypeString  = reflect.TypeOf("")
+	scanTypeBytes   = reflect.TypeOf([]byte(nil))
+	scanTypeAny     = reflect.TypeOf(new(any)).Elem()
+)
+
+// DatabaseTypeName returns the declared type of a column in upper case, without its size
+// arguments, such as "VARCHAR" for "varchar(255)". It is empty for expressions.
+func DatabaseTypeName(declType string) string {
+	if idx := strings.IndexByte(declType, '('); idx >= 0 {
+		declType = declType[:idx]
+	}
+	return strings.ToUpper(strings.TrimSpace(declType))
+}
+
+// ScanType returns the Go type of the values of a column with the given declared type. It follows
+// the rules of SQLite that derive the affinity of a column from its declared type. The values of
+// columns without affinity, such as expressions, and with NUMERIC affinity can have any type.
+// The driver decodes the blobs of libSQL vector columns as slices, see VectorScanType. Times and
+// codecs depend on the connector, so the rows get their scan types from hrana.Values.ScanType.
+func ScanType(declType string) reflect.Type {
+	if t, ok := VectorScanType(declType); ok {
+		return t
+	}
+	name := DatabaseTypeName(declType)
+	switch {
+	case strings.Contains(name, "INT"):
+		return scanTypeInt64
+	case strings.Contains(name, "CHAR"), strings.Contains(name, "CLOB"), strings.Contains(name, "TEXT"):
+		return scanTypeString
+	case strings.Contains(name, "BLOB"):
+		return scanTypeBytes
+	case name == "":
+		return scanTypeAny
+	case strings.Contains(name, "REAL"), strings.Contains(name, "FLOA"), strings.Contains(name, "DOUB"):
+		return scanTypeFloat64
+	default:
+		return scanTypeAny
+	}
+}
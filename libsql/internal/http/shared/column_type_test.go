@@ -0,0 +1,33 @@
+package shared
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestColumnType(t *testing.T) {
+	tests := []struct {
+		declType string
+		wantName string
+		wantScan reflect.Type
+	}{
+		{"INTEGER", "INTEGER", reflect.TypeOf(int64(0))},
+		{"unsigned big int", "UNSIGNED BIG INT", reflect.TypeOf(int64(0))},
+		{"varchar(255)", "VARCHAR", reflect.TypeOf("")},
+		{"CLOB", "CLOB", reflect.TypeOf("")},
+		{"BLOB", "BLOB", reflect.TypeOf([]byte(nil))},
+		{"DOUBLE PRECISION", "DOUBLE PRECISION", reflect.TypeOf(float64(0))},
+		{"FLOATING POINT", "FLOATING POINT", reflect.TypeOf(int64(0))},
+		{"datetime", "DATETIME", reflect.TypeOf(new(any)).Elem()},
+		{"DECIMAL(10,5)", "DECIMAL", reflect.TypeOf(new(any)).Elem()},
+		{"", "", reflect.TypeOf(new(any)).Elem()},
+	}
+	for _, tt := range tests {
+		if got := DatabaseTypeName(tt.declType); got != tt.wantName {
+			t.Errorf("DatabaseTypeName(%q) = %q, want %q", tt.declType, got, tt.wantName)
+		}
+		if got := ScanType(tt.declType); got != tt.wantScan {
+			t.Errorf("ScanType(%q) = %v, want %v", tt.declType, got, tt.wantScan)
+		}
+	}
+}
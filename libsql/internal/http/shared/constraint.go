@@ -0,0 +1,161 @@
+package shared
+
+import (
+	"strings"
+)
+
+// ConstraintKind is the kind of constraint that a statement violated.
+type ConstraintKind int
+
+const (
+	// ConstraintOther covers the constraints without a kind of their own, such as RAISE in triggers.
+	ConstraintOther ConstraintKind = iota
+	ConstraintUnique
+	ConstraintPrimaryKey
+	ConstraintForeignKey
+	ConstraintNotNull
+	ConstraintCheck
+)
+
+func (k ConstraintKind) String() string {
+	switch k {
+	case ConstraintUnique:
+		return "UNIQUE"
+	case ConstraintPrimaryKey:
+		return "PRIMARY KEY"
+	case ConstraintForeignKey:
+		return "FOREIGN KEY"
+	case ConstraintNotNull:
+		return "NOT NULL"
+	case ConstraintCheck:
+		return "CHECK"
+	default:
+		return "OTHER"
+	}
+}
+
+// ConstraintError describes a constraint violation. It is found with errors.As on any error
+// that wraps an *Error for SQLITE_CONSTRAINT.
+type ConstraintError struct {
+	Kind ConstraintKind
+	// Table and Columns are set for UNIQUE, PRIMARY KEY and NOT NULL constraints on columns.
+	Table   string
+	Columns []string
+	// Constraint is the name of a CHECK constraint, or its expression when it has no name,
+	// and the name of the index for UNIQUE indexes on expressions.
+	Constraint string
+	Err        *Error
+}
+
+func (e *ConstraintError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// As lets errors.As find a *ConstraintError for constraint violations.
+func (e *Error) As(target any) bool {
+	t, ok := target.(**ConstraintError)
+	if !ok {
+		return false
+	}
+	constraintErr := parseConstraintError(e)
+	if constraintErr == nil {
+		return false
+	}
+	*t = constraintErr
+	return true
+}
+
+var constraintKinds = map[string]ConstraintKind{
+	"UNIQUE":      ConstraintUnique,
+	"PRIMARY KEY": ConstraintPrimaryKey,
+	"FOREIGN KEY": ConstraintForeignKey,
+	"NOT NULL":    ConstraintNotNull,
+	"CHECK":       ConstraintCheck,
+}
+
+// parseConstraintError extracts the details of a constraint violation from the SQLite message,
+// which sqld may prefix with its own text:
+//
+//	UNIQUE constraint failed: users.first, users.last
+//	UNIQUE constraint failed: index 'idx_lower_email'
+//	NOT NULL constraint failed: users.name
+//	CHECK constraint failed: age_positive
+//	FOREIGN KEY constraint failed
+//
+// It returns nil if err is not a constraint violation. Errors without a code only count when
+// their message is one of the above.
+func parseConstraintError(err *Error) *ConstraintError {
+	if err.PrimaryCode != sqliteConstraint && (err.PrimaryCode != 0 || !isConstraintMessage(err.Message)) {
+		return nil
+	}
+	idx := strings.Index(err.Message, " constraint failed")
+	res := &ConstraintError{Err: err}
+	switch err.ExtendedCode {
+	case sqliteExtendedCodes["SQLITE_CONSTRAINT_UNIQUE"]:
+		res.Kind = ConstraintUnique
+	case sqliteExtendedCodes["SQLITE_CONSTRAINT_PRIMARYKEY"], sqliteExtendedCodes["SQLITE_CONSTRAINT_ROWID"]:
+		res.Kind = ConstraintPrimaryKey
+	case sqliteExtendedCodes["SQLITE_CONSTRAINT_FOREIGNKEY"]:
+		res.Kind = ConstraintForeignKey
+	case sqliteExtendedCodes["SQLITE_CONSTRAINT_NOTNULL"]:
+		res.Kind = ConstraintNotNull
+	case sqliteExtendedCodes["SQLITE_CONSTRAINT_CHECK"]:
+		res.Kind = ConstraintCheck
+	}
+	if idx < 0 {
+		return res
+	}
+	// Servers that only report the primary code still send the message.
+	if res.Kind == ConstraintOther {
+		prefix := err.Message[:idx]
+		for name, kind := range constraintKinds {
+			if strings.HasSuffix(prefix, name) {
+				res.Kind = kind
+			}
+		}
+	}
+	details, ok := strings.CutPrefix(err.Message[idx+len(" constraint failed"):], ": ")
+	if !ok {
+		return res
+	}
+	if line := strings.IndexByte(details, '\n'); line >= 0 {
+		details = details[:line]
+	}
+	details = strings.TrimSpace(details)
+	switch res.Kind {
+	case ConstraintUnique, ConstraintPrimaryKey, ConstraintNotNull:
+		if name, ok := strings.CutPrefix(details, "index "); ok {
+			res.Constraint = strings.Trim(name, "'")
+			return res
+		}
+		for _, column := range strings.Split(details, ", ") {
+			table, name, ok := strings.Cut(column, ".")
+			if !ok {
+				continue
+			}
+			res.Table = table
+			res.Columns = append(res.Columns, name)
+		}
+	case ConstraintCheck:
+		res.Constraint = details
+	}
+	return res
+}
+
+// sqldErrorPrefix is the text sqld puts in front of the messages of SQLite.
+const sqldErrorPrefix = "SQLite error: "
+
+// isConstraintMessage reports whether message starts with "<KIND> constraint failed".
+func isConstraintMessage(message string) bool {
+	message = strings.TrimPrefix(message, sqldErrorPrefix)
+	for name := range constraintKinds {
+		if strings.HasPrefix(message, name+" constraint failed") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestConstraintError(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		message string
+		want    *ConstraintError
+	}{
+		{
+			name:    "unique",
+			code:    "SQLITE_CONSTRAINT_UNIQUE",
+			message: "SQLite error: UNIQUE constraint failed: users.email",
+			want:    &ConstraintError{Kind: ConstraintUnique, Table: "users", Columns: []string{"email"}},
+		},
+		{
+			name:    "unique on several columns",
+			code:    "SQLITE_CONSTRAINT_UNIQUE",
+			message: "UNIQUE constraint failed: users.first, users.last",
+			want:    &ConstraintError{Kind: ConstraintUnique, Table: "users", Columns: []string{"first", "last"}},
+		},
+		{
+			name:    "unique index on expression",
+			code:    "SQLITE_CONSTRAINT_UNIQUE",
+			message: "UNIQUE constraint failed: index 'idx_lower_email'",
+			want:    &ConstraintError{Kind: ConstraintUnique, Constraint: "idx_lower_email"},
+		},
+		{
+			name:    "primary key",
+			code:    "SQLITE_CONSTRAINT_PRIMARYKEY",
+			message: "UNIQUE constraint failed: users.id",
+			want:    &ConstraintError{Kind: ConstraintPrimaryKey, Table: "users", Columns: []string{"id"}},
+		},
+		{
+			name:    "not null",
+			code:    "SQLITE_CONSTRAINT_NOTNULL",
+			message: "NOT NULL constraint failed: users.name",
+			want:    &ConstraintError{Kind: ConstraintNotNull, Table: "users", Columns: []string{"name"}},
+		},
+		{
+			name:    "check",
+			code:    "SQLITE_CONSTRAINT_CHECK",
+			message: "CHECK constraint failed: age_positive",
+			want:    &ConstraintError{Kind: ConstraintCheck, Constraint: "age_positive"},
+		},
+		{
+			name:    "foreign key",
+			code:    "SQLITE_CONSTRAINT_FOREIGNKEY",
+			message: "FOREIGN KEY constraint failed",
+			want:    &ConstraintError{Kind: ConstraintForeignKey},
+		},
+		{
+			name:    "primary code only",
+			code:    "SQLITE_CONSTRAINT",
+			message: "NOT NULL constraint failed: users.name",
+			want:    &ConstraintError{Kind: ConstraintNotNull, Table: "users", Columns: []string{"name"}},
+		},
+		{
+			name:    "no code",
+			code:    "",
+			message: "SQLite error: UNIQUE constraint failed: users.email",
+			want:    &ConstraintError{Kind: ConstraintUnique, Table: "users", Columns: []string{"email"}},
+		},
+		{
+			name:    "no code, other message",
+			code:    "",
+			message: "the exclusion constraint failed to load",
+			want:    nil,
+		},
+		{
+			name:    "no code, kind inside the message",
+			code:    "",
+			message: "replication error: UNIQUE constraint failed: users.email",
+			want:    nil,
+		},
+		{
+			name:    "trigger",
+			code:    "SQLITE_CONSTRAINT_TRIGGER",
+			message: "not allowed",
+			want:    &ConstraintError{Kind: ConstraintOther},
+		},
+		{
+			name:    "not a constraint",
+			code:    "SQLITE_ERROR",
+			message: "no such table: users",
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewError(tt.code, tt.message)
+			wrapped := fmt.Errorf("failed to execute SQL: INSERT\n%w", err)
+			var constraintErr *ConstraintError
+			if !errors.As(wrapped, &constraintErr) {
+				if tt.want != nil {
+					t.Fatalf("errors.As found no constraint error, want %+v", tt.want)
+				}
+				return
+			}
+			if tt.want == nil {
+				t.Fatalf("got %+v, want no constraint error", constraintErr)
+			}
+			tt.want.Err = err
+			if !reflect.DeepEqual(constraintErr, tt.want) {
+				t.Errorf("got %+v, want %+v", constraintErr, tt.want)
+			}
+			var libsqlErr *Error
+			if !errors.As(constraintErr, &libsqlErr) || libsqlErr != err {
+				t.Errorf("the constraint error should wrap the original error")
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package shared
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// StmtDescription is the metadata of a statement, as reported by the server without executing it.
+type StmtDescription struct {
+	// Params holds the names of the parameters in order, with their prefix, such as ":id".
+	// Anonymous ? parameters have an empty name.
+	Params  []string
+	Columns []ColumnDescription
+	// IsExplain is set for EXPLAIN statements.
+	IsExplain bool
+	// IsReadOnly is set for statements that don't write to the database.
+	IsReadOnly bool
+}
+
+// ColumnDescription describes a column of the result of a statement.
+type ColumnDescription struct {
+	Name string
+	// DeclType is the declared type of the column, or empty for expressions.
+	DeclType string
+}
+
+// CheckArgs returns an error if args don't match the parameters of the statement. The number of
+// arguments is checked by database/sql, which gets it from NumInput.
+func (d *StmtDescription) CheckArgs(args []driver.NamedValue) error {
+	for _, arg := range args {
+		if arg.Name == "" {
+			if arg.Ordinal > len(d.Params) {
+				return fmt.Errorf("argument %d has no parameter: the statement has %d", arg.Ordinal, len(d.Params))
+			}
+			continue
+		}
+		if !d.hasParam(arg.Name) {
+			return fmt.Errorf("the statement has no parameter named %s", arg.Name)
+		}
+	}
+	return nil
+}
+
+func (d *StmtDescription) hasParam(name string) bool {
+	for _, param := range d.Params {
+		if len(param) > 1 && (param == name || param[1:] == name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package shared
+
+import (
+	"database/sql/driver"
+	"testing"
+)
+
+func TestCheckArgs(t *testing.T) {
+	desc := &StmtDescription{Params: []string{":id", "@name", ""}}
+	tests := []struct {
+		name    string
+		args    []driver.NamedValue
+		wantErr bool
+	}{
+		{"no args", nil, false},
+		{"named", []driver.NamedValue{{Name: "id"}, {Name: "name"}}, false},
+		{"named with prefix", []driver.NamedValue{{Name: ":id"}}, false},
+		{"positional", []driver.NamedValue{{Ordinal: 1}, {Ordinal: 3}}, false},
+		{"unknown name", []driver.NamedValue{{Name: "other"}}, true},
+		{"too many positional", []driver.NamedValue{{Ordinal: 4}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := desc.CheckArgs(tt.args); (err != nil) != tt.wantErr {
+				t.Errorf("CheckArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
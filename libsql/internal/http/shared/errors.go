@@ -0,0 +1,174 @@
+package shared
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Error is an error reported by the server, or a failure to reach it.
+type Error struct {
+	// Code is the Hrana error code, such as SQLITE_CONSTRAINT_UNIQUE or STREAM_EXPIRED.
+	// It is empty when the server didn't send one.
+	Code string
+	// PrimaryCode and ExtendedCode are the SQLite result codes matching Code, or zero
+	// if the error doesn't come from SQLite. ExtendedCode equals PrimaryCode when the
+	// server only reported the primary code, or an extended code unknown to the driver.
+	PrimaryCode  int
+	ExtendedCode int
+	// HTTPStatus is the status of the HTTP response that carried the error, if any.
+	HTTPStatus int
+	// SQL is the query that failed, if the error is about one. For multi-statement queries,
+	// Step tells which of its statements failed.
+	SQL string
+	// Step is the index of the failed statement in a batch or in a multi-statement query, or -1.
+	Step    int
+	Message string
+	// Retryable is set for transient failures, after which the same request may succeed. The
+	// driver retries network failures, rate limiting and expired streams itself, as allowed by
+	// the retry policy. SQLITE_BUSY and SQLITE_LOCKED are only a hint: the driver doesn't
+	// retry them, since the statement may belong to a transaction that must start over, so
+	// retrying is left to the caller.
+	Retryable bool
+	// RetryAfter is the delay requested by the server with the Retry-After header.
+	RetryAfter time.Duration
+	// Err is the underlying error, such as driver.ErrBadConn for an expired stream
+	// or the network error of a request that could not be sent.
+	Err error
+}
+
+// NewError returns the error for a Hrana error code and message.
+func NewError(code, message string) *Error {
+	primary, extended := sqliteCodes(code)
+	return &Error{
+		Code:         code,
+		PrimaryCode:  primary,
+		ExtendedCode: extended,
+		Step:         -1,
+		Message:      message,
+		Retryable:    code == "STREAM_EXPIRED" || primary == sqliteBusy || primary == sqliteLocked,
+	}
+}
+
+// NewHTTPError returns the error for a response with the given status.
+func NewHTTPError(status int, code, message string) *Error {
+	err := NewError(code, message)
+	err.HTTPStatus = status
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		err.Retryable = true
+	}
+	return err
+}
+
+func (e *Error) Error() string {
+	var msg string
+	switch {
+	case e.Code != "":
+		msg = fmt.Sprintf("error code %s: %s", e.Code, e.Message)
+	case e.HTTPStatus != 0:
+		msg = fmt.Sprintf("error code %d: %s", e.HTTPStatus, e.Message)
+	default:
+		msg = e.Message
+	}
+	if e.Err != nil {
+		if msg == "" {
+			return e.Err.Error()
+		}
+		msg += "\n" + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+const (
+	sqliteBusy       = 5
+	sqliteLocked     = 6
+	sqliteConstraint = 19
+)
+
+var sqlitePrimaryCodes = map[string]int{
+	"SQLITE_ERROR":      1,
+	"SQLITE_INTERNAL":   2,
+	"SQLITE_PERM":       3,
+	"SQLITE_ABORT":      4,
+	"SQLITE_BUSY":       sqliteBusy,
+	"SQLITE_LOCKED":     sqliteLocked,
+	"SQLITE_NOMEM":      7,
+	"SQLITE_READONLY":   8,
+	"SQLITE_INTERRUPT":  9,
+	"SQLITE_IOERR":      10,
+	"SQLITE_CORRUPT":    11,
+	"SQLITE_NOTFOUND":   12,
+	"SQLITE_FULL":       13,
+	"SQLITE_CANTOPEN":   14,
+	"SQLITE_PROTOCOL":   15,
+	"SQLITE_EMPTY":      16,
+	"SQLITE_SCHEMA":     17,
+	"SQLITE_TOOBIG":     18,
+	"SQLITE_CONSTRAINT": sqliteConstraint,
+	"SQLITE_MISMATCH":   20,
+	"SQLITE_MISUSE":     21,
+	"SQLITE_NOLFS":      22,
+	"SQLITE_AUTH":       23,
+	"SQLITE_FORMAT":     24,
+	"SQLITE_RANGE":      25,
+	"SQLITE_NOTADB":     26,
+	"SQLITE_NOTICE":     27,
+	"SQLITE_WARNING":    28,
+}
+
+var sqliteExtendedCodes = map[string]int{
+	"SQLITE_ERROR_MISSING_COLLSEQ":   1 | 1<<8,
+	"SQLITE_ERROR_RETRY":             1 | 2<<8,
+	"SQLITE_ERROR_SNAPSHOT":          1 | 3<<8,
+	"SQLITE_ABORT_ROLLBACK":          4 | 2<<8,
+	"SQLITE_BUSY_RECOVERY":           5 | 1<<8,
+	"SQLITE_BUSY_SNAPSHOT":           5 | 2<<8,
+	"SQLITE_BUSY_TIMEOUT":            5 | 3<<8,
+	"SQLITE_LOCKED_SHAREDCACHE":      6 | 1<<8,
+	"SQLITE_LOCKED_VTAB":             6 | 2<<8,
+	"SQLITE_READONLY_RECOVERY":       8 | 1<<8,
+	"SQLITE_READONLY_CANTLOCK":       8 | 2<<8,
+	"SQLITE_READONLY_ROLLBACK":       8 | 3<<8,
+	"SQLITE_READONLY_DBMOVED":        8 | 4<<8,
+	"SQLITE_READONLY_CANTINIT":       8 | 5<<8,
+	"SQLITE_READONLY_DIRECTORY":      8 | 6<<8,
+	"SQLITE_CORRUPT_VTAB":            11 | 1<<8,
+	"SQLITE_CORRUPT_SEQUENCE":        11 | 2<<8,
+	"SQLITE_CORRUPT_INDEX":           11 | 3<<8,
+	"SQLITE_CONSTRAINT_CHECK":        19 | 1<<8,
+	"SQLITE_CONSTRAINT_COMMITHOOK":   19 | 2<<8,
+	"SQLITE_CONSTRAINT_FOREIGNKEY":   19 | 3<<8,
+	"SQLITE_CONSTRAINT_FUNCTION":     19 | 4<<8,
+	"SQLITE_CONSTRAINT_NOTNULL":      19 | 5<<8,
+	"SQLITE_CONSTRAINT_PRIMARYKEY":   19 | 6<<8,
+	"SQLITE_CONSTRAINT_TRIGGER":      19 | 7<<8,
+	"SQLITE_CONSTRAINT_UNIQUE":       19 | 8<<8,
+	"SQLITE_CONSTRAINT_VTAB":         19 | 9<<8,
+	"SQLITE_CONSTRAINT_ROWID":        19 | 10<<8,
+	"SQLITE_CONSTRAINT_PINNED":       19 | 11<<8,
+	"SQLITE_CONSTRAINT_DATATYPE":     19 | 12<<8,
+	"SQLITE_NOTICE_RECOVER_WAL":      27 | 1<<8,
+	"SQLITE_NOTICE_RECOVER_ROLLBACK": 27 | 2<<8,
+	"SQLITE_AUTH_USER":               23 | 1<<8,
+}
+
+// sqliteCodes returns the SQLite result codes named by a Hrana error code. Extended codes
+// missing from the table still yield their primary code.
+func sqliteCodes(code string) (primary, extended int) {
+	if extended, ok := sqliteExtendedCodes[code]; ok {
+		return extended & 0xff, extended
+	}
+	if primary, ok := sqlitePrimaryCodes[code]; ok {
+		return primary, primary
+	}
+	if idx := strings.LastIndexByte(code, '_'); idx > 0 && strings.HasPrefix(code, "SQLITE_") {
+		return sqliteCodes(code[:idx])
+	}
+	return 0, 0
+}
@@ -0,0 +1,51 @@
+package shared
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestNewError(t *testing.T) {
+	tests := []struct {
+		code          string
+		wantPrimary   int
+		wantExtended  int
+		wantRetryable bool
+	}{
+		{"SQLITE_CONSTRAINT", 19, 19, false},
+		{"SQLITE_CONSTRAINT_UNIQUE", 19, 2067, false},
+		{"SQLITE_CONSTRAINT_PRIMARYKEY", 19, 1555, false},
+		{"SQLITE_IOERR_SHORT_READ", 10, 10, false},
+		{"SQLITE_BUSY", 5, 5, true},
+		{"STREAM_EXPIRED", 0, 0, true},
+		{"SQL_PARSE_ERROR", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		err := NewError(tt.code, "message")
+		if err.PrimaryCode != tt.wantPrimary || err.ExtendedCode != tt.wantExtended || err.Retryable != tt.wantRetryable {
+			t.Errorf("NewError(%q) = %+v, want codes %d/%d and retryable %v", tt.code, err, tt.wantPrimary, tt.wantExtended, tt.wantRetryable)
+		}
+	}
+}
+
+func TestErrorWrapping(t *testing.T) {
+	err := NewHTTPError(400, "STREAM_EXPIRED", "the stream has expired")
+	err.Err = driver.ErrBadConn
+	wrapped := fmt.Errorf("failed to execute SQL: SELECT 1\n%w", err)
+	var libsqlErr *Error
+	if !errors.As(wrapped, &libsqlErr) || libsqlErr.Code != "STREAM_EXPIRED" {
+		t.Errorf("errors.As should find the error")
+	}
+	if !errors.Is(wrapped, driver.ErrBadConn) {
+		t.Errorf("errors.Is should find the underlying error")
+	}
+	if got, want := err.Error(), "error code STREAM_EXPIRED: the stream has expired\ndriver: bad connection"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := NewHTTPError(401, "", "unauthorized").Error(), "error code 401: unauthorized"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
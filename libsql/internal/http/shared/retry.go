@@ -0,0 +1,108 @@
+package shared
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy controls how requests that failed for a transient reason are sent again.
+// Requests are only retried when doing so can't execute a statement twice or lose a transaction.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a request is sent, including the first one.
+	// A value of one disables retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. It grows by Multiplier on each
+	// following retry, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is the fraction of each delay that is randomized, between 0 and 1.
+	Jitter float64
+	// OnRetry is called before waiting for each retry, if set.
+	OnRetry func(RetryEvent)
+}
+
+// DefaultRetryPolicy is used by connectors that don't set a policy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// RetryReason classifies the errors that allow a request to be retried.
+type RetryReason int
+
+const (
+	// RetryReasonConnect means that no connection to the server could be opened.
+	RetryReasonConnect RetryReason = iota
+	// RetryReasonUnavailable means that a proxy in front of the server answered 503, or 502 to a
+	// request that can't write.
+	RetryReasonUnavailable
+	// RetryReasonRateLimited means that the server answered 429.
+	RetryReasonRateLimited
+	// RetryReasonStreamExpired means that the server no longer knew the stream of the request.
+	RetryReasonStreamExpired
+)
+
+func (r RetryReason) String() string {
+	switch r {
+	case RetryReasonConnect:
+		return "connect"
+	case RetryReasonUnavailable:
+		return "unavailable"
+	case RetryReasonRateLimited:
+		return "rate limited"
+	case RetryReasonStreamExpired:
+		return "stream expired"
+	default:
+		return "unknown"
+	}
+}
+
+// RetryEvent describes a failed attempt that is about to be retried.
+type RetryEvent struct {
+	// Attempt is the number of the attempt that failed, starting at one.
+	Attempt int
+	Reason  RetryReason
+	Err     error
+	// Delay is how long the driver waits before the next attempt.
+	Delay time.Duration
+}
+
+// Delay returns how long to wait after the given failed attempt. The delay is never shorter
+// than retryAfter, which holds the Retry-After header of the response, if any.
+func (p RetryPolicy) Delay(attempt int, retryAfter time.Duration) time.Duration {
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		backoff *= p.Multiplier
+		if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		backoff -= backoff * p.Jitter * rand.Float64()
+	}
+	delay := time.Duration(backoff)
+	if delay < retryAfter {
+		delay = retryAfter
+	}
+	return delay
+}
+
+// Sleep waits for d, or until ctx is done.
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -4,14 +4,20 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"io"
+	"reflect"
 )
 
 type rowsProvider interface {
 	SetsCount() int
 	RowsCount(setIdx int) int
 	Columns(setIdx int) []string
-	FieldValue(setIdx, rowIdx int, columnIdx int) driver.Value
-	Error(setIdx int) string
+	// DeclTypes returns the declared types of the columns, which are empty for expressions.
+	DeclTypes(setIdx int) []string
+	// ScanType returns the type of the values that FieldValue returns for the columns declared
+	// as declType.
+	ScanType(declType string) reflect.Type
+	FieldValue(setIdx, rowIdx int, columnIdx int) (driver.Value, error)
+	Error(setIdx int) error
 	HasResult(setIdx int) bool
 }
 
@@ -29,6 +35,20 @@ func (r *rows) Columns() []string {
 	return r.result.Columns(r.currentResultSetIndex)
 }
 
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	return DatabaseTypeName(r.result.DeclTypes(r.currentResultSetIndex)[index])
+}
+
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	return r.result.ScanType(r.result.DeclTypes(r.currentResultSetIndex)[index])
+}
+
+// ColumnTypeNullable reports every column as nullable: SQLite doesn't tell which columns of a
+// result can't hold NULL.
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return true, true
+}
+
 func (r *rows) Close() error {
 	return nil
 }
@@ -39,7 +59,11 @@ func (r *rows) Next(dest []driver.Value) error {
 	}
 	count := len(r.result.Columns(r.currentResultSetIndex))
 	for idx := 0; idx < count; idx++ {
-		dest[idx] = r.result.FieldValue(r.currentResultSetIndex, r.currentRowIdx, idx)
+		v, err := r.result.FieldValue(r.currentResultSetIndex, r.currentRowIdx, idx)
+		if err != nil {
+			return err
+		}
+		dest[idx] = v
 	}
 	r.currentRowIdx++
 	return nil
@@ -57,9 +81,8 @@ func (r *rows) NextResultSet() error {
 	r.currentResultSetIndex++
 	r.currentRowIdx = 0
 
-	errStr := r.result.Error(r.currentResultSetIndex)
-	if errStr != "" {
-		return fmt.Errorf("failed to execute statement\n%s", errStr)
+	if err := r.result.Error(r.currentResultSetIndex); err != nil {
+		return fmt.Errorf("failed to execute statement\n%w", err)
 	}
 	if !r.result.HasResult(r.currentResultSetIndex) {
 		return fmt.Errorf("no results for statement")
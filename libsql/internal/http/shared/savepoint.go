@@ -0,0 +1,72 @@
+package shared
+
+import (
+	"fmt"
+)
+
+// Savepoints tracks the active savepoints of a transaction, from the outermost to the innermost.
+type Savepoints struct {
+	seq    int
+	active []string
+}
+
+// Create returns a unique name for a new savepoint based on name, and the statement that creates it.
+func (s *Savepoints) Create(name string) (unique, stmt string, err error) {
+	if name == "" {
+		name = "sp"
+	}
+	if !isIdentifier(name) {
+		return "", "", fmt.Errorf("invalid savepoint name %q: only letters, digits and underscores are allowed", name)
+	}
+	s.seq++
+	unique = fmt.Sprintf("%s_%d", name, s.seq)
+	s.active = append(s.active, unique)
+	return unique, "SAVEPOINT " + unique, nil
+}
+
+// Release forgets the savepoint and the ones created after it, and returns the statement that releases them.
+func (s *Savepoints) Release(name string) (string, error) {
+	idx, err := s.find(name)
+	if err != nil {
+		return "", err
+	}
+	s.active = s.active[:idx]
+	return "RELEASE " + name, nil
+}
+
+// RollbackTo forgets the savepoints created after name, which stays active, and returns the
+// statement that rolls back to it.
+func (s *Savepoints) RollbackTo(name string) (string, error) {
+	idx, err := s.find(name)
+	if err != nil {
+		return "", err
+	}
+	s.active = s.active[:idx+1]
+	return "ROLLBACK TO " + name, nil
+}
+
+// Reset forgets all savepoints when the transaction ends.
+func (s *Savepoints) Reset() {
+	s.active = nil
+}
+
+func (s *Savepoints) find(name string) (int, error) {
+	for i := len(s.active) - 1; i >= 0; i-- {
+		if s.active[i] == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("savepoint %s is not active", name)
+}
+
+func isIdentifier(name string) bool {
+	for i, c := range name {
+		switch {
+		case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,33 @@
+package shared
+
+import (
+	"testing"
+)
+
+func TestSavepoints(t *testing.T) {
+	var s Savepoints
+	outer, stmt, err := s.Create("")
+	if err != nil || outer != "sp_1" || stmt != "SAVEPOINT sp_1" {
+		t.Fatalf("got %q, %q, %v", outer, stmt, err)
+	}
+	inner, _, _ := s.Create("inner")
+	innermost, _, _ := s.Create("inner")
+	if inner != "inner_2" || innermost != "inner_3" {
+		t.Errorf("names should be unique, got %q and %q", inner, innermost)
+	}
+	if stmt, err := s.RollbackTo(inner); err != nil || stmt != "ROLLBACK TO inner_2" {
+		t.Errorf("got %q, %v", stmt, err)
+	}
+	if _, err := s.Release(innermost); err == nil {
+		t.Errorf("rolling back to a savepoint should forget the ones created after it")
+	}
+	if stmt, err := s.Release(outer); err != nil || stmt != "RELEASE sp_1" {
+		t.Errorf("got %q, %v", stmt, err)
+	}
+	if _, err := s.RollbackTo(inner); err == nil {
+		t.Errorf("releasing a savepoint should forget the ones created after it")
+	}
+	if _, _, err := s.Create("x; DROP TABLE t"); err == nil {
+		t.Errorf("invalid names should be rejected")
+	}
+}
@@ -0,0 +1,59 @@
+package shared
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts bounds the time the driver waits for the server. A zero field leaves the
+// timeout to the connector settings or their default, and a negative one disables it.
+type Timeouts struct {
+	// Dial bounds opening a connection, including the TLS and WebSocket handshakes.
+	Dial time.Duration
+	// Request bounds a single request, from sending it until its response has started.
+	Request time.Duration
+	// IdleStream is how long a stream may stay unused before the driver stops reusing it.
+	IdleStream time.Duration
+	// IdleTx is how long a transaction may stay unused before the driver rolls it back.
+	IdleTx time.Duration
+}
+
+// Override returns t with the fields that are set in o replaced.
+func (t Timeouts) Override(o Timeouts) Timeouts {
+	if o.Dial != 0 {
+		t.Dial = o.Dial
+	}
+	if o.Request != 0 {
+		t.Request = o.Request
+	}
+	if o.IdleStream != 0 {
+		t.IdleStream = o.IdleStream
+	}
+	if o.IdleTx != 0 {
+		t.IdleTx = o.IdleTx
+	}
+	return t
+}
+
+type timeoutsKey struct{}
+
+// ContextWithTimeouts returns a context that overrides the connector timeouts for the calls made with it.
+// Overrides of the parent context that are not replaced by timeouts stay in effect.
+func ContextWithTimeouts(ctx context.Context, timeouts Timeouts) context.Context {
+	return context.WithValue(ctx, timeoutsKey{}, TimeoutsFromContext(ctx).Override(timeouts))
+}
+
+// TimeoutsFromContext returns the overrides stored by ContextWithTimeouts.
+func TimeoutsFromContext(ctx context.Context) Timeouts {
+	timeouts, _ := ctx.Value(timeoutsKey{}).(Timeouts)
+	return timeouts
+}
+
+// WithTimeout is context.WithTimeout, except that a timeout of zero or less means no timeout.
+// The deadline of ctx still applies if it comes first.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
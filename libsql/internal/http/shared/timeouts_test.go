@@ -0,0 +1,61 @@
+package shared
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestContextWithTimeouts(t *testing.T) {
+	ctx := ContextWithTimeouts(context.Background(), Timeouts{Dial: time.Second, Request: time.Second})
+	ctx = ContextWithTimeouts(ctx, Timeouts{Request: -1, IdleStream: time.Minute})
+	got := Timeouts{Dial: time.Hour, Request: time.Hour, IdleStream: time.Hour}.Override(TimeoutsFromContext(ctx))
+	want := Timeouts{Dial: time.Second, Request: -1, IdleStream: time.Minute}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := TimeoutsFromContext(context.Background()); got != (Timeouts{}) {
+		t.Errorf("got %+v for a context without overrides", got)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	ctx, cancel := WithTimeout(context.Background(), -1)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("a negative timeout should not set a deadline")
+	}
+	parent, cancelParent := context.WithTimeout(context.Background(), time.Second)
+	defer cancelParent()
+	ctx, cancel = WithTimeout(parent, time.Hour)
+	defer cancel()
+	if deadline, _ := ctx.Deadline(); deadline.After(time.Now().Add(time.Minute)) {
+		t.Errorf("the earlier deadline of the parent should win")
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 4}
+	tests := []struct {
+		attempt    int
+		retryAfter time.Duration
+		want       time.Duration
+	}{
+		{1, 0, 100 * time.Millisecond},
+		{2, 0, 400 * time.Millisecond},
+		{3, 0, time.Second},
+		{30, 0, time.Second},
+		{1, 3 * time.Second, 3 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.Delay(tt.attempt, tt.retryAfter); got != tt.want {
+			t.Errorf("Delay(%d, %v) = %v, want %v", tt.attempt, tt.retryAfter, got, tt.want)
+		}
+	}
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.Delay(1, 0); got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Fatalf("Delay(1, 0) = %v with jitter, want between 50ms and 100ms", got)
+		}
+	}
+}
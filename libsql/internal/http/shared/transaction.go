@@ -0,0 +1,283 @@
+package shared
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libsql/sqlite-antlr4-parser/sqliteparserutils"
+)
+
+// TxMode selects how SQLite locks the database when a transaction begins.
+type TxMode int
+
+const (
+	// TxModeDefault uses a plain BEGIN, which SQLite treats as BEGIN DEFERRED.
+	TxModeDefault TxMode = iota
+	// TxModeDeferred takes no lock until the transaction first reads or writes.
+	TxModeDeferred
+	// TxModeImmediate takes the write lock at once, so that later writes can't fail with SQLITE_BUSY.
+	TxModeImmediate
+	// TxModeExclusive also prevents other connections from reading in journal modes other than WAL.
+	TxModeExclusive
+)
+
+type txModeKey struct{}
+
+// ContextWithTxMode returns a context that makes BeginTx start transactions in the given mode.
+func ContextWithTxMode(ctx context.Context, mode TxMode) context.Context {
+	return context.WithValue(ctx, txModeKey{}, mode)
+}
+
+// BeginStatement returns the statement that starts a transaction with the given options.
+// Read-only transactions use BEGIN DEFERRED. SQLite transactions are always serializable,
+// so the only isolation levels accepted are the default and serializable ones.
+func BeginStatement(ctx context.Context, opts driver.TxOptions) (string, error) {
+	isolation := sql.IsolationLevel(opts.Isolation)
+	if isolation != sql.LevelDefault && isolation != sql.LevelSerializable {
+		return "", fmt.Errorf("isolation level %s is not supported", isolation)
+	}
+	mode, _ := ctx.Value(txModeKey{}).(TxMode)
+	if opts.ReadOnly {
+		if mode == TxModeImmediate || mode == TxModeExclusive {
+			return "", fmt.Errorf("read-only transactions can't take the write lock")
+		}
+		return "BEGIN DEFERRED", nil
+	}
+	switch mode {
+	case TxModeDeferred:
+		return "BEGIN DEFERRED", nil
+	case TxModeImmediate:
+		return "BEGIN IMMEDIATE", nil
+	case TxModeExclusive:
+		return "BEGIN EXCLUSIVE", nil
+	default:
+		return "BEGIN", nil
+	}
+}
+
+// ErrTxIdleTimeout is returned by the calls on a transaction that was rolled back because it
+// stayed unused for longer than the idle transaction timeout.
+var ErrTxIdleTimeout = errors.New("the transaction was rolled back after staying idle for too long")
+
+// IdleTxTimer rolls back transactions that stay unused for too long. Connections pause it while
+// they use the transaction and arm it again when they are done.
+type IdleTxTimer struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	expired bool
+}
+
+// Arm calls expire once the transaction has been idle for timeout, unless the timer is paused
+// before. expire must not block. Nothing happens if timeout is zero or less.
+func (t *IdleTxTimer) Arm(timeout time.Duration, expire func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stop()
+	if timeout <= 0 || t.expired {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(timeout, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.timer != timer {
+			return
+		}
+		t.timer = nil
+		t.expired = true
+		expire()
+	})
+	t.timer = timer
+}
+
+// Pause stops the timer. It returns ErrTxIdleTimeout if the transaction has already expired.
+func (t *IdleTxTimer) Pause() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stop()
+	if t.expired {
+		return ErrTxIdleTimeout
+	}
+	return nil
+}
+
+// Reset stops the timer at the end of a transaction.
+func (t *IdleTxTimer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stop()
+	t.expired = false
+}
+
+func (t *IdleTxTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+}
+
+// ErrReadOnlyTx is returned for statements that would write in a read-only transaction.
+var ErrReadOnlyTx = fmt.Errorf("cannot execute a write statement in a read-only transaction")
+
+// CheckReadOnly returns ErrReadOnlyTx if one of the statements of query may write to the database.
+func CheckReadOnly(query string) error {
+	stmts, _ := sqliteparserutils.SplitStatement(query)
+	for _, stmt := range stmts {
+		if !IsReadOnlyStatement(stmt) {
+			return fmt.Errorf("%w: %s", ErrReadOnlyTx, stmt)
+		}
+	}
+	return nil
+}
+
+// IsReadOnlyStatement reports whether stmt can't write to the database. It is conservative:
+// statements it doesn't recognize are treated as writes. Ending the transaction is allowed.
+func IsReadOnlyStatement(stmt string) bool {
+	tokens := lexKeywords(stmt)
+	if len(tokens) == 0 {
+		return true
+	}
+	switch tokens[0] {
+	case "SELECT", "VALUES", "EXPLAIN", "COMMIT", "END", "ROLLBACK", "SAVEPOINT", "RELEASE":
+		return true
+	case "WITH":
+		// Common table expressions can precede INSERT, UPDATE and DELETE as well. The statement
+		// starts at the first word after a top-level closing parenthesis, other than the AS that
+		// follows a column list.
+		depth := 0
+		for i := 1; i < len(tokens); i++ {
+			switch tokens[i] {
+			case "(":
+				depth++
+			case ")":
+				depth--
+			default:
+				if depth == 0 && tokens[i-1] == ")" && tokens[i] != "AS" && tokens[i] != "," {
+					return tokens[i] == "SELECT" || tokens[i] == "VALUES"
+				}
+			}
+		}
+		return false
+	case "PRAGMA":
+		// PRAGMA name = value and PRAGMA name(value) change a setting, except for the pragmas
+		// whose argument names what they inspect. PRAGMA name only reads.
+		for i := 1; i < len(tokens); i++ {
+			switch tokens[i] {
+			case "=":
+				return false
+			case "(":
+				return inspectionPragmas[tokens[i-1]]
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// inspectionPragmas are the pragmas that take an argument without changing anything.
+var inspectionPragmas = map[string]bool{
+	"TABLE_INFO":        true,
+	"TABLE_XINFO":       true,
+	"TABLE_LIST":        true,
+	"INDEX_INFO":        true,
+	"INDEX_XINFO":       true,
+	"INDEX_LIST":        true,
+	"FOREIGN_KEY_LIST":  true,
+	"FOREIGN_KEY_CHECK": true,
+	"INTEGRITY_CHECK":   true,
+	"QUICK_CHECK":       true,
+}
+
+// IsScript reports whether query holds more than one statement. Unlike splitting the query,
+// it doesn't parse the statements.
+func IsScript(query string) bool {
+	tokens := lexKeywords(query)
+	for i, token := range tokens {
+		if token != ";" {
+			continue
+		}
+		for _, next := range tokens[i+1:] {
+			if next != ";" {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// ChangesSession reports whether one of the statements of query starts a transaction or changes
+// state that lives as long as the connection to SQLite, such as settings, attached databases and
+// temporary tables. Such statements must not run on a stream that is closed right after them.
+func ChangesSession(query string) bool {
+	tokens := lexKeywords(query)
+	// Statements start at the beginning of the query and after each ';'. Splitting on ';' also
+	// splits the body of a trigger, whose statements can't change the session.
+	for i, token := range tokens {
+		if i > 0 && tokens[i-1] != ";" {
+			continue
+		}
+		switch token {
+		case "BEGIN", "SAVEPOINT", "PRAGMA", "ATTACH", "DETACH":
+			return true
+		case "CREATE":
+			if i+1 < len(tokens) && (tokens[i+1] == "TEMP" || tokens[i+1] == "TEMPORARY") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lexKeywords splits stmt into upper-cased words and the signs = ; , ( and ), skipping
+// comments, string literals and quoted identifiers.
+func lexKeywords(stmt string) []string {
+	var tokens []string
+	for i := 0; i < len(stmt); {
+		c := stmt[i]
+		switch {
+		case c == '-' && i+1 < len(stmt) && stmt[i+1] == '-':
+			end := strings.IndexByte(stmt[i:], '\n')
+			if end < 0 {
+				return tokens
+			}
+			i += end + 1
+		case c == '/' && i+1 < len(stmt) && stmt[i+1] == '*':
+			end := strings.Index(stmt[i+2:], "*/")
+			if end < 0 {
+				return tokens
+			}
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			end := strings.IndexByte(stmt[i+1:], closing)
+			if end < 0 {
+				return tokens
+			}
+			i += end + 2
+		case c == '=' || c == ';' || c == ',' || c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z'):
+			start := i
+			for i < len(stmt) && (stmt[i] == '_' || stmt[i] == '$' || ('a' <= stmt[i] && stmt[i] <= 'z') ||
+				('A' <= stmt[i] && stmt[i] <= 'Z') || ('0' <= stmt[i] && stmt[i] <= '9')) {
+				i++
+			}
+			tokens = append(tokens, strings.ToUpper(stmt[start:i]))
+		default:
+			i++
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,163 @@
+package shared
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBeginStatement(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    *TxMode
+		opts    driver.TxOptions
+		want    string
+		wantErr bool
+	}{
+		{name: "default", want: "BEGIN"},
+		{name: "serializable", opts: driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelSerializable)}, want: "BEGIN"},
+		{name: "read committed", opts: driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelReadCommitted)}, wantErr: true},
+		{name: "read only", opts: driver.TxOptions{ReadOnly: true}, want: "BEGIN DEFERRED"},
+		{name: "deferred", mode: txMode(TxModeDeferred), want: "BEGIN DEFERRED"},
+		{name: "immediate", mode: txMode(TxModeImmediate), want: "BEGIN IMMEDIATE"},
+		{name: "exclusive", mode: txMode(TxModeExclusive), want: "BEGIN EXCLUSIVE"},
+		{name: "read only immediate", mode: txMode(TxModeImmediate), opts: driver.TxOptions{ReadOnly: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.mode != nil {
+				ctx = ContextWithTxMode(ctx, *tt.mode)
+			}
+			got, err := BeginStatement(ctx, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func txMode(mode TxMode) *TxMode {
+	return &mode
+}
+
+func TestIsReadOnlyStatement(t *testing.T) {
+	tests := []struct {
+		stmt string
+		want bool
+	}{
+		{"SELECT * FROM t", true},
+		{"  -- comment\n select 1", true},
+		{"/* INSERT */ SELECT 'DELETE'", true},
+		{"VALUES (1), (2)", true},
+		{"EXPLAIN QUERY PLAN SELECT 1", true},
+		{"WITH x AS (SELECT 1) SELECT * FROM x", true},
+		{"WITH x AS (SELECT 1) INSERT INTO t SELECT * FROM x", false},
+		{"WITH x AS (SELECT 'a' AS a) SELECT replace(a, 'a', 'b') FROM x", true},
+		{"WITH x(a) AS (SELECT 1), y AS MATERIALIZED (SELECT (a) FROM x) SELECT * FROM y", true},
+		{"WITH x(a) AS (SELECT 1), y AS (SELECT 2) REPLACE INTO t SELECT * FROM x", false},
+		{"WITH x AS (SELECT 1) DELETE FROM t WHERE a IN (SELECT * FROM x)", false},
+		{"PRAGMA table_info(t)", true},
+		{"PRAGMA main.index_list(t)", true},
+		{"PRAGMA user_version = 3", false},
+		{"PRAGMA user_version(3)", false},
+		{"PRAGMA main.journal_mode(WAL)", false},
+		{"COMMIT", true},
+		{"INSERT INTO t VALUES (1)", false},
+		{"update t set a = 1", false},
+		{"DELETE FROM t", false},
+		{"CREATE TABLE t (a)", false},
+		{"ATTACH 'x' AS y", false},
+		{"", true},
+	}
+	for _, tt := range tests {
+		if got := IsReadOnlyStatement(tt.stmt); got != tt.want {
+			t.Errorf("IsReadOnlyStatement(%q) = %v, want %v", tt.stmt, got, tt.want)
+		}
+	}
+	if err := CheckReadOnly("SELECT 1; DELETE FROM t"); !errors.Is(err, ErrReadOnlyTx) {
+		t.Errorf("got %v, want ErrReadOnlyTx", err)
+	}
+}
+
+func TestChangesSession(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT 1", false},
+		{"INSERT INTO t VALUES (1)", false},
+		{"CREATE TABLE t (a)", false},
+		{"begin immediate", true},
+		{"SELECT 1; BEGIN", true},
+		{"SAVEPOINT sp", true},
+		{"PRAGMA foreign_keys = ON", true},
+		{"ATTACH 'other.db' AS other", true},
+		{"CREATE TEMP TABLE t (a)", true},
+		{"CREATE TEMPORARY VIEW v AS SELECT 1", true},
+		{"SELECT 'BEGIN'", false},
+		{"SELECT 1; -- comment\n pragma cache_size", true},
+		{"CREATE TRIGGER tr AFTER INSERT ON t BEGIN DELETE FROM u; END", false},
+		{"CREATE TABLE \"temp\" (a); SELECT 1", false},
+	}
+	for _, tt := range tests {
+		if got := ChangesSession(tt.query); got != tt.want {
+			t.Errorf("ChangesSession(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestIsScript(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT 1", false},
+		{"SELECT 1;", false},
+		{"SELECT 1; ;\n-- done", false},
+		{"SELECT 1; SELECT 2", true},
+		{"CREATE TABLE t (a); INSERT INTO t VALUES (1);", true},
+		{"SELECT ';' || \"a;b\" /* ; SELECT 2 */", false},
+		{"CREATE TRIGGER tr AFTER INSERT ON t BEGIN DELETE FROM u; END", true},
+	}
+	for _, tt := range tests {
+		if got := IsScript(tt.query); got != tt.want {
+			t.Errorf("IsScript(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestIdleTxTimer(t *testing.T) {
+	var timer IdleTxTimer
+	expired := make(chan struct{}, 1)
+	expire := func() { expired <- struct{}{} }
+
+	timer.Arm(time.Hour, expire)
+	if err := timer.Pause(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	timer.Arm(10*time.Millisecond, expire)
+	select {
+	case <-expired:
+	case <-time.After(time.Second):
+		t.Fatalf("the timer should expire")
+	}
+	if err := timer.Pause(); !errors.Is(err, ErrTxIdleTimeout) {
+		t.Errorf("got error %v, want ErrTxIdleTimeout", err)
+	}
+	timer.Reset()
+	if err := timer.Pause(); err != nil {
+		t.Errorf("Reset should clear the expiry, got %v", err)
+	}
+	timer.Arm(0, expire)
+	time.Sleep(20 * time.Millisecond)
+	if len(expired) != 0 {
+		t.Errorf("a zero timeout should disable the timer")
+	}
+}
@@ -0,0 +1,89 @@
+package shared
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// The blobs of libSQL vectors hold the elements in little endian. Vectors of other types than
+// FLOAT32 end with a byte for their type, which gives their blobs an odd size.
+const (
+	vectorTypeFloat32 = 1
+	vectorTypeFloat64 = 2
+)
+
+var (
+	scanTypeVector32 = reflect.TypeOf([]float32(nil))
+	scanTypeVector64 = reflect.TypeOf([]float64(nil))
+)
+
+// EncodeVector32 returns v as the blob of a libSQL vector of FLOAT32 elements.
+func EncodeVector32(v []float32) []byte {
+	blob := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(blob[4*i:], math.Float32bits(f))
+	}
+	return blob
+}
+
+// EncodeVector64 returns v as the blob of a libSQL vector of FLOAT64 elements.
+func EncodeVector64(v []float64) []byte {
+	blob := make([]byte, 8*len(v)+1)
+	for i, f := range v {
+		binary.LittleEndian.PutUint64(blob[8*i:], math.Float64bits(f))
+	}
+	blob[len(blob)-1] = vectorTypeFloat64
+	return blob
+}
+
+// DecodeVector returns the elements of the blob of a libSQL vector, as a []float32 or a
+// []float64 depending on the type of the vector.
+func DecodeVector(blob []byte) (any, error) {
+	vectorType := byte(vectorTypeFloat32)
+	data := blob
+	if len(blob)%2 == 1 {
+		vectorType = blob[len(blob)-1]
+		data = blob[:len(blob)-1]
+	}
+	switch vectorType {
+	case vectorTypeFloat32:
+		if len(data)%4 != 0 {
+			return nil, fmt.Errorf("invalid FLOAT32 vector of %d bytes", len(blob))
+		}
+		v := make([]float32, len(data)/4)
+		for i := range v {
+			v[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+		}
+		return v, nil
+	case vectorTypeFloat64:
+		if len(data)%8 != 0 {
+			return nil, fmt.Errorf("invalid FLOAT64 vector of %d bytes", len(blob))
+		}
+		v := make([]float64, len(data)/8)
+		for i := range v {
+			v[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[8*i:]))
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("unsupported vector type %d", vectorType)
+	}
+}
+
+// VectorScanType returns the Go type of the values of a vector column, []float32 or []float64,
+// and false for columns that don't hold vectors. Vector columns are declared with their number of
+// dimensions, such as F32_BLOB(3), so FLOAT32 alone is an ordinary column.
+func VectorScanType(declType string) (reflect.Type, bool) {
+	if !strings.Contains(declType, "(") {
+		return nil, false
+	}
+	switch DatabaseTypeName(declType) {
+	case "F32_BLOB", "FLOAT32":
+		return scanTypeVector32, true
+	case "F64_BLOB", "FLOAT64":
+		return scanTypeVector64, true
+	}
+	return nil, false
+}
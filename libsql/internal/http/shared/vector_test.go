@@ -0,0 +1,50 @@
+package shared
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVector(t *testing.T) {
+	v32 := []float32{1, -2.5, 3e-5}
+	blob := EncodeVector32(v32)
+	if len(blob) != 12 {
+		t.Fatalf("got %d bytes, want 12", len(blob))
+	}
+	if got, err := DecodeVector(blob); err != nil || !reflect.DeepEqual(got, v32) {
+		t.Errorf("got %v, %v, want %v", got, err, v32)
+	}
+	// FLOAT32 vectors may end with their type as well.
+	if got, err := DecodeVector(append(blob, vectorTypeFloat32)); err != nil || !reflect.DeepEqual(got, v32) {
+		t.Errorf("got %v, %v, want %v", got, err, v32)
+	}
+
+	v64 := []float64{1, -2.5, 3e-300}
+	blob = EncodeVector64(v64)
+	if len(blob) != 25 || blob[24] != vectorTypeFloat64 {
+		t.Fatalf("unexpected blob %v", blob)
+	}
+	if got, err := DecodeVector(blob); err != nil || !reflect.DeepEqual(got, v64) {
+		t.Errorf("got %v, %v, want %v", got, err, v64)
+	}
+
+	for _, invalid := range [][]byte{{1, 2}, {0, 0, 0, 0, 9}, {1, 2, 3, 4, vectorTypeFloat64}} {
+		if _, err := DecodeVector(invalid); err == nil {
+			t.Errorf("expected an error for %v", invalid)
+		}
+	}
+}
+
+func TestVectorScanType(t *testing.T) {
+	for declType, want := range map[string]reflect.Type{
+		"F32_BLOB(3)":  reflect.TypeOf([]float32(nil)),
+		"float32(768)": reflect.TypeOf([]float32(nil)),
+		"F64_BLOB(3)":  reflect.TypeOf([]float64(nil)),
+		"FLOAT64":      reflect.TypeOf(float64(0)),
+		"F32_BLOB":     reflect.TypeOf([]byte(nil)),
+	} {
+		if got := ScanType(declType); got != want {
+			t.Errorf("ScanType(%q) = %v, want %v", declType, got, want)
+		}
+	}
+}
@@ -3,8 +3,15 @@ package ws
 import (
 	"context"
 	"database/sql/driver"
+	"errors"
+	"fmt"
 	"io"
+	"reflect"
 	"sort"
+	"time"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
 )
 
 type result struct {
@@ -23,12 +30,29 @@ func (r *result) RowsAffected() (int64, error) {
 type rows struct {
 	res           *execResponse
 	currentRowIdx int
+	values        *hrana.Values
+	// declTypes are the declared types of the columns, read by the first call to Next.
+	declTypes []string
 }
 
 func (r *rows) Columns() []string {
 	return r.res.columns()
 }
 
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	return shared.DatabaseTypeName(r.res.declTypes()[index])
+}
+
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	return r.values.ScanType(r.res.declTypes()[index])
+}
+
+// ColumnTypeNullable reports every column as nullable: SQLite doesn't tell which columns of a
+// result can't hold NULL.
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return true, true
+}
+
 func (r *rows) Close() error {
 	return nil
 }
@@ -37,13 +61,18 @@ func (r *rows) Next(dest []driver.Value) error {
 	if r.currentRowIdx == r.res.rowsCount() {
 		return io.EOF
 	}
+	if r.declTypes == nil {
+		r.declTypes = r.res.declTypes()
+	}
 	count := r.res.rowLen(r.currentRowIdx)
 	for idx := 0; idx < count; idx++ {
 		v, err := r.res.value(r.currentRowIdx, idx)
 		if err != nil {
 			return err
 		}
-		dest[idx] = v
+		if dest[idx], err = r.values.Decode(v, r.declTypes[idx]); err != nil {
+			return err
+		}
 	}
 	r.currentRowIdx++
 	return nil
@@ -51,19 +80,70 @@ func (r *rows) Next(dest []driver.Value) error {
 
 type conn struct {
 	ws *websocketConn
+	// readOnly is set during read-only transactions, which reject writes before sending them.
+	readOnly bool
+	inTx     bool
+	// idleTx rolls back the transaction once it stayed unused for idleTxTimeout. broken is set
+	// when it did, since that closes the WebSocket.
+	idleTx        shared.IdleTxTimer
+	idleTxTimeout time.Duration
+	broken        bool
+	savepoints    shared.Savepoints
+	// sequenceScripts is set when statements without arguments that hold several statements
+	// are executed as scripts.
+	sequenceScripts bool
+	// describeStatements is set when statements are described on the server as they are prepared.
+	describeStatements bool
+	values             hrana.Values
+}
+
+// Config holds the connector settings chosen through libsql options.
+type Config struct {
+	// Timeouts are the defaults of the connector. Requests have no timeout unless one is set.
+	Timeouts shared.Timeouts
+	// SequenceScripts sends statements without arguments that hold several statements as
+	// scripts, with ExecScript.
+	SequenceScripts bool
+	// DescribeStatements describes statements on the server as they are prepared.
+	// It needs Hrana 2.
+	DescribeStatements bool
+	// Values sets how arguments and results are converted: times and codecs.
+	Values hrana.Values
+}
+
+type Connector struct {
+	url    string
+	jwt    string
+	config Config
+}
+
+func NewConnector(url, jwt string, config Config) *Connector {
+	return &Connector{url: url, jwt: jwt, config: config}
 }
 
-func Connect(url string, jwt string) (*conn, error) {
-	c, err := connect(url, jwt)
+// Connect opens a new connection. The dial timeout set on ctx overrides the one of the connector.
+func (c *Connector) Connect(ctx context.Context) (*conn, error) {
+	timeouts := c.config.Timeouts
+	if dial := shared.TimeoutsFromContext(ctx).Dial; dial != 0 {
+		timeouts.Dial = dial
+	}
+	ws, err := connect(ctx, c.url, c.jwt, timeouts)
 	if err != nil {
 		return nil, err
 	}
-	return &conn{c}, nil
+	return &conn{
+		ws:                 ws,
+		sequenceScripts:    c.config.SequenceScripts,
+		describeStatements: c.config.DescribeStatements,
+		values:             c.config.Values,
+	}, nil
 }
 
 type stmt struct {
 	c     *conn
 	query string
+	// desc is set when the connector describes statements as they are prepared.
+	desc *shared.StmtDescription
 }
 
 func (s stmt) Close() error {
@@ -71,9 +151,17 @@ func (s stmt) Close() error {
 }
 
 func (s stmt) NumInput() int {
+	if s.desc != nil {
+		return len(s.desc.Params)
+	}
 	return -1
 }
 
+// Description returns the description of the statement, if it was described when prepared.
+func (s stmt) Description() *shared.StmtDescription {
+	return s.desc
+}
+
 func convertToNamed(args []driver.Value) []driver.NamedValue {
 	if len(args) == 0 {
 		return nil
@@ -94,10 +182,20 @@ func (s stmt) Query(args []driver.Value) (driver.Rows, error) {
 }
 
 func (s stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if s.desc != nil {
+		if err := s.desc.CheckArgs(args); err != nil {
+			return nil, err
+		}
+	}
 	return s.c.ExecContext(ctx, s.query, args)
 }
 
 func (s stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if s.desc != nil {
+		if err := s.desc.CheckArgs(args); err != nil {
+			return nil, err
+		}
+	}
 	return s.c.QueryContext(ctx, s.query, args)
 }
 
@@ -106,52 +204,251 @@ func (c *conn) Ping() error {
 }
 
 func (c *conn) PingContext(ctx context.Context) error {
+	if err := c.enter(); err != nil {
+		return err
+	}
+	defer c.leave()
 	_, err := c.ws.exec(ctx, "SELECT 1", params{}, false)
 	return err
 }
 
+// ResetSession discards connections that have been idle for longer than the idle stream timeout.
+func (c *conn) ResetSession(ctx context.Context) error {
+	if c.broken {
+		return driver.ErrBadConn
+	}
+	idle := c.ws.timeouts.Override(shared.TimeoutsFromContext(ctx)).IdleStream
+	if idle > 0 && time.Since(c.ws.lastUsed) > idle {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
 func (c *conn) Prepare(query string) (driver.Stmt, error) {
 	return c.PrepareContext(context.Background(), query)
 }
 
-func (c *conn) PrepareContext(_ context.Context, query string) (driver.Stmt, error) {
-	return stmt{c, query}, nil
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	s := stmt{c: c, query: query}
+	if c.describeStatements && c.ws.version >= 2 {
+		desc, err := c.Describe(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		s.desc = desc
+	}
+	return s, nil
+}
+
+// Describe returns the parameters and result columns of query without executing it.
+func (c *conn) Describe(ctx context.Context, query string) (*shared.StmtDescription, error) {
+	if c.ws.version < 2 {
+		return nil, errors.New("describing statements needs a server that speaks Hrana 2")
+	}
+	if err := c.enter(); err != nil {
+		return nil, err
+	}
+	defer c.leave()
+	res, err := c.ws.describe(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return res.Description(), nil
 }
 
 func (c *conn) Close() error {
 	return c.ws.Close()
 }
 
+// IsValid reports whether the connection can be returned to the pool.
+func (c *conn) IsValid() bool {
+	return !c.broken
+}
+
+// CheckNamedValue converts arguments to the types the driver encodes, with the codecs and the
+// time format of the connector, see hrana.Values.
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	return c.values.CheckNamedValue(nv)
+}
+
+// Values returns how the connection converts arguments and results.
+func (c *conn) Values() *hrana.Values {
+	return &c.values
+}
+
 type tx struct {
 	c *conn
+	// ctx is the context of BeginTx, which also bounds COMMIT and ROLLBACK.
+	ctx context.Context
 }
 
 func (t tx) Commit() error {
-	_, err := t.c.ExecContext(context.Background(), "COMMIT", nil)
+	return t.c.finishTx(t.ctx, "COMMIT")
+}
+
+func (t tx) Rollback() error {
+	return t.c.finishTx(t.ctx, "ROLLBACK")
+}
+
+func (c *conn) finishTx(ctx context.Context, stmt string) error {
+	if err := c.idleTx.Pause(); err != nil {
+		c.endTx()
+		// The transaction was already rolled back.
+		if stmt == "ROLLBACK" {
+			return nil
+		}
+		return err
+	}
+	c.readOnly = false
+	_, err := c.ExecContext(ctx, stmt, nil)
+	c.endTx()
+	return err
+}
+
+func (c *conn) endTx() {
+	c.idleTx.Reset()
+	c.inTx = false
+	c.readOnly = false
+	c.savepoints.Reset()
+}
+
+// enter stops the idle timeout of the transaction while the connection uses it.
+func (c *conn) enter() error {
+	if !c.inTx {
+		return nil
+	}
+	return c.idleTx.Pause()
+}
+
+// leave starts the idle timeout of the transaction again.
+func (c *conn) leave() {
+	if !c.inTx {
+		return
+	}
+	c.idleTx.Arm(c.idleTxTimeout, func() {
+		// The server rolls back the transaction when the WebSocket is closed.
+		c.broken = true
+		go c.ws.Close()
+	})
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx starts a transaction. The lock mode can be chosen with shared.ContextWithTxMode.
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	stmt, err := shared.BeginStatement(ctx, opts)
+	if err != nil {
+		return tx{}, err
+	}
+	_, err = c.ExecContext(ctx, stmt, nil)
+	if err != nil {
+		return tx{}, err
+	}
+	c.readOnly = opts.ReadOnly
+	c.inTx = true
+	c.idleTxTimeout = c.ws.timeouts.Override(shared.TimeoutsFromContext(ctx)).IdleTx
+	c.leave()
+	return tx{c, ctx}, nil
+}
+
+// Savepoint creates a savepoint in the current transaction and returns its unique name.
+func (c *conn) Savepoint(ctx context.Context, name string) (string, error) {
+	if !c.inTx {
+		return "", errNoTx
+	}
+	unique, stmt, err := c.savepoints.Create(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := c.ExecContext(ctx, stmt, nil); err != nil {
+		_, _ = c.savepoints.Release(unique)
+		return "", err
+	}
+	return unique, nil
+}
+
+// ReleaseSavepoint releases the savepoint and the ones created after it.
+func (c *conn) ReleaseSavepoint(ctx context.Context, name string) error {
+	if !c.inTx {
+		return errNoTx
+	}
+	stmt, err := c.savepoints.Release(name)
 	if err != nil {
 		return err
 	}
-	return nil
+	_, err = c.ExecContext(ctx, stmt, nil)
+	return err
 }
 
-func (t tx) Rollback() error {
-	_, err := t.c.ExecContext(context.Background(), "ROLLBACK", nil)
+// RollbackToSavepoint undoes the changes made since the savepoint, which stays active.
+func (c *conn) RollbackToSavepoint(ctx context.Context, name string) error {
+	if !c.inTx {
+		return errNoTx
+	}
+	stmt, err := c.savepoints.RollbackTo(name)
 	if err != nil {
 		return err
 	}
-	return nil
+	_, err = c.ExecContext(ctx, stmt, nil)
+	return err
 }
 
-func (c *conn) Begin() (driver.Tx, error) {
-	return c.BeginTx(context.Background(), driver.TxOptions{})
+var errNoTx = errors.New("savepoints can only be used in a transaction")
+
+func (c *conn) checkReadOnly(query string) error {
+	if !c.readOnly {
+		return nil
+	}
+	return shared.CheckReadOnly(query)
+}
+
+// ExecBatch executes the batch in one request. The errors of failed steps are part of the result.
+func (c *conn) ExecBatch(ctx context.Context, batch *hrana.Batch) (*hrana.BatchResult, error) {
+	for _, step := range batch.Steps {
+		if step.Stmt.Sql == nil {
+			continue
+		}
+		if err := c.checkReadOnly(*step.Stmt.Sql); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.enter(); err != nil {
+		return nil, err
+	}
+	defer c.leave()
+	return c.ws.batch(ctx, batch)
 }
 
-func (c *conn) BeginTx(ctx context.Context, _ driver.TxOptions) (driver.Tx, error) {
-	_, err := c.ExecContext(ctx, "BEGIN", nil)
+// ExecScript executes the statements of script, separated by semicolons, with a sequence
+// request, so that the driver doesn't parse the script. Servers that only speak Hrana 1 get
+// a batch of the statements split by the driver instead.
+func (c *conn) ExecScript(ctx context.Context, script string) error {
+	if err := c.checkReadOnly(script); err != nil {
+		return err
+	}
+	if err := c.enter(); err != nil {
+		return err
+	}
+	defer c.leave()
+	if c.ws.version >= 2 {
+		return c.ws.sequence(ctx, script)
+	}
+	batch, stmts, err := hrana.ScriptBatch(script)
 	if err != nil {
-		return tx{nil}, err
+		return err
 	}
-	return tx{c}, nil
+	res, err := c.ws.batch(ctx, batch)
+	if err != nil {
+		return err
+	}
+	for i, stepErr := range res.StepErrors {
+		if stepErr != nil {
+			return fmt.Errorf("unable to execute %s: %w", script, stepErr.ToError(stmts[i], i))
+		}
+	}
+	return nil
 }
 
 func convertArgs(args []driver.NamedValue) params {
@@ -178,6 +475,20 @@ func convertArgs(args []driver.NamedValue) params {
 }
 
 func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.checkReadOnly(query); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 && c.sequenceScripts && shared.IsScript(query) {
+		// The result of a script reports neither affected rows nor inserted ids.
+		if err := c.ExecScript(ctx, query); err != nil {
+			return nil, err
+		}
+		return &result{}, nil
+	}
+	if err := c.enter(); err != nil {
+		return nil, err
+	}
+	defer c.leave()
 	res, err := c.ws.exec(ctx, query, convertArgs(args), false)
 	if err != nil {
 		return nil, err
@@ -186,9 +497,16 @@ func (c *conn) ExecContext(ctx context.Context, query string, args []driver.Name
 }
 
 func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.checkReadOnly(query); err != nil {
+		return nil, err
+	}
+	if err := c.enter(); err != nil {
+		return nil, err
+	}
+	defer c.leave()
 	res, err := c.ws.exec(ctx, query, convertArgs(args), true)
 	if err != nil {
 		return nil, err
 	}
-	return &rows{res, 0}, nil
+	return &rows{res: res, values: &c.values}, nil
 }
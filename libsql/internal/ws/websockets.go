@@ -9,17 +9,39 @@ import (
 	"sync"
 	"time"
 
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
 	"nhooyr.io/websocket"
 	"nhooyr.io/websocket/wsjson"
 )
 
 // defaultWSTimeout specifies the timeout used for initial http connection
+// when no dial timeout is configured
 var defaultWSTimeout = 120 * time.Second
 
 func errorMsg(errorResp interface{}) string {
 	return errorResp.(map[string]interface{})["error"].(map[string]interface{})["message"].(string)
 }
 
+// networkError returns the error for a failure of the WebSocket, such as a network error.
+func networkError(err error) *shared.Error {
+	return &shared.Error{Step: -1, Err: err}
+}
+
+// connError returns the error for a request that failed on the WebSocket. The connection is
+// lost, so the error wraps driver.ErrBadConn for database/sql to discard it.
+func connError(err error) *shared.Error {
+	return networkError(fmt.Errorf("%w: %w", driver.ErrBadConn, err))
+}
+
+// responseError converts the error of a response_error or hello_error message.
+func responseError(errorResp interface{}, sql string) *shared.Error {
+	code, _ := errorResp.(map[string]interface{})["error"].(map[string]interface{})["code"].(string)
+	err := shared.NewError(code, errorMsg(errorResp))
+	err.SQL = sql
+	return err
+}
+
 func isErrorResp(resp interface{}) bool {
 	return resp.(map[string]interface{})["type"] == "response_error"
 }
@@ -27,6 +49,11 @@ func isErrorResp(resp interface{}) bool {
 type websocketConn struct {
 	conn   *websocket.Conn
 	idPool *idPool
+	// timeouts are the connector defaults, before the overrides of each call.
+	timeouts shared.Timeouts
+	lastUsed time.Time
+	// version is the Hrana version negotiated with the server.
+	version int
 }
 
 type namedParam struct {
@@ -39,24 +66,20 @@ type params struct {
 	NamedArgs     []namedParam
 }
 
+// convertValue encodes an argument with the encoder of the HTTP driver, in the map form of this
+// driver's messages.
 func convertValue(v any) (map[string]interface{}, error) {
-	res := map[string]interface{}{}
-	if v == nil {
-		res["type"] = "null"
-	} else if integer, ok := v.(int64); ok {
-		res["type"] = "integer"
-		res["value"] = strconv.FormatInt(integer, 10)
-	} else if text, ok := v.(string); ok {
-		res["type"] = "text"
-		res["value"] = text
-	} else if blob, ok := v.([]byte); ok {
-		res["type"] = "blob"
-		res["base64"] = base64.StdEncoding.WithPadding(base64.NoPadding).EncodeToString(blob)
-	} else if float, ok := v.(float64); ok {
-		res["type"] = "float"
-		res["value"] = float
-	} else {
-		return nil, fmt.Errorf("unsupported value type: %s", v)
+	value, err := hrana.ToValue(v)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]interface{}{"type": value.Type}
+	switch value.Type {
+	case "null":
+	case "blob":
+		res["base64"] = value.Base64
+	default:
+		res["value"] = value.Value
 	}
 	return res, nil
 }
@@ -91,6 +114,17 @@ func (r *execResponse) columns() []string {
 	return res
 }
 
+// declTypes returns the declared types of the columns, which are empty for expressions.
+func (r *execResponse) declTypes() []string {
+	res := []string{}
+	cols := r.resp["cols"].([]interface{})
+	for idx := range cols {
+		v, _ := cols[idx].(map[string]interface{})["decltype"].(string)
+		res = append(res, v)
+	}
+	return res
+}
+
 func (r *execResponse) rowsCount() int {
 	return len(r.resp["rows"].([]interface{}))
 }
@@ -126,6 +160,8 @@ func (r *execResponse) value(rowIdx int, colIdx int) (any, error) {
 }
 
 func (ws *websocketConn) exec(ctx context.Context, sql string, sqlParams params, wantRows bool) (*execResponse, error) {
+	ctx, cancel := shared.WithTimeout(ctx, ws.timeouts.Override(shared.TimeoutsFromContext(ctx)).Request)
+	defer cancel()
 	requestId := ws.idPool.Get()
 	defer ws.idPool.Put(requestId)
 	stmt := map[string]interface{}{
@@ -168,34 +204,149 @@ func (ws *websocketConn) exec(ctx context.Context, sql string, sqlParams params,
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("%w: %s", driver.ErrBadConn, err.Error())
+		return nil, connError(err)
 	}
 
 	var resp interface{}
 	if err = wsjson.Read(ctx, ws.conn, &resp); err != nil {
-		return nil, fmt.Errorf("%w: %s", driver.ErrBadConn, err.Error())
+		return nil, connError(err)
 	}
+	ws.lastUsed = time.Now()
 
 	if isErrorResp(resp) {
-		err = fmt.Errorf("unable to execute %s: %s", sql, errorMsg(resp))
+		err = fmt.Errorf("unable to execute %s: %w", sql, responseError(resp, sql))
 		return nil, err
 	}
 
 	return &execResponse{resp.(map[string]interface{})["response"].(map[string]interface{})["result"].(map[string]interface{})}, nil
 }
 
+func (ws *websocketConn) batch(ctx context.Context, batch *hrana.Batch) (*hrana.BatchResult, error) {
+	ctx, cancel := shared.WithTimeout(ctx, ws.timeouts.Override(shared.TimeoutsFromContext(ctx)).Request)
+	defer cancel()
+	requestId := ws.idPool.Get()
+	defer ws.idPool.Put(requestId)
+	err := wsjson.Write(ctx, ws.conn, map[string]interface{}{
+		"type":       "request",
+		"request_id": requestId,
+		"request": map[string]interface{}{
+			"type":      "batch",
+			"stream_id": 0,
+			"batch":     batch,
+		},
+	})
+	if err != nil {
+		return nil, connError(err)
+	}
+
+	var resp struct {
+		Type     string `json:"type"`
+		Response struct {
+			Result hrana.BatchResult `json:"result"`
+		} `json:"response"`
+		Error *hrana.Error `json:"error"`
+	}
+	if err = wsjson.Read(ctx, ws.conn, &resp); err != nil {
+		return nil, connError(err)
+	}
+	ws.lastUsed = time.Now()
+
+	if resp.Type == "response_error" {
+		if resp.Error == nil {
+			return nil, fmt.Errorf("unable to execute batch")
+		}
+		return nil, fmt.Errorf("unable to execute batch: %w", resp.Error.ToError("", -1))
+	}
+	return &resp.Response.Result, nil
+}
+
+// sequence executes the statements of sql, separated by semicolons. It needs Hrana 2.
+func (ws *websocketConn) sequence(ctx context.Context, sql string) error {
+	ctx, cancel := shared.WithTimeout(ctx, ws.timeouts.Override(shared.TimeoutsFromContext(ctx)).Request)
+	defer cancel()
+	requestId := ws.idPool.Get()
+	defer ws.idPool.Put(requestId)
+	err := wsjson.Write(ctx, ws.conn, map[string]interface{}{
+		"type":       "request",
+		"request_id": requestId,
+		"request": map[string]interface{}{
+			"type":      "sequence",
+			"stream_id": 0,
+			"sql":       sql,
+		},
+	})
+	if err != nil {
+		return connError(err)
+	}
+
+	var resp interface{}
+	if err = wsjson.Read(ctx, ws.conn, &resp); err != nil {
+		return connError(err)
+	}
+	ws.lastUsed = time.Now()
+
+	if isErrorResp(resp) {
+		return fmt.Errorf("unable to execute %s: %w", sql, responseError(resp, sql))
+	}
+	return nil
+}
+
+// describe returns the parameters and columns of sql without executing it. It needs Hrana 2.
+func (ws *websocketConn) describe(ctx context.Context, sql string) (*hrana.DescribeResult, error) {
+	ctx, cancel := shared.WithTimeout(ctx, ws.timeouts.Override(shared.TimeoutsFromContext(ctx)).Request)
+	defer cancel()
+	requestId := ws.idPool.Get()
+	defer ws.idPool.Put(requestId)
+	err := wsjson.Write(ctx, ws.conn, map[string]interface{}{
+		"type":       "request",
+		"request_id": requestId,
+		"request": map[string]interface{}{
+			"type":      "describe",
+			"stream_id": 0,
+			"sql":       sql,
+		},
+	})
+	if err != nil {
+		return nil, connError(err)
+	}
+
+	var resp struct {
+		Type     string `json:"type"`
+		Response struct {
+			Result hrana.DescribeResult `json:"result"`
+		} `json:"response"`
+		Error *hrana.Error `json:"error"`
+	}
+	if err = wsjson.Read(ctx, ws.conn, &resp); err != nil {
+		return nil, connError(err)
+	}
+	ws.lastUsed = time.Now()
+
+	if resp.Type == "response_error" {
+		if resp.Error == nil {
+			return nil, fmt.Errorf("unable to describe %s", sql)
+		}
+		return nil, fmt.Errorf("unable to describe %s: %w", sql, resp.Error.ToError(sql, -1))
+	}
+	return &resp.Response.Result, nil
+}
+
 func (ws *websocketConn) Close() error {
 	return ws.conn.Close(websocket.StatusNormalClosure, "All's good")
 }
 
-func connect(url string, jwt string) (*websocketConn, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultWSTimeout)
+func connect(ctx context.Context, url string, jwt string, timeouts shared.Timeouts) (*websocketConn, error) {
+	dialTimeout := timeouts.Dial
+	if dialTimeout == 0 {
+		dialTimeout = defaultWSTimeout
+	}
+	ctx, cancel := shared.WithTimeout(ctx, dialTimeout)
 	defer cancel()
 	c, _, err := websocket.Dial(ctx, url, &websocket.DialOptions{
-		Subprotocols: []string{"hrana1"},
+		Subprotocols: []string{"hrana3", "hrana2", "hrana1"},
 	})
 	if err != nil {
-		return nil, err
+		return nil, networkError(err)
 	}
 
 	err = wsjson.Write(ctx, c, map[string]interface{}{
@@ -204,7 +355,7 @@ func connect(url string, jwt string) (*websocketConn, error) {
 	})
 	if err != nil {
 		c.Close(websocket.StatusInternalError, err.Error())
-		return nil, err
+		return nil, networkError(err)
 	}
 
 	err = wsjson.Write(ctx, c, map[string]interface{}{
@@ -217,17 +368,17 @@ func connect(url string, jwt string) (*websocketConn, error) {
 	})
 	if err != nil {
 		c.Close(websocket.StatusInternalError, err.Error())
-		return nil, err
+		return nil, networkError(err)
 	}
 
 	var helloResp interface{}
 	err = wsjson.Read(ctx, c, &helloResp)
 	if err != nil {
 		c.Close(websocket.StatusInternalError, err.Error())
-		return nil, err
+		return nil, networkError(err)
 	}
 	if helloResp.(map[string]interface{})["type"] == "hello_error" {
-		err = fmt.Errorf("handshake error: %s", errorMsg(helloResp))
+		err = fmt.Errorf("handshake error: %w", responseError(helloResp, ""))
 		c.Close(websocket.StatusProtocolError, err.Error())
 		return nil, err
 	}
@@ -236,15 +387,27 @@ func connect(url string, jwt string) (*websocketConn, error) {
 	err = wsjson.Read(ctx, c, &openStreamResp)
 	if err != nil {
 		c.Close(websocket.StatusInternalError, err.Error())
-		return nil, err
+		return nil, networkError(err)
 	}
 
 	if isErrorResp(openStreamResp) {
-		err = fmt.Errorf("unable to open stream: %s", errorMsg(helloResp))
+		err = fmt.Errorf("unable to open stream: %w", responseError(openStreamResp, ""))
 		c.Close(websocket.StatusProtocolError, err.Error())
 		return nil, err
 	}
-	return &websocketConn{c, newIDPool()}, nil
+	return &websocketConn{conn: c, idPool: newIDPool(), timeouts: timeouts, lastUsed: time.Now(), version: protocolVersion(c.Subprotocol())}, nil
+}
+
+// protocolVersion returns the Hrana version of a subprotocol. Servers that don't choose one speak Hrana 1.
+func protocolVersion(subprotocol string) int {
+	switch subprotocol {
+	case "hrana3":
+		return 3
+	case "hrana2":
+		return 2
+	default:
+		return 1
+	}
 }
 
 // Below is modified IDPool from "vitess.io/vitess/go/pools"
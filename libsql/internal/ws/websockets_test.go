@@ -1,9 +1,21 @@
 package ws
 
 import (
+	"context"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
 )
 
 func TestConvertValue(t *testing.T) {
@@ -58,6 +70,24 @@ func TestConvertValue(t *testing.T) {
 			},
 			err: nil,
 		},
+		{
+			name:  "bool",
+			value: true,
+			want: map[string]any{
+				"type":  "integer",
+				"value": "1",
+			},
+			err: nil,
+		},
+		{
+			name:  "int32",
+			value: int32(42),
+			want: map[string]any{
+				"type":  "integer",
+				"value": "42",
+			},
+			err: nil,
+		},
 		{
 			name:  "unsupported",
 			value: struct{}{},
@@ -116,3 +146,76 @@ func Test_execResponse_lastInsertId(t *testing.T) {
 		})
 	}
 }
+
+func Test_execResponse_declTypes(t *testing.T) {
+	r := &execResponse{
+		resp: map[string]interface{}{"cols": []interface{}{
+			map[string]interface{}{"name": "id", "decltype": "INTEGER"},
+			map[string]interface{}{"name": "count(*)", "decltype": nil},
+		}},
+	}
+	if got, want := r.declTypes(), []string{"INTEGER", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("declTypes() = %q, want %q", got, want)
+	}
+}
+
+func TestRowsDecodeTimes(t *testing.T) {
+	r := &rows{
+		res: &execResponse{resp: map[string]interface{}{
+			"cols": []interface{}{map[string]interface{}{"name": "created", "decltype": "DATE"}},
+			"rows": []interface{}{[]interface{}{map[string]interface{}{"type": "integer", "value": "1704164645"}}},
+		}},
+		values: &hrana.Values{Times: hrana.TimeFormat{DeclTypes: []string{"DATE"}, Integers: hrana.TimeUnixSeconds}},
+	}
+	dest := make([]driver.Value, 1)
+	if err := r.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); dest[0] != want {
+		t.Errorf("got %v, want %v", dest[0], want)
+	}
+}
+
+func TestProtocolVersion(t *testing.T) {
+	for subprotocol, want := range map[string]int{"hrana3": 3, "hrana2": 2, "hrana1": 1, "": 1} {
+		if got := protocolVersion(subprotocol); got != want {
+			t.Errorf("protocolVersion(%q) = %d, want %d", subprotocol, got, want)
+		}
+	}
+}
+
+func TestConnErrors(t *testing.T) {
+	// The server opens the stream and then drops the connection.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{Subprotocols: []string{"hrana3"}})
+		if err != nil {
+			return
+		}
+		var hello, openStream any
+		_ = wsjson.Read(r.Context(), c, &hello)
+		_ = wsjson.Read(r.Context(), c, &openStream)
+		_ = wsjson.Write(r.Context(), c, map[string]any{"type": "hello_ok"})
+		_ = wsjson.Write(r.Context(), c, map[string]any{"type": "response_ok", "request_id": 0})
+		c.Close(websocket.StatusGoingAway, "bye")
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	ws, err := connect(ctx, "ws"+strings.TrimPrefix(server.URL, "http"), "", shared.Timeouts{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = ws.exec(ctx, "SELECT 1", params{}, false)
+	var libsqlErr *shared.Error
+	if !errors.As(err, &libsqlErr) {
+		t.Errorf("got error %#v, want a libsql error", err)
+	}
+	if !errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("got error %v, want a bad connection", err)
+	}
+
+	server.Close()
+	_, err = connect(ctx, "ws"+strings.TrimPrefix(server.URL, "http"), "", shared.Timeouts{})
+	if !errors.As(err, &libsqlErr) {
+		t.Errorf("got error %#v, want a libsql error for a failed dial", err)
+	}
+}
@@ -0,0 +1,80 @@
+package libsql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Savepoint marks a point in a transaction that can be rolled back to without ending the
+// transaction, which makes nested units of work possible:
+//
+//	tx, err := conn.BeginTx(ctx, nil)
+//	sp, err := libsql.CreateSavepoint(ctx, conn, "import")
+//	if _, err := tx.ExecContext(ctx, "INSERT INTO items (name) VALUES (?)", name); err != nil {
+//		err = sp.RollbackTo(ctx) // the transaction goes on without the insert
+//	} else {
+//		err = sp.Release(ctx)
+//	}
+//	err = tx.Commit()
+//
+// Over HTTP, savepoint statements travel with the next statement of the transaction, so they
+// don't cost a round trip of their own.
+type Savepoint struct {
+	conn *sql.Conn
+	name string
+}
+
+// savepointer is implemented by the connections of the remote drivers.
+type savepointer interface {
+	Savepoint(ctx context.Context, name string) (string, error)
+	ReleaseSavepoint(ctx context.Context, name string) error
+	RollbackToSavepoint(ctx context.Context, name string) error
+}
+
+// CreateSavepoint creates a savepoint in the transaction that is active on conn. The name is
+// made unique by a numeric suffix, so that savepoints created by nested code don't clash.
+// It may be empty, and can only hold letters, digits and underscores.
+func CreateSavepoint(ctx context.Context, conn *sql.Conn, name string) (*Savepoint, error) {
+	var unique string
+	err := withSavepointer(conn, func(s savepointer) error {
+		var err error
+		unique, err = s.Savepoint(ctx, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Savepoint{conn: conn, name: unique}, nil
+}
+
+// Name returns the unique name of the savepoint.
+func (s *Savepoint) Name() string {
+	return s.name
+}
+
+// Release keeps the changes made since the savepoint as part of the transaction and forgets
+// the savepoint, along with the savepoints created after it.
+func (s *Savepoint) Release(ctx context.Context) error {
+	return withSavepointer(s.conn, func(sp savepointer) error {
+		return sp.ReleaseSavepoint(ctx, s.name)
+	})
+}
+
+// RollbackTo undoes the changes made since the savepoint and forgets the savepoints created
+// after it. The savepoint stays active and can be rolled back to again.
+func (s *Savepoint) RollbackTo(ctx context.Context) error {
+	return withSavepointer(s.conn, func(sp savepointer) error {
+		return sp.RollbackToSavepoint(ctx, s.name)
+	})
+}
+
+func withSavepointer(conn *sql.Conn, f func(savepointer) error) error {
+	return conn.Raw(func(driverConn any) error {
+		s, ok := driverConn.(savepointer)
+		if !ok {
+			return fmt.Errorf("savepoints are only supported by remote databases")
+		}
+		return f(s)
+	})
+}
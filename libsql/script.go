@@ -0,0 +1,29 @@
+package libsql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// scriptExecer is implemented by the connections of the remote drivers.
+type scriptExecer interface {
+	ExecScript(ctx context.Context, script string) error
+}
+
+// ExecScript executes the statements of script, separated by semicolons, in order. The server
+// splits the script, which suits schema files and migrations: statements the driver would split
+// wrongly, such as CREATE TRIGGER, are fine. The script stops at the first failed statement,
+// and the statements that succeeded before it are not rolled back unless the script holds a
+// transaction. Scripts take no arguments.
+//
+//	err := libsql.ExecScript(ctx, conn, string(schema))
+func ExecScript(ctx context.Context, conn *sql.Conn, script string) error {
+	return conn.Raw(func(driverConn any) error {
+		execer, ok := driverConn.(scriptExecer)
+		if !ok {
+			return fmt.Errorf("scripts are only supported by remote databases")
+		}
+		return execer.ExecScript(ctx, script)
+	})
+}
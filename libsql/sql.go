@@ -6,19 +6,91 @@ import (
 	"database/sql/driver"
 	"errors"
 	"fmt"
+	net_http "net/http"
 	"net/url"
+	"reflect"
 	"strings"
+	"time"
 
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
 	"github.com/tursodatabase/libsql-client-go/libsql/internal/http"
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
 	"github.com/tursodatabase/libsql-client-go/libsql/internal/ws"
 )
 
 type config struct {
-	authToken *string
-	tls       *bool
-	proxy     *string
+	authToken   *string
+	tls         *bool
+	proxy       *string
+	encoding    *Encoding
+	httpClient  *net_http.Client
+	timeouts    Timeouts
+	retryPolicy *RetryPolicy
+	replicaURL  *string
+	// sequenceScripts is set by WithSequenceScripts.
+	sequenceScripts *bool
+	// describe is set by WithDescribe.
+	describe *bool
+	// times is set by the time options. timeEncoding is set by WithTimeEncoding, since
+	// TimeText is the zero encoding.
+	times        hrana.TimeFormat
+	timeEncoding *TimeEncoding
+	// declTypeCodecs and goTypeCodecs are set by WithCodec.
+	declTypeCodecs map[string]Codec
+	goTypeCodecs   map[reflect.Type]Codec
 }
 
+// Timeouts bounds the time the driver waits for the server. A zero field leaves the
+// timeout to the connector settings or their default, and a negative one disables it.
+type Timeouts = shared.Timeouts
+
+// ContextWithTimeouts overrides the timeouts of the connector for the calls made with the returned context.
+// Deadlines of ctx still apply, so whichever deadline comes first ends the call.
+func ContextWithTimeouts(ctx context.Context, timeouts Timeouts) context.Context {
+	return shared.ContextWithTimeouts(ctx, timeouts)
+}
+
+// Error is returned for errors reported by the server and for requests that could not reach it,
+// on every remote transport. Use errors.As to inspect it:
+//
+//	var libsqlErr *libsql.Error
+//	if errors.As(err, &libsqlErr) && libsqlErr.PrimaryCode == 19 { // SQLITE_CONSTRAINT
+//		...
+//	}
+type Error = shared.Error
+
+// ConstraintError describes a UNIQUE, PRIMARY KEY, FOREIGN KEY, NOT NULL or CHECK constraint
+// violation. errors.As finds it in any error that wraps an *Error for SQLITE_CONSTRAINT:
+//
+//	var constraintErr *libsql.ConstraintError
+//	if errors.As(err, &constraintErr) && constraintErr.Kind == libsql.ConstraintUnique {
+//		// constraintErr.Table and constraintErr.Columns name the duplicated columns.
+//	}
+type ConstraintError = shared.ConstraintError
+
+// ConstraintKind is the kind of constraint reported by a ConstraintError.
+type ConstraintKind = shared.ConstraintKind
+
+const (
+	ConstraintOther      = shared.ConstraintOther
+	ConstraintUnique     = shared.ConstraintUnique
+	ConstraintPrimaryKey = shared.ConstraintPrimaryKey
+	ConstraintForeignKey = shared.ConstraintForeignKey
+	ConstraintNotNull    = shared.ConstraintNotNull
+	ConstraintCheck      = shared.ConstraintCheck
+)
+
+// Encoding selects the wire format of Hrana requests sent over HTTP.
+type Encoding int
+
+const (
+	// EncodingJSON is the default encoding and works with every server version.
+	EncodingJSON Encoding = iota
+	// EncodingProtobuf uses the binary Hrana 3 encoding. It avoids base64-encoding blobs
+	// and string-encoding integers. Servers that only speak Hrana 2 fall back to JSON.
+	EncodingProtobuf
+)
+
 type Option interface {
 	apply(*config) error
 }
@@ -65,6 +137,434 @@ func WithProxy(proxy string) Option {
 	})
 }
 
+func WithEncoding(encoding Encoding) Option {
+	return option(func(o *config) error {
+		if o.encoding != nil {
+			return fmt.Errorf("encoding already set")
+		}
+		if encoding != EncodingJSON && encoding != EncodingProtobuf {
+			return fmt.Errorf("unknown encoding %d", encoding)
+		}
+		o.encoding = &encoding
+		return nil
+	})
+}
+
+// WithHTTPClient makes the connector send all requests with client instead of its own client.
+func WithHTTPClient(client *net_http.Client) Option {
+	return option(func(o *config) error {
+		if o.httpClient != nil {
+			return fmt.Errorf("http client already set")
+		}
+		if client == nil {
+			return fmt.Errorf("http client must not be nil")
+		}
+		o.httpClient = client
+		return nil
+	})
+}
+
+// WithTransport makes the connector send all requests through transport.
+// It can't be combined with WithHTTPClient.
+func WithTransport(transport net_http.RoundTripper) Option {
+	return option(func(o *config) error {
+		if o.httpClient != nil {
+			return fmt.Errorf("http client already set")
+		}
+		if transport == nil {
+			return fmt.Errorf("transport must not be nil")
+		}
+		o.httpClient = &net_http.Client{Transport: transport}
+		return nil
+	})
+}
+
+// WithDialTimeout bounds opening a connection, including the TLS and WebSocket handshakes.
+// It defaults to 120 seconds for WebSocket URLs and to the settings of net/http for HTTP URLs.
+// It has no effect on a client set with WithHTTPClient or WithTransport. A negative timeout disables it.
+func WithDialTimeout(timeout time.Duration) Option {
+	return option(func(o *config) error {
+		if o.timeouts.Dial != 0 {
+			return fmt.Errorf("dial timeout already set")
+		}
+		if timeout == 0 {
+			return fmt.Errorf("dial timeout must not be zero")
+		}
+		o.timeouts.Dial = timeout
+		return nil
+	})
+}
+
+// WithRequestTimeout bounds each request sent to the server. It defaults to 60 seconds for
+// HTTP URLs and to no timeout for WebSocket URLs. A negative timeout disables it.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return option(func(o *config) error {
+		if o.timeouts.Request != 0 {
+			return fmt.Errorf("request timeout already set")
+		}
+		if timeout == 0 {
+			return fmt.Errorf("request timeout must not be zero")
+		}
+		o.timeouts.Request = timeout
+		return nil
+	})
+}
+
+// WithIdleStreamTimeout sets how long a stream may stay unused before the driver stops reusing it,
+// so that streams already expired by the server are not used. It is disabled by default.
+func WithIdleStreamTimeout(timeout time.Duration) Option {
+	return option(func(o *config) error {
+		if o.timeouts.IdleStream != 0 {
+			return fmt.Errorf("idle stream timeout already set")
+		}
+		if timeout == 0 {
+			return fmt.Errorf("idle stream timeout must not be zero")
+		}
+		o.timeouts.IdleStream = timeout
+		return nil
+	})
+}
+
+// WithIdleTxTimeout rolls back transactions that stay unused for longer than timeout, so that a
+// forgotten transaction does not hold the database. The next call on the transaction fails with
+// ErrTxIdleTimeout, and its connection is discarded. It is disabled by default.
+func WithIdleTxTimeout(timeout time.Duration) Option {
+	return option(func(o *config) error {
+		if o.timeouts.IdleTx != 0 {
+			return fmt.Errorf("idle transaction timeout already set")
+		}
+		if timeout == 0 {
+			return fmt.Errorf("idle transaction timeout must not be zero")
+		}
+		o.timeouts.IdleTx = timeout
+		return nil
+	})
+}
+
+// RetryPolicy controls how requests that failed for a transient reason are sent again.
+// Requests are only retried outside of transactions, including those started with BEGIN, when
+// no setting, attached database or temporary table lives on the stream, and only if the failure
+// guarantees that nothing was executed: the server could not be reached, a proxy answered 503 or 429,
+// or 502 to read-only statements, or the server reported that the stream expired.
+type RetryPolicy = shared.RetryPolicy
+
+// RetryEvent is passed to RetryPolicy.OnRetry before each retry.
+type RetryEvent = shared.RetryEvent
+
+// RetryReason classifies the errors that allow a request to be retried.
+type RetryReason = shared.RetryReason
+
+const (
+	RetryReasonConnect       = shared.RetryReasonConnect
+	RetryReasonUnavailable   = shared.RetryReasonUnavailable
+	RetryReasonRateLimited   = shared.RetryReasonRateLimited
+	RetryReasonStreamExpired = shared.RetryReasonStreamExpired
+)
+
+// DefaultRetryPolicy is used by connectors created without WithRetryPolicy. It makes three attempts,
+// waiting about 100ms and then 200ms between them. Changing it has no effect: copy it and pass
+// the copy to WithRetryPolicy instead.
+var DefaultRetryPolicy = shared.DefaultRetryPolicy
+
+// WithRetryPolicy replaces DefaultRetryPolicy for HTTP URLs. Set MaxAttempts to one to disable retries.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return option(func(o *config) error {
+		if o.retryPolicy != nil {
+			return fmt.Errorf("retry policy already set")
+		}
+		if policy.MaxAttempts < 1 {
+			return fmt.Errorf("retry policy must allow at least one attempt")
+		}
+		if policy.Multiplier < 1 && policy.MaxAttempts > 1 {
+			return fmt.Errorf("retry policy multiplier must be at least 1")
+		}
+		if policy.Jitter < 0 || policy.Jitter > 1 {
+			return fmt.Errorf("retry policy jitter must be between 0 and 1")
+		}
+		o.retryPolicy = &policy
+		return nil
+	})
+}
+
+// WithReadReplica sends read-only transactions, started with sql.TxOptions{ReadOnly: true},
+// to the replica at the given libsql://, https:// or http:// URL.
+func WithReadReplica(replicaURL string) Option {
+	return option(func(o *config) error {
+		if o.replicaURL != nil {
+			return fmt.Errorf("read replica already set")
+		}
+		if replicaURL == "" {
+			return fmt.Errorf("read replica must not be empty")
+		}
+		o.replicaURL = &replicaURL
+		return nil
+	})
+}
+
+// WithSequenceScripts makes Exec send SQL without arguments that holds several statements to the
+// server as a script, like ExecScript, instead of splitting it into statements in the driver.
+// Results of scripts report neither affected rows nor inserted ids.
+func WithSequenceScripts(enabled bool) Option {
+	return option(func(o *config) error {
+		if o.sequenceScripts != nil {
+			return fmt.Errorf("sequence scripts already set")
+		}
+		o.sequenceScripts = &enabled
+		return nil
+	})
+}
+
+// WithDescribe makes Prepare describe statements on the server, which costs a round trip per
+// prepared statement. The server reports the exact parameters, so NumInput is known for named
+// parameters too and arguments are checked before statements are sent. Statements that fail to
+// compile fail in Prepare. Servers that can't describe statements are left to the local parser.
+func WithDescribe(enabled bool) Option {
+	return option(func(o *config) error {
+		if o.describe != nil {
+			return fmt.Errorf("describe already set")
+		}
+		o.describe = &enabled
+		return nil
+	})
+}
+
+// TimeEncoding selects how times are stored in the database.
+type TimeEncoding = hrana.TimeEncoding
+
+const (
+	// TimeText stores times as text, in the layout set by WithTimeLayout.
+	TimeText = hrana.TimeText
+	// TimeUnixSeconds stores times as the number of seconds since the Unix epoch.
+	TimeUnixSeconds = hrana.TimeUnixSeconds
+	// TimeUnixMillis stores times as the number of milliseconds since the Unix epoch.
+	TimeUnixMillis = hrana.TimeUnixMillis
+	// TimeJulianDay stores times as a real number of days, like the julianday function of SQLite.
+	TimeJulianDay = hrana.TimeJulianDay
+)
+
+// DefaultTimeLayout is the layout of times written as text by default.
+const DefaultTimeLayout = hrana.DefaultTimeLayout
+
+// WithTimeEncoding sets how time.Time arguments are written. It defaults to TimeText.
+func WithTimeEncoding(encoding TimeEncoding) Option {
+	return option(func(o *config) error {
+		if o.timeEncoding != nil {
+			return fmt.Errorf("time encoding already set")
+		}
+		if encoding < TimeText || encoding > TimeJulianDay {
+			return fmt.Errorf("unknown time encoding %d", encoding)
+		}
+		o.timeEncoding = &encoding
+		return nil
+	})
+}
+
+// WithTimeLayout sets the layout, in the format of the time package, of the times written as
+// text. It is also the first layout tried when reading text as a time. It defaults to
+// DefaultTimeLayout.
+func WithTimeLayout(layout string) Option {
+	return option(func(o *config) error {
+		if o.times.Layout != "" {
+			return fmt.Errorf("time layout already set")
+		}
+		if layout == "" {
+			return fmt.Errorf("time layout must not be empty")
+		}
+		o.times.Layout = layout
+		return nil
+	})
+}
+
+// WithTimeDeclTypes sets the declared types of the columns whose values are read as time.Time,
+// such as "DATE" and "TIME". They are compared without case and without size, so DATETIME
+// matches a column declared as datetime(6). They default to TIMESTAMP and DATETIME.
+func WithTimeDeclTypes(declTypes ...string) Option {
+	return option(func(o *config) error {
+		if o.times.DeclTypes != nil {
+			return fmt.Errorf("time decl types already set")
+		}
+		if len(declTypes) == 0 {
+			return fmt.Errorf("time decl types must not be empty")
+		}
+		for _, declType := range declTypes {
+			if declType == "" {
+				return fmt.Errorf("time decl types must not be empty")
+			}
+		}
+		o.times.DeclTypes = append([]string{}, declTypes...)
+		return nil
+	})
+}
+
+// WithIntegerTimes reads the integers of time columns, see WithTimeDeclTypes, as times encoded
+// with TimeUnixSeconds or TimeUnixMillis. By default they are read as integers.
+func WithIntegerTimes(encoding TimeEncoding) Option {
+	return option(func(o *config) error {
+		if o.times.Integers != TimeText {
+			return fmt.Errorf("integer times already set")
+		}
+		if encoding != TimeUnixSeconds && encoding != TimeUnixMillis {
+			return fmt.Errorf("integer times must be encoded in unix seconds or milliseconds")
+		}
+		o.times.Integers = encoding
+		return nil
+	})
+}
+
+// WithRealTimes reads the real numbers of time columns, see WithTimeDeclTypes, as times encoded
+// with TimeUnixSeconds, TimeUnixMillis or TimeJulianDay. By default they are read as numbers.
+func WithRealTimes(encoding TimeEncoding) Option {
+	return option(func(o *config) error {
+		if o.times.Reals != TimeText {
+			return fmt.Errorf("real times already set")
+		}
+		if encoding != TimeUnixSeconds && encoding != TimeUnixMillis && encoding != TimeJulianDay {
+			return fmt.Errorf("real times must be encoded in unix seconds, milliseconds or julian days")
+		}
+		o.times.Reals = encoding
+		return nil
+	})
+}
+
+// WithTimeLocation sets the location of the times read, which is also the location of text read
+// without an offset. Times are converted to it before they are written. By default, times are
+// read in UTC and written in their own location.
+func WithTimeLocation(location *time.Location) Option {
+	return option(func(o *config) error {
+		if o.times.Location != nil {
+			return fmt.Errorf("time location already set")
+		}
+		if location == nil {
+			return fmt.Errorf("time location must not be nil")
+		}
+		o.times.Location = location
+		return nil
+	})
+}
+
+// WithCodec registers codec to decode the columns declared as declType, compared like
+// sql.ColumnType.DatabaseTypeName, and to encode the arguments of type goType. Either may be
+// left empty to only decode or only encode with the codec:
+//
+//	libsql.WithCodec("UUID", reflect.TypeOf([16]byte{}), libsql.UUIDCodec)
+//
+// Codecs take precedence over the decoding of times. Codecs are not used for the values of the
+// low-level Hrana client.
+func WithCodec(declType string, goType reflect.Type, codec Codec) Option {
+	return option(func(o *config) error {
+		if codec == nil {
+			return fmt.Errorf("codec must not be nil")
+		}
+		if declType == "" && goType == nil {
+			return fmt.Errorf("codec needs a decl type or a Go type")
+		}
+		if declType != "" {
+			name := shared.DatabaseTypeName(declType)
+			if _, ok := o.declTypeCodecs[name]; ok {
+				return fmt.Errorf("codec for decl type %s already set", name)
+			}
+			if o.declTypeCodecs == nil {
+				o.declTypeCodecs = map[string]Codec{}
+			}
+			o.declTypeCodecs[name] = codec
+		}
+		if goType != nil {
+			if _, ok := o.goTypeCodecs[goType]; ok {
+				return fmt.Errorf("codec for type %s already set", goType)
+			}
+			if o.goTypeCodecs == nil {
+				o.goTypeCodecs = map[reflect.Type]Codec{}
+			}
+			o.goTypeCodecs[goType] = codec
+		}
+		return nil
+	})
+}
+
+// TxMode selects how SQLite locks the database when a transaction begins.
+type TxMode = shared.TxMode
+
+const (
+	TxModeDefault   = shared.TxModeDefault
+	TxModeDeferred  = shared.TxModeDeferred
+	TxModeImmediate = shared.TxModeImmediate
+	TxModeExclusive = shared.TxModeExclusive
+)
+
+// ContextWithTxMode makes sql.DB.BeginTx and sql.Conn.BeginTx start the transaction in the given mode
+// when called with the returned context:
+//
+//	tx, err := db.BeginTx(libsql.ContextWithTxMode(ctx, libsql.TxModeImmediate), nil)
+//
+// Read-only transactions always use BEGIN DEFERRED and reject statements that may write
+// before sending them.
+func ContextWithTxMode(ctx context.Context, mode TxMode) context.Context {
+	return shared.ContextWithTxMode(ctx, mode)
+}
+
+// ErrReadOnlyTx is returned for statements that would write in a read-only transaction.
+var ErrReadOnlyTx = shared.ErrReadOnlyTx
+
+// ErrTxIdleTimeout is returned by the calls on a transaction that was rolled back by WithIdleTxTimeout.
+var ErrTxIdleTimeout = shared.ErrTxIdleTimeout
+
+// checkWebSocketOptions rejects options that only the HTTP transport implements.
+func (c config) checkWebSocketOptions() error {
+	if c.encoding != nil && *c.encoding != EncodingJSON {
+		return fmt.Errorf("only the JSON encoding is supported for ws:// and wss:// URLs")
+	}
+	if c.httpClient != nil {
+		return fmt.Errorf("custom http clients are not supported for ws:// and wss:// URLs")
+	}
+	if c.retryPolicy != nil {
+		return fmt.Errorf("retry policies are not supported for ws:// and wss:// URLs")
+	}
+	if c.replicaURL != nil {
+		return fmt.Errorf("read replicas are not supported for ws:// and wss:// URLs")
+	}
+	return nil
+}
+
+// values returns how arguments and results are converted, as set by the time options and
+// WithCodec.
+func (c config) values() hrana.Values {
+	times := c.times
+	if c.timeEncoding != nil {
+		times.Encoding = *c.timeEncoding
+	}
+	return hrana.Values{Times: times, DeclTypeCodecs: c.declTypeCodecs, GoTypeCodecs: c.goTypeCodecs}
+}
+
+// httpURL turns a libsql:// URL into an https:// or http:// one, depending on the tls option.
+func (c config) httpURL(u *url.URL) error {
+	if u.Scheme == "libsql" {
+		if c.tls == nil || *c.tls {
+			u.Scheme = "https"
+		} else {
+			if c.tls != nil && u.Port() == "" {
+				return fmt.Errorf("libsql:// URL without tls must specify an explicit port")
+			}
+			u.Scheme = "http"
+		}
+	}
+	return nil
+}
+
+func (c config) httpConfig() http.Config {
+	httpConfig := http.Config{
+		Client:             c.httpClient,
+		Timeouts:           c.timeouts,
+		RetryPolicy:        c.retryPolicy,
+		SequenceScripts:    c.sequenceScripts != nil && *c.sequenceScripts,
+		DescribeStatements: c.describe != nil && *c.describe,
+		Values:             c.values(),
+	}
+	if c.encoding != nil && *c.encoding == EncodingProtobuf {
+		httpConfig.Encoding = hrana.EncodingProtobuf
+	}
+	return httpConfig
+}
+
 func (c config) connector(dbPath string) (driver.Connector, error) {
 	u, err := url.Parse(dbPath)
 	if err != nil {
@@ -106,15 +606,8 @@ func (c config) connector(dbPath string) (driver.Connector, error) {
 		return nil, fmt.Errorf("unknown query parameter %#v", name)
 	}
 
-	if u.Scheme == "libsql" {
-		if c.tls == nil || *c.tls {
-			u.Scheme = "https"
-		} else {
-			if c.tls != nil && u.Port() == "" {
-				return nil, fmt.Errorf("libsql:// URL without tls must specify an explicit port")
-			}
-			u.Scheme = "http"
-		}
+	if err := c.httpURL(u); err != nil {
+		return nil, err
 	}
 
 	if (u.Scheme == "wss" || u.Scheme == "https") && c.tls != nil && !*c.tls {
@@ -145,10 +638,33 @@ func (c config) connector(dbPath string) (driver.Connector, error) {
 	}
 
 	if u.Scheme == "wss" || u.Scheme == "ws" {
-		return wsConnector{url: u.String(), authToken: authToken}, nil
+		if err := c.checkWebSocketOptions(); err != nil {
+			return nil, err
+		}
+		wsConfig := ws.Config{
+			Timeouts:           c.timeouts,
+			SequenceScripts:    c.sequenceScripts != nil && *c.sequenceScripts,
+			DescribeStatements: c.describe != nil && *c.describe,
+			Values:             c.values(),
+		}
+		return wsConnector{ws.NewConnector(u.String(), authToken, wsConfig)}, nil
 	}
 	if u.Scheme == "https" || u.Scheme == "http" {
-		return httpConnector{url: u.String(), authToken: authToken, host: host}, nil
+		httpConfig := c.httpConfig()
+		if c.replicaURL != nil {
+			replica, err := url.Parse(*c.replicaURL)
+			if err != nil {
+				return nil, err
+			}
+			if err := c.httpURL(replica); err != nil {
+				return nil, err
+			}
+			if replica.Scheme != "https" && replica.Scheme != "http" {
+				return nil, fmt.Errorf("unsupported read replica URL scheme: %s", replica.Scheme)
+			}
+			httpConfig.ReplicaURL = replica.String()
+		}
+		return httpConnector{http.NewConnector(u.String(), authToken, host, httpConfig)}, nil
 	}
 
 	return nil, fmt.Errorf("unsupported URL scheme: %s\nThis driver supports only URLs that start with libsql://, file://, https://, http://, wss:// and ws://", u.Scheme)
@@ -169,26 +685,33 @@ func NewConnector(dbPath string, opts ...Option) (driver.Connector, error) {
 }
 
 type httpConnector struct {
-	url       string
-	authToken string
-	host      string
+	connector *http.Connector
 }
 
 func (c httpConnector) Connect(_ctx context.Context) (driver.Conn, error) {
-	return http.Connect(c.url, c.authToken, c.host), nil
+	return c.connector.Connect(), nil
 }
 
 func (c httpConnector) Driver() driver.Driver {
 	return Driver{}
 }
 
+// HranaConnector returns the connector of the driver, for the libsql/hrana package.
+func (c httpConnector) HranaConnector() *http.Connector {
+	return c.connector
+}
+
+// Close is called by sql.DB.Close. It waits for the streams of closed connections to be released on the server.
+func (c httpConnector) Close() error {
+	return c.connector.Close()
+}
+
 type wsConnector struct {
-	url       string
-	authToken string
+	connector *ws.Connector
 }
 
-func (c wsConnector) Connect(_ctx context.Context) (driver.Conn, error) {
-	return ws.Connect(c.url, c.authToken)
+func (c wsConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.connector.Connect(ctx)
 }
 
 func (c wsConnector) Driver() driver.Driver {
@@ -261,7 +784,19 @@ func extractTls(query *url.Values, scheme string) (bool, error) {
 	}
 }
 
+// Open opens a connection with a connector of its own. sql.Open uses OpenConnector instead.
 func (d Driver) Open(dbUrl string) (driver.Conn, error) {
+	connector, err := d.OpenConnector(dbUrl)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(context.Background())
+}
+
+// OpenConnector implements driver.DriverContext, so that the connections sql.Open opens for
+// dbUrl share one connector: the HTTP connections to the server, the protocol version
+// negotiated with it and the streams waiting to be closed.
+func (d Driver) OpenConnector(dbUrl string) (driver.Connector, error) {
 	u, err := url.Parse(dbUrl)
 	if err != nil {
 		return nil, err
@@ -278,7 +813,7 @@ func (d Driver) Open(dbUrl string) (driver.Conn, error) {
 				if err != nil {
 					return nil, err
 				}
-				return db.Driver().Open(dbUrl)
+				return &fileConnector{url: dbUrl, driver: db.Driver()}, nil
 			}
 		}
 		return nil, fmt.Errorf("no sqlite driver present. Please import sqlite or sqlite3 driver")
@@ -319,10 +854,10 @@ func (d Driver) Open(dbUrl string) (driver.Conn, error) {
 	}
 
 	if u.Scheme == "wss" || u.Scheme == "ws" {
-		return ws.Connect(u.String(), jwt)
+		return wsConnector{ws.NewConnector(u.String(), jwt, ws.Config{})}, nil
 	}
 	if u.Scheme == "https" || u.Scheme == "http" {
-		return http.Connect(u.String(), jwt, u.Host), nil
+		return httpConnector{http.NewConnector(u.String(), jwt, u.Host, http.Config{})}, nil
 	}
 
 	return nil, fmt.Errorf("unsupported URL scheme: %s\nThis driver supports only URLs that start with libsql://, file://, https://, http://, wss:// and ws://", u.Scheme)
@@ -0,0 +1,107 @@
+package libsql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/hrana"
+)
+
+// newTestServer starts a Hrana 3 server that answers the requests of pipelines with handle, or
+// with results without rows when handle is nil. It counts the TCP connections opened to it and
+// the probes of its protocol version.
+func newTestServer(t *testing.T, handle func(hrana.StreamRequest) hrana.StreamResult) (server *httptest.Server, conns, probes *int32) {
+	conns, probes = new(int32), new(int32)
+	server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			atomic.AddInt32(probes, 1)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		var req hrana.PipelineRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var resp hrana.PipelineResponse
+		for _, stream := range req.Requests {
+			if handle != nil {
+				resp.Results = append(resp.Results, handle(stream))
+				continue
+			}
+			result := hrana.StreamResult{Type: "ok", Response: &hrana.StreamResponse{Type: stream.Type}}
+			if stream.Type == "execute" {
+				result.Response.Result = json.RawMessage(`{"cols":[],"rows":[],"affected_row_count":0}`)
+			}
+			resp.Results = append(resp.Results, result)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(conns, 1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, conns, probes
+}
+
+func TestOpenSharesConnections(t *testing.T) {
+	server, conns, _ := newTestServer(t, nil)
+	db, err := sql.Open("libsql", server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	// Each connection of the pool sends its statement once the previous one is done, so they
+	// can all use the same HTTP connection.
+	for i := 0; i < 3; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer conn.Close()
+		if _, err := conn.ExecContext(ctx, "SELECT 1"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(conns); got != 1 {
+		t.Errorf("got %d HTTP connections, want 1", got)
+	}
+}
+
+func TestOpenProbesVersionOnce(t *testing.T) {
+	server, _, probes := newTestServer(t, nil)
+	db, err := sql.Open("libsql", server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	// Hold the connections so that the pool opens a new one each time.
+	for i := 0; i < 3; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer conn.Close()
+		if _, err := conn.ExecContext(ctx, "SELECT 1"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if stats := db.Stats(); stats.OpenConnections != 3 {
+		t.Errorf("got %d open connections, want 3", stats.OpenConnections)
+	}
+	if got := atomic.LoadInt32(probes); got != 1 {
+		t.Errorf("got %d version probes, want 1", got)
+	}
+}
@@ -0,0 +1,139 @@
+package libsql
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tursodatabase/libsql-client-go/libsql/internal/http/shared"
+)
+
+// Vector is a vector of FLOAT32 elements, for the F32_BLOB columns of libSQL:
+//
+//	_, err := db.ExecContext(ctx, "CREATE TABLE movies (title TEXT, embedding F32_BLOB(3))")
+//	_, err = db.ExecContext(ctx, "INSERT INTO movies VALUES (?, ?)", "Napoleon", libsql.Vector{1, 2, 3})
+//
+// []float32 and []float64 arguments are stored as vectors as well, and the driver returns the
+// values of vector columns as []float32 or []float64. Vector scans both, as well as vector blobs
+// and the text form returned by vector_extract.
+type Vector []float32
+
+// Value implements driver.Valuer.
+func (v Vector) Value() (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return shared.EncodeVector32(v), nil
+}
+
+// Scan implements sql.Scanner.
+func (v *Vector) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*v = nil
+	case []float32:
+		*v = append(Vector{}, src...)
+	case []float64:
+		*v = make(Vector, len(src))
+		for i, f := range src {
+			(*v)[i] = float32(f)
+		}
+	case []byte:
+		decoded, err := shared.DecodeVector(src)
+		if err != nil {
+			return err
+		}
+		return v.Scan(decoded)
+	case string:
+		var elems []float32
+		if err := json.Unmarshal([]byte(src), &elems); err != nil {
+			return fmt.Errorf("invalid vector %q: %w", src, err)
+		}
+		*v = elems
+	default:
+		return fmt.Errorf("can't scan %T into a vector", src)
+	}
+	return nil
+}
+
+// String returns the text form of the vector, such as [1,2,3], which the vector32 function of
+// libSQL reads.
+func (v Vector) String() string {
+	var sb strings.Builder
+	sb.WriteByte('[')
+	for i, f := range v {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.FormatFloat(float64(f), 'g', -1, 32))
+	}
+	sb.WriteByte(']')
+	return sb.String()
+}
+
+// VectorTopK builds a nearest-neighbour query on a vector index with the vector_top_k function
+// of libSQL:
+//
+//	_, err := db.ExecContext(ctx, "CREATE INDEX movies_idx ON movies (libsql_vector_idx(embedding))")
+//	q := libsql.VectorTopK{Index: "movies_idx", Table: "movies", Column: "embedding", Columns: []string{"title"}, K: 10}
+//	query, args, err := q.Build(libsql.Vector{1, 2, 3})
+//	rows, err := db.QueryContext(ctx, query, args...)
+type VectorTopK struct {
+	// Index is the name of the vector index.
+	Index string
+	// Table is the table of the index.
+	Table string
+	// Column is the vector column of the index. When set, the cosine distance of the rows to
+	// the vector is selected last, as "distance", and the rows are ordered by it.
+	Column string
+	// Columns are the columns of the table to select. All of them are selected when empty.
+	Columns []string
+	// K is the number of neighbours to return.
+	K int
+}
+
+// Build returns the query for the K nearest neighbours of vector, and its arguments.
+func (q VectorTopK) Build(vector Vector) (string, []any, error) {
+	if q.Index == "" {
+		return "", nil, fmt.Errorf("vector index must not be empty")
+	}
+	if q.Table == "" {
+		return "", nil, fmt.Errorf("vector table must not be empty")
+	}
+	if q.K < 1 {
+		return "", nil, fmt.Errorf("vector top k must be at least 1")
+	}
+	if len(vector) == 0 {
+		return "", nil, fmt.Errorf("vector must not be empty")
+	}
+	columns := []string{}
+	for _, column := range q.Columns {
+		columns = append(columns, "t."+quoteIdentifier(column))
+	}
+	if len(columns) == 0 {
+		columns = append(columns, "t.*")
+	}
+	var args []any
+	if q.Column != "" {
+		columns = append(columns, "vector_distance_cos(t."+quoteIdentifier(q.Column)+", vector32(?)) AS distance")
+		args = append(args, vector)
+	}
+	query := "SELECT " + strings.Join(columns, ", ") +
+		" FROM vector_top_k(" + quoteString(q.Index) + ", vector32(?), ?) AS v" +
+		" JOIN " + quoteIdentifier(q.Table) + " AS t ON t.rowid = v.id"
+	args = append(args, vector, q.K)
+	if q.Column != "" {
+		query += " ORDER BY distance"
+	}
+	return query, args, nil
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
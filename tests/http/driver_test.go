@@ -5,15 +5,18 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/rand"
 	"os"
+	"reflect"
 	"runtime/debug"
 	"testing"
 	"time"
 
 	"github.com/tursodatabase/libsql-client-go/libsql"
+	"github.com/tursodatabase/libsql-client-go/libsql/hrana"
 
 	"golang.org/x/sync/errgroup"
 
@@ -42,18 +45,19 @@ type Database struct {
 	ctx context.Context
 }
 
-func getDb(t T) Database {
+func getConnector(t T, opts ...libsql.Option) driver.Connector {
 	dbURL := os.Getenv("LIBSQL_TEST_HTTP_DB_URL")
 	authToken := os.Getenv("LIBSQL_TEST_HTTP_AUTH_TOKEN")
-	var connector driver.Connector
-	var err error
-	if authToken == "" {
-		connector, err = libsql.NewConnector(dbURL)
-	} else {
-		connector, err = libsql.NewConnector(dbURL, libsql.WithAuthToken(authToken))
+	if authToken != "" {
+		opts = append(opts, libsql.WithAuthToken(authToken))
 	}
+	connector, err := libsql.NewConnector(dbURL, opts...)
 	t.FatalOnError(err)
-	db := sql.OpenDB(connector)
+	return connector
+}
+
+func getDb(t T, opts ...libsql.Option) Database {
+	db := sql.OpenDB(getConnector(t, opts...))
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	t.Cleanup(func() {
 		db.Close()
@@ -430,6 +434,27 @@ func TestDataTypes(t *testing.T) {
 	}
 }
 
+func TestArgumentTypes(t *testing.T) {
+	t.Parallel()
+	db := getDb(T{t})
+	type label string
+	text := "foo"
+	var (
+		small    int32
+		unsigned uint16
+		pointer  string
+		named    string
+		raw      []byte
+	)
+	db.t.FatalOnError(db.QueryRowContext(db.ctx, "SELECT ?, ?, ?, ?, ?", int32(-7), uint16(7), &text, label("bar"), json.RawMessage(`{}`)).Scan(&small, &unsigned, &pointer, &named, &raw))
+	if small != -7 || unsigned != 7 || pointer != "foo" || named != "bar" || string(raw) != "{}" {
+		t.Errorf("unexpected values %v, %v, %q, %q, %q", small, unsigned, pointer, named, raw)
+	}
+	if _, err := db.ExecContext(db.ctx, "SELECT ?", uint64(1)<<63); err == nil {
+		t.Errorf("an uint64 that overflows int64 should be rejected")
+	}
+}
+
 func TestConcurrentOnSingleConnection(t *testing.T) {
 	t.Parallel()
 	db := getDb(T{t})
@@ -503,3 +528,335 @@ func TestConcurrentOnSingleConnection(t *testing.T) {
 	}))
 	db.t.FatalOnError(g.Wait())
 }
+
+func TestBatch(t *testing.T) {
+	t.Parallel()
+	db := getDb(T{t})
+	table := db.createTable()
+	conn, err := db.Conn(db.ctx)
+	db.t.FatalOnError(err)
+	defer conn.Close()
+
+	var b libsql.Batch
+	begin := b.Add("BEGIN")
+	first := b.AddIf(libsql.StepOK(begin), "INSERT INTO "+table.name+" (a, b) VALUES (?, ?)", 1, 1)
+	failing := b.AddIf(libsql.StepOK(first), "INSERT INTO missing_table VALUES (1)")
+	commit := b.AddIf(libsql.StepOK(failing), "COMMIT")
+	rollback := b.AddIf(libsql.Not(libsql.StepOK(commit)), "ROLLBACK")
+	res, err := libsql.ExecBatch(db.ctx, conn, &b)
+	db.t.FatalOnError(err)
+	if !res.Steps[first].Executed || res.Steps[first].Err != nil || res.Steps[first].RowsAffected != 1 {
+		t.Errorf("the first insert should have succeeded: %+v", res.Steps[first])
+	}
+	if res.Steps[failing].Err == nil {
+		t.Errorf("the insert into a missing table should have failed")
+	}
+	if res.Steps[commit].Executed {
+		t.Errorf("the commit should have been skipped")
+	}
+	if !res.Steps[rollback].Executed {
+		t.Errorf("the rollback should have been executed")
+	}
+	table.assertRowsCount(0)
+
+	b = libsql.Batch{}
+	b.Add("INSERT INTO "+table.name+" (a, b) VALUES (?, ?)", 2, 2)
+	query := b.Add("SELECT a, b FROM " + table.name)
+	res, err = libsql.ExecBatch(db.ctx, conn, &b)
+	db.t.FatalOnError(err)
+	if len(res.Steps[query].Rows) != 1 || res.Steps[query].Rows[0][0] != int64(2) {
+		t.Errorf("unexpected rows %v", res.Steps[query].Rows)
+	}
+}
+
+func TestConstraintError(t *testing.T) {
+	t.Parallel()
+	db := getDb(T{t})
+	table := db.createTable()
+	db.exec("CREATE UNIQUE INDEX " + table.name + "_a ON " + table.name + " (a)")
+	table.insertRows(0, 1)
+
+	_, err := db.ExecContext(db.ctx, "INSERT INTO "+table.name+" (a, b) VALUES (0, 0)")
+	var constraintErr *libsql.ConstraintError
+	if !errors.As(err, &constraintErr) {
+		t.Fatalf("expected a constraint error, got %v", err)
+	}
+	if constraintErr.Kind != libsql.ConstraintUnique || constraintErr.Table != table.name ||
+		len(constraintErr.Columns) != 1 || constraintErr.Columns[0] != "a" {
+		t.Errorf("unexpected constraint error %+v", constraintErr)
+	}
+
+	conn, err := db.Conn(db.ctx)
+	db.t.FatalOnError(err)
+	defer conn.Close()
+	var b libsql.Batch
+	step := b.Add("INSERT INTO "+table.name+" (a, b) VALUES (?, ?)", 0, 0)
+	res, err := libsql.ExecBatch(db.ctx, conn, &b)
+	db.t.FatalOnError(err)
+	if !errors.As(res.Steps[step].Err, &constraintErr) || constraintErr.Kind != libsql.ConstraintUnique {
+		t.Errorf("expected a constraint error, got %v", res.Steps[step].Err)
+	}
+}
+
+func TestSavepoint(t *testing.T) {
+	t.Parallel()
+	db := getDb(T{t})
+	table := db.createTable()
+
+	conn, err := db.Conn(db.ctx)
+	db.t.FatalOnError(err)
+	defer conn.Close()
+	if _, err := libsql.CreateSavepoint(db.ctx, conn, ""); err == nil {
+		t.Fatal("expected an error outside of a transaction")
+	}
+	tx, err := conn.BeginTx(db.ctx, nil)
+	db.t.FatalOnError(err)
+	_, err = tx.ExecContext(db.ctx, "INSERT INTO "+table.name+" (a, b) VALUES (0, 0)")
+	db.t.FatalOnError(err)
+	sp, err := libsql.CreateSavepoint(db.ctx, conn, "inner")
+	db.t.FatalOnError(err)
+	_, err = tx.ExecContext(db.ctx, "INSERT INTO "+table.name+" (a, b) VALUES (1, 1)")
+	db.t.FatalOnError(err)
+	db.t.FatalOnError(sp.RollbackTo(db.ctx))
+	_, err = tx.ExecContext(db.ctx, "INSERT INTO "+table.name+" (a, b) VALUES (2, 2)")
+	db.t.FatalOnError(err)
+	db.t.FatalOnError(sp.Release(db.ctx))
+	db.t.FatalOnError(tx.Commit())
+
+	table.assertRowsCount(2)
+	table.assertRowExists(0)
+	table.assertRowDoesNotExist(1)
+	table.assertRowExists(2)
+}
+
+func TestHranaClient(t *testing.T) {
+	t.Parallel()
+	db := getDb(T{t})
+	table := db.createTable()
+
+	client, err := hrana.NewClient(getConnector(T{t}))
+	db.t.FatalOnError(err)
+	defer client.Close()
+	stream := client.OpenStream()
+	id, err := stream.StoreSQL(db.ctx, "INSERT INTO "+table.name+" (a, b) VALUES (?, ?)")
+	db.t.FatalOnError(err)
+	var requests []hrana.StreamRequest
+	for i := 0; i < 3; i++ {
+		stmt, err := hrana.NewStoredStmt(id, i, i)
+		db.t.FatalOnError(err)
+		requests = append(requests, hrana.ExecuteRequest(stmt))
+	}
+	requests = append(requests, hrana.CloseSQLRequest(id), hrana.CloseRequest())
+	results, err := stream.Pipeline(db.ctx, requests...)
+	db.t.FatalOnError(err)
+	for i, result := range results {
+		if result.Error != nil {
+			t.Fatalf("request %d failed: %s", i, result.Error.Message)
+		}
+	}
+	table.assertRowsCount(3)
+
+	stmt, err := hrana.NewStmt("SELECT COUNT(*) FROM " + table.name)
+	db.t.FatalOnError(err)
+	res, err := client.Execute(db.ctx, stmt)
+	db.t.FatalOnError(err)
+	if len(res.Rows) != 1 || res.Rows[0][0].ToValue(nil) != int64(3) {
+		t.Errorf("unexpected result %+v", res.Rows)
+	}
+
+	conn, err := db.Conn(db.ctx)
+	db.t.FatalOnError(err)
+	defer conn.Close()
+	err = conn.Raw(func(driverConn any) error {
+		stream, err := hrana.ConnStream(driverConn)
+		if err != nil {
+			return err
+		}
+		stmt, err := hrana.NewStmt("SELECT a FROM "+table.name+" WHERE b = ?", 2)
+		if err != nil {
+			return err
+		}
+		res, err := stream.Execute(db.ctx, stmt)
+		if err != nil {
+			return err
+		}
+		if len(res.Rows) != 1 || res.Rows[0][0].ToValue(nil) != int64(2) {
+			t.Errorf("unexpected result %+v", res.Rows)
+		}
+		return nil
+	})
+	db.t.FatalOnError(err)
+}
+
+func TestExecScript(t *testing.T) {
+	t.Parallel()
+	db := getDb(T{t})
+	table := db.createTable()
+	conn, err := db.Conn(db.ctx)
+	db.t.FatalOnError(err)
+	defer conn.Close()
+
+	log := table.name + "_log"
+	script := `
+		CREATE TABLE ` + log + ` (a int);
+		CREATE TRIGGER ` + log + `_insert AFTER INSERT ON ` + table.name + ` BEGIN
+			INSERT INTO ` + log + ` (a) VALUES (new.a);
+		END;
+		INSERT INTO ` + table.name + ` (a, b) VALUES (0, 0);`
+	db.t.FatalOnError(libsql.ExecScript(db.ctx, conn, script))
+	defer db.exec("DROP TABLE " + log)
+	table.assertRowsCount(1)
+	table.db.assertTable(log)
+
+	err = libsql.ExecScript(db.ctx, conn, "INSERT INTO "+table.name+" (a, b) VALUES (1, 1); SELECT * FROM missing; INSERT INTO "+table.name+" (a, b) VALUES (2, 2)")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	// The script stops at the failed statement.
+	table.assertRowsCount(2)
+	table.assertRowDoesNotExist(2)
+}
+
+func TestDescribe(t *testing.T) {
+	t.Parallel()
+	db := getDb(T{t})
+	table := db.createTable()
+	conn, err := db.Conn(db.ctx)
+	db.t.FatalOnError(err)
+	defer conn.Close()
+
+	desc, err := libsql.Describe(db.ctx, conn, "SELECT a, b + 1 AS c FROM "+table.name+" WHERE a = :a AND b = ?")
+	db.t.FatalOnError(err)
+	if len(desc.Params) != 2 || desc.Params[0] != ":a" || desc.Params[1] != "" {
+		t.Errorf("unexpected params %q", desc.Params)
+	}
+	want := []libsql.ColumnDescription{{Name: "a", DeclType: "INT"}, {Name: "c"}}
+	if len(desc.Columns) != 2 || desc.Columns[0] != want[0] || desc.Columns[1] != want[1] {
+		t.Errorf("got columns %+v, want %+v", desc.Columns, want)
+	}
+	if !desc.IsReadOnly || desc.IsExplain {
+		t.Errorf("unexpected description %+v", desc)
+	}
+	if _, err := libsql.Describe(db.ctx, conn, "SELECT * FROM missing"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestColumnTypes(t *testing.T) {
+	t.Parallel()
+	db := getDb(T{t})
+	table := db.createTable()
+	rows, err := db.QueryContext(db.ctx, "SELECT a, b + 1 FROM "+table.name)
+	db.t.FatalOnError(err)
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	db.t.FatalOnError(err)
+	if got := types[0].DatabaseTypeName(); got != "INT" {
+		t.Errorf("got database type %q, want INT", got)
+	}
+	if got := types[0].ScanType(); got != reflect.TypeOf(int64(0)) {
+		t.Errorf("got scan type %v, want int64", got)
+	}
+	if got := types[1].DatabaseTypeName(); got != "" {
+		t.Errorf("got database type %q for an expression, want none", got)
+	}
+	if nullable, ok := types[0].Nullable(); !nullable || !ok {
+		t.Errorf("columns should be reported as nullable")
+	}
+}
+
+func TestTimeOptions(t *testing.T) {
+	t.Parallel()
+	db := getDb(T{t},
+		libsql.WithTimeEncoding(libsql.TimeUnixSeconds),
+		libsql.WithTimeDeclTypes("DATE", "TIME"),
+		libsql.WithIntegerTimes(libsql.TimeUnixSeconds),
+		libsql.WithTimeLayout(time.RFC3339),
+	)
+	name := "test_" + fmt.Sprint(rand.Int()) + "_" + time.Now().Format("20060102150405")
+	db.exec("CREATE TABLE " + name + " (created DATE, updated TIME)")
+	defer db.exec("DROP TABLE " + name)
+
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	db.exec("INSERT INTO "+name+" VALUES (?, '2024-01-02T04:04:05+01:00')", created)
+	var stored int64
+	db.t.FatalOnError(db.QueryRowContext(db.ctx, "SELECT CAST(created AS INTEGER) FROM "+name).Scan(&stored))
+	if stored != created.Unix() {
+		t.Errorf("got %d stored, want unix seconds %d", stored, created.Unix())
+	}
+	var gotCreated, gotUpdated time.Time
+	db.t.FatalOnError(db.QueryRowContext(db.ctx, "SELECT created, updated FROM "+name).Scan(&gotCreated, &gotUpdated))
+	if !gotCreated.Equal(created) || !gotUpdated.Equal(created) {
+		t.Errorf("got %v and %v, want %v", gotCreated, gotUpdated, created)
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	t.Parallel()
+	db := getDb(T{t},
+		libsql.WithCodec("BOOLEAN", nil, libsql.BoolCodec),
+		libsql.WithCodec("JSON", reflect.TypeOf(json.RawMessage{}), libsql.JSONCodec),
+		libsql.WithCodec("UUID", reflect.TypeOf([16]byte{}), libsql.UUIDCodec),
+		libsql.WithCodec("DECIMAL", reflect.TypeOf(libsql.Decimal("")), libsql.DecimalCodec),
+	)
+	name := "test_" + fmt.Sprint(rand.Int()) + "_" + time.Now().Format("20060102150405")
+	db.exec("CREATE TABLE " + name + " (active BOOLEAN, data JSON, id UUID, price DECIMAL(30, 3))")
+	defer db.exec("DROP TABLE " + name)
+
+	id := [16]byte{1, 2, 3, 15: 4}
+	price := libsql.Decimal("12345678901234567890.125")
+	db.exec("INSERT INTO "+name+" VALUES (?, ?, ?, ?)", true, json.RawMessage(`{"a":1}`), id, price)
+	var (
+		active   bool
+		data     json.RawMessage
+		gotID    [16]byte
+		gotPrice libsql.Decimal
+		kind     string
+	)
+	db.t.FatalOnError(db.QueryRowContext(db.ctx, "SELECT active, data, id, price, json_type(data) FROM "+name).Scan(&active, &data, &gotID, &gotPrice, &kind))
+	if !active || string(data) != `{"a":1}` || gotID != id || gotPrice != price || kind != "object" {
+		t.Errorf("got %v, %s, %v, %s, %s", active, data, gotID, gotPrice, kind)
+	}
+}
+
+func TestVectors(t *testing.T) {
+	t.Parallel()
+	db := getDb(T{t})
+	name := "test_" + fmt.Sprint(rand.Int()) + "_" + time.Now().Format("20060102150405")
+	db.exec("CREATE TABLE " + name + " (title TEXT, embedding F32_BLOB(3))")
+	defer db.exec("DROP TABLE " + name)
+	db.exec("CREATE INDEX " + name + "_idx ON " + name + " (libsql_vector_idx(embedding))")
+	db.exec("INSERT INTO "+name+" VALUES (?, ?), (?, ?), (?, ?)",
+		"a", libsql.Vector{1, 0, 0},
+		"b", []float32{0, 1, 0},
+		"c", libsql.Vector{0, 0, 1},
+	)
+
+	var embedding libsql.Vector
+	db.t.FatalOnError(db.QueryRowContext(db.ctx, "SELECT embedding FROM "+name+" WHERE title = 'b'").Scan(&embedding))
+	if embedding.String() != "[0,1,0]" {
+		t.Errorf("got %v, want [0,1,0]", embedding)
+	}
+	var raw []float32
+	db.t.FatalOnError(db.QueryRowContext(db.ctx, "SELECT embedding FROM "+name+" WHERE title = 'a'").Scan(&raw))
+	if !reflect.DeepEqual(raw, []float32{1, 0, 0}) {
+		t.Errorf("got %v, want [1 0 0]", raw)
+	}
+
+	q := libsql.VectorTopK{Index: name + "_idx", Table: name, Column: "embedding", Columns: []string{"title"}, K: 2}
+	query, args, err := q.Build(libsql.Vector{0.1, 0.9, 0})
+	db.t.FatalOnError(err)
+	rows := db.query(query, args...)
+	defer rows.Close()
+	var titles []string
+	for rows.Next() {
+		var title string
+		var distance float64
+		db.t.FatalOnError(rows.Scan(&title, &distance))
+		titles = append(titles, title)
+	}
+	db.t.FatalOnError(rows.Err())
+	if !reflect.DeepEqual(titles, []string{"b", "a"}) {
+		t.Errorf("got %v, want the two nearest neighbours b and a", titles)
+	}
+}
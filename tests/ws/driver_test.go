@@ -7,6 +7,7 @@ import (
 	"database/sql/driver"
 	"errors"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/tursodatabase/libsql-client-go/libsql"
@@ -363,3 +364,57 @@ func TestExecResult(t *testing.T) {
 		cleanupDB(ctx, t, db)
 	})
 }
+
+func TestExecScript(t *testing.T) {
+	ctx := context.Background()
+	db := setupDB(ctx, t)
+	t.Cleanup(func() {
+		cleanupDB(ctx, t, db)
+	})
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	script := `
+		CREATE TABLE IF NOT EXISTS test_log (name TEXT);
+		CREATE TRIGGER IF NOT EXISTS test_log_insert AFTER INSERT ON test BEGIN
+			INSERT INTO test_log (name) VALUES (new.name);
+		END;
+		INSERT INTO test (name) VALUES ('hello world');`
+	if err := libsql.ExecScript(ctx, conn, script); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.ExecContext(ctx, "DROP TABLE test_log")
+	assertRows(ctx, t, db)
+	var count int
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM test_log").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("the trigger should have logged 1 row, got %d", count)
+	}
+}
+
+func TestColumnTypes(t *testing.T) {
+	ctx := context.Background()
+	db := setupDB(ctx, t)
+	t.Cleanup(func() {
+		cleanupDB(ctx, t, db)
+	})
+	rows, err := db.QueryContext(ctx, "SELECT id, name FROM test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := types[0].DatabaseTypeName(); got != "INTEGER" {
+		t.Errorf("got database type %q, want INTEGER", got)
+	}
+	if got := types[1].ScanType(); got != reflect.TypeOf("") {
+		t.Errorf("got scan type %v, want string", got)
+	}
+}